@@ -0,0 +1,385 @@
+package anka
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+)
+
+// buildCacheDirName is the directory under the packer cache that records finished builds, one
+// file per fingerprint
+const buildCacheDirName = "anka-build-cache"
+
+// buildCacheIgnoredKeys are set by packer from the command line and don't change what is built
+var buildCacheIgnoredKeys = map[string]bool{
+	"packer_force":        true,
+	"packer_debug":        true,
+	"packer_on_error":     true,
+	"packer_core_version": true,
+}
+
+// buildCacheConfigHash hashes the builder's raw configuration, before defaults are applied
+func buildCacheConfigHash(raws ...interface{}) (string, error) {
+	hash := sha256.New()
+
+	for _, raw := range raws {
+		if values, ok := raw.(map[string]interface{}); ok {
+			filtered := map[string]interface{}{}
+			for key, value := range values {
+				if !buildCacheIgnoredKeys[key] {
+					filtered[key] = value
+				}
+			}
+			raw = filtered
+		}
+
+		// Map keys are sorted, so the same configuration always hashes the same
+		data, err := json.Marshal(raw)
+		if err != nil {
+			return "", err
+		}
+		hash.Write(data)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// buildCacheInputFiles expands build_cache_inputs into the files they name, sorted. Directories
+// include every file under them.
+func buildCacheInputFiles(patterns []string) ([]string, error) {
+	var files []string
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid pattern: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%q does not match any files", pattern)
+		}
+
+		for _, match := range matches {
+			err = filepath.WalkDir(match, func(path string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !entry.IsDir() {
+					files = append(files, path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// buildFingerprint hashes what a template is built from: the builder configuration, the source
+// template or installer, the anka version and the contents of build_cache_inputs
+func buildFingerprint(config *Config, source string, ankaVersion string) (string, error) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "config %s\nsource %s\nanka %s\n", config.buildCacheConfigHash, source, ankaVersion)
+
+	files, err := buildCacheInputFiles(config.BuildCacheInputs)
+	if err != nil {
+		return "", fmt.Errorf("build_cache_inputs: %w", err)
+	}
+
+	for _, path := range files {
+		file, err := os.Open(path)
+		if err != nil {
+			return "", fmt.Errorf("build_cache_inputs: %w", err)
+		}
+
+		fileHash := sha256.New()
+		_, err = io.Copy(fileHash, file)
+		file.Close()
+		if err != nil {
+			return "", fmt.Errorf("build_cache_inputs: failed to read %s: %w", path, err)
+		}
+
+		fmt.Fprintf(hash, "input %s %x\n", filepath.ToSlash(path), fileHash.Sum(nil))
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// buildCacheCloneSource identifies a clone source by the UUID, tag and image ID that anka show
+// reports locally and anka registry describe reports before it's pulled
+func buildCacheCloneSource(uuid string, tag string, imageID string) string {
+	return fmt.Sprintf("clone %s %s %s", uuid, tag, imageID)
+}
+
+// buildCacheRecord is a finished build, enough to return its artifact again
+type buildCacheRecord struct {
+	Fingerprint      string                 `json:"fingerprint"`
+	VMName           string                 `json:"vm_name"`
+	VMID             string                 `json:"vm_id"`
+	FinalState       string                 `json:"final_state"`
+	InstallerVersion string                 `json:"installer_version,omitempty"`
+	InstallerBuild   string                 `json:"installer_build,omitempty"`
+	GeneratedData    map[string]interface{} `json:"generated_data"`
+	Created          time.Time              `json:"created"`
+}
+
+// buildCache keeps a record of every build finished with build_cache enabled
+type buildCache struct {
+	dir string
+}
+
+func newBuildCache() (*buildCache, error) {
+	dir, err := packer.CachePath(buildCacheDirName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the packer cache directory: %w", err)
+	}
+
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create build cache %s: %w", dir, err)
+	}
+
+	return &buildCache{dir: dir}, nil
+}
+
+func (c *buildCache) path(fingerprint string) string {
+	return filepath.Join(c.dir, fingerprint+".json")
+}
+
+// Load returns the build recorded for fingerprint, if there is one
+func (c *buildCache) Load(fingerprint string) (buildCacheRecord, bool, error) {
+	var record buildCacheRecord
+
+	data, err := os.ReadFile(c.path(fingerprint))
+	if errors.Is(err, os.ErrNotExist) {
+		return record, false, nil
+	}
+	if err != nil {
+		return record, false, err
+	}
+
+	err = json.Unmarshal(data, &record)
+	if err != nil {
+		return record, false, fmt.Errorf("failed to parse %s: %w", c.path(fingerprint), err)
+	}
+	return record, true, nil
+}
+
+func (c *buildCache) Save(record buildCacheRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path(record.Fingerprint), data, 0o644)
+}
+
+// Records lists every recorded build. Entries that can't be read are skipped.
+func (c *buildCache) Records() ([]buildCacheRecord, error) {
+	entries, err := os.ReadDir(c.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var records []buildCacheRecord
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		record, found, err := c.Load(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			log.Printf("Skipping build cache entry %s: %s", entry.Name(), err)
+			continue
+		}
+		if found {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (c *buildCache) Delete(fingerprint string) error {
+	err := os.Remove(c.path(fingerprint))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// checkBuildCache fingerprints the build once the create or clone step knows its source. When
+// a build with the same fingerprint finished before and its VM still exists in the stopped or
+// suspended state the build left it in, the cached build is put in state as build_cache_hit, with
+// its vm_name, and true is returned so the step can return without building. The steps after it
+// are wrapped in skipOnBuildCacheHit, so they don't run either.
+//
+// The cache is local to the host and only knows what anka show reports: a VM that was modified
+// and then returned to the same state, or replaced by another VM with the same UUID, still counts
+// as a hit.
+func checkBuildCache(state multistep.StateBag, config *Config, source string) (bool, error) {
+	if !config.BuildCache {
+		return false, nil
+	}
+
+	ui := state.Get("ui").(packer.Ui)
+	ankaClient := state.Get("client").(client.Client)
+
+	ankaVersion := ""
+	if capabilities, ok := state.GetOk("host_capabilities"); ok {
+		ankaVersion = capabilities.(hostCapabilities).Version
+	}
+
+	fingerprint, err := buildFingerprint(config, source, ankaVersion)
+	if err != nil {
+		return false, err
+	}
+	state.Put("build_cache_fingerprint", fingerprint)
+
+	// -force builds again, and the new build replaces the cached one
+	if config.PackerForce {
+		ui.Say(fmt.Sprintf("Not using the build cache with -force, the build will be recorded as %s", fingerprint))
+		return false, nil
+	}
+
+	cache, err := newBuildCache()
+	if err != nil {
+		return false, err
+	}
+
+	record, found, err := cache.Load(fingerprint)
+	if err != nil {
+		return false, err
+	}
+	if !found {
+		ui.Say(fmt.Sprintf("Build cache miss for fingerprint %s, building", fingerprint))
+		return false, nil
+	}
+
+	show, err := ankaClient.Show(record.VMName)
+	stale := ""
+	switch {
+	case err != nil || show.UUID != record.VMID:
+		stale = fmt.Sprintf("VM %s (%s) no longer exists", record.VMName, record.VMID)
+	case show.Status != finalStateStatus(record.FinalState) || show.IsRunning():
+		// A VM that was started since it was built may have been changed
+		stale = fmt.Sprintf("VM %s is %s, not %s as the build left it", record.VMName, show.Status, finalStateStatus(record.FinalState))
+	}
+	if stale != "" {
+		ui.Say(fmt.Sprintf("Build cache entry %s is stale, %s, building", fingerprint, stale))
+
+		err = cache.Delete(fingerprint)
+		if err != nil {
+			ui.Error(fmt.Sprintf("Warning: failed to delete stale build cache entry %s: %s", fingerprint, err))
+		}
+		return false, nil
+	}
+
+	ui.Say(fmt.Sprintf("Build cache hit for fingerprint %s: %s was built from the same inputs on %s, skipping the build", fingerprint, record.VMName, record.Created.Format(time.RFC3339)))
+	state.Put("build_cache_hit", record)
+	state.Put("vm_name", record.VMName)
+
+	return true, nil
+}
+
+// skipOnBuildCacheHit runs Step unless the create or clone step found a cached build. A hit then
+// ends the run with ActionContinue, so -on-error doesn't treat it as a failure and the cleanup
+// of every step, such as releasing the host locks, still runs.
+type skipOnBuildCacheHit struct {
+	multistep.Step
+	ran bool
+}
+
+// Run skips the step on a build cache hit
+func (s *skipOnBuildCacheHit) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	if _, ok := state.GetOk("build_cache_hit"); ok {
+		return multistep.ActionContinue
+	}
+
+	s.ran = true
+	return s.Step.Run(ctx, state)
+}
+
+// Cleanup only cleans up after the step if it ran
+func (s *skipOnBuildCacheHit) Cleanup(state multistep.StateBag) {
+	if s.ran {
+		s.Step.Cleanup(state)
+	}
+}
+
+// saveBuildCacheRecord records a finished build under its fingerprint. Builds left running aren't
+// recorded, since nothing tells whether the VM changed after the build. Failing to only warns,
+// since the build itself worked.
+func saveBuildCacheRecord(ui packer.Ui, fingerprint string, vmID string, vmName string, stateData map[string]interface{}) {
+	if stateData["final_state"] == finalStateRunning {
+		ui.Say(fmt.Sprintf("Not recording %s in the build cache, it was left running", vmName))
+		return
+	}
+
+	record := buildCacheRecord{
+		Fingerprint: fingerprint,
+		VMName:      vmName,
+		VMID:        vmID,
+		Created:     time.Now().UTC(),
+	}
+	record.FinalState, _ = stateData["final_state"].(string)
+	record.InstallerVersion, _ = stateData["installer_version"].(string)
+	record.InstallerBuild, _ = stateData["installer_build"].(string)
+	record.GeneratedData, _ = stateData["generated_data"].(map[string]interface{})
+
+	cache, err := newBuildCache()
+	if err == nil {
+		err = cache.Save(record)
+	}
+	if err != nil {
+		ui.Error(fmt.Sprintf("Warning: failed to record build %s in the build cache: %s", fingerprint, err))
+		return
+	}
+
+	ui.Say(fmt.Sprintf("Recorded %s in the build cache as %s", vmName, fingerprint))
+}
+
+// buildCacheArtifact is the artifact of a cached build, with the state data it was built with
+func buildCacheArtifact(ankaClient client.Client, record buildCacheRecord) (packer.Artifact, error) {
+	descr, err := ankaClient.Describe(record.VMName)
+	if err != nil {
+		return nil, err
+	}
+
+	stateData := map[string]interface{}{
+		"generated_data":  record.GeneratedData,
+		"hard_drives":     descr.HardDrives,
+		"optical_drives":  descr.OpticalDrives,
+		"final_state":     record.FinalState,
+		"build_cache_hit": true,
+	}
+	if record.InstallerVersion != "" {
+		stateData["installer_version"] = record.InstallerVersion
+		stateData["installer_build"] = record.InstallerBuild
+	}
+
+	return &Artifact{
+		vmId:      descr.UUID,
+		vmName:    descr.Name,
+		StateData: stateData,
+	}, nil
+}
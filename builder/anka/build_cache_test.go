@@ -0,0 +1,187 @@
+package anka
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"gotest.tools/v3/assert"
+)
+
+func TestBuildFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "scripts", "install.sh")
+	assert.NilError(t, os.MkdirAll(filepath.Dir(script), 0o755))
+	assert.NilError(t, os.WriteFile(script, []byte("brew install jq"), 0o644))
+
+	config, err := NewConfig(cloneTestConfig(map[string]interface{}{
+		"build_cache":        true,
+		"build_cache_inputs": []string{filepath.Join(dir, "scripts")},
+	}))
+	assert.NilError(t, err)
+
+	fingerprint, err := buildFingerprint(config, "clone source-uuid v1 image", "3.5.0")
+	assert.NilError(t, err)
+
+	again, err := buildFingerprint(config, "clone source-uuid v1 image", "3.5.0")
+	assert.NilError(t, err)
+	assert.Equal(t, again, fingerprint)
+
+	t.Run("changes with the source", func(t *testing.T) {
+		changed, err := buildFingerprint(config, "clone source-uuid v2 image", "3.5.0")
+		assert.NilError(t, err)
+		assert.Assert(t, changed != fingerprint)
+	})
+
+	t.Run("changes with the anka version", func(t *testing.T) {
+		changed, err := buildFingerprint(config, "clone source-uuid v1 image", "3.6.0")
+		assert.NilError(t, err)
+		assert.Assert(t, changed != fingerprint)
+	})
+
+	t.Run("changes with the config", func(t *testing.T) {
+		changedConfig, err := NewConfig(cloneTestConfig(map[string]interface{}{
+			"build_cache":        true,
+			"build_cache_inputs": []string{filepath.Join(dir, "scripts")},
+			"ram_size":           "8G",
+		}))
+		assert.NilError(t, err)
+
+		changed, err := buildFingerprint(changedConfig, "clone source-uuid v1 image", "3.5.0")
+		assert.NilError(t, err)
+		assert.Assert(t, changed != fingerprint)
+	})
+
+	t.Run("ignores -force and -debug", func(t *testing.T) {
+		forcedConfig, err := NewConfig(cloneTestConfig(map[string]interface{}{
+			"build_cache":        true,
+			"build_cache_inputs": []string{filepath.Join(dir, "scripts")},
+			"packer_debug":       true,
+			"packer_force":       true,
+		}))
+		assert.NilError(t, err)
+
+		same, err := buildFingerprint(forcedConfig, "clone source-uuid v1 image", "3.5.0")
+		assert.NilError(t, err)
+		assert.Equal(t, same, fingerprint)
+	})
+
+	t.Run("changes with the inputs", func(t *testing.T) {
+		assert.NilError(t, os.WriteFile(filepath.Join(dir, "scripts", "cleanup.sh"), []byte("rm -rf ~/Library/Caches"), 0o644))
+
+		changed, err := buildFingerprint(config, "clone source-uuid v1 image", "3.5.0")
+		assert.NilError(t, err)
+		assert.Assert(t, changed != fingerprint)
+	})
+
+	t.Run("fails when an input is missing", func(t *testing.T) {
+		missingConfig, err := NewConfig(cloneTestConfig(map[string]interface{}{
+			"build_cache":        true,
+			"build_cache_inputs": []string{filepath.Join(dir, "missing", "*.sh")},
+		}))
+		assert.NilError(t, err)
+
+		_, err = buildFingerprint(missingConfig, "clone source-uuid v1 image", "3.5.0")
+		assert.ErrorContains(t, err, "does not match any files")
+	})
+}
+
+func TestBuildCacheRecord(t *testing.T) {
+	t.Setenv("PACKER_CACHE_DIR", t.TempDir())
+
+	cache, err := newBuildCache()
+	assert.NilError(t, err)
+
+	_, found, err := cache.Load("abc123")
+	assert.NilError(t, err)
+	assert.Equal(t, found, false)
+
+	record := buildCacheRecord{
+		Fingerprint:   "abc123",
+		VMName:        "macos-15-xcode",
+		VMID:          "1234-abcdef",
+		FinalState:    "stop",
+		GeneratedData: map[string]interface{}{"OSVersion": "15.1"},
+	}
+	assert.NilError(t, cache.Save(record))
+
+	loaded, found, err := cache.Load("abc123")
+	assert.NilError(t, err)
+	assert.Equal(t, found, true)
+	assert.DeepEqual(t, loaded, record)
+
+	assert.NilError(t, cache.Delete("abc123"))
+	_, found, err = cache.Load("abc123")
+	assert.NilError(t, err)
+	assert.Equal(t, found, false)
+}
+
+func TestSaveBuildCacheRecord(t *testing.T) {
+	t.Setenv("PACKER_CACHE_DIR", t.TempDir())
+	ui := packer.TestUi(t)
+
+	cache, err := newBuildCache()
+	assert.NilError(t, err)
+
+	t.Run("records the build", func(t *testing.T) {
+		saveBuildCacheRecord(ui, "abc123", "1234-abcdef", "macos-15-xcode", map[string]interface{}{"final_state": finalStateSuspend})
+
+		record, found, err := cache.Load("abc123")
+		assert.NilError(t, err)
+		assert.Equal(t, found, true)
+		assert.Equal(t, record.FinalState, finalStateSuspend)
+	})
+
+	t.Run("skips builds left running", func(t *testing.T) {
+		saveBuildCacheRecord(ui, "def456", "1234-abcdef", "macos-15-xcode", map[string]interface{}{"final_state": finalStateRunning})
+
+		_, found, err := cache.Load("def456")
+		assert.NilError(t, err)
+		assert.Equal(t, found, false)
+	})
+}
+
+// countingStep counts how often it runs and cleans up
+type countingStep struct {
+	runs     int
+	cleanups int
+}
+
+func (s *countingStep) Run(_ context.Context, _ multistep.StateBag) multistep.StepAction {
+	s.runs++
+	return multistep.ActionContinue
+}
+
+func (s *countingStep) Cleanup(_ multistep.StateBag) {
+	s.cleanups++
+}
+
+func TestSkipOnBuildCacheHit(t *testing.T) {
+	t.Run("runs the step without a hit", func(t *testing.T) {
+		inner := &countingStep{}
+		step := &skipOnBuildCacheHit{Step: inner}
+		state := new(multistep.BasicStateBag)
+
+		assert.Equal(t, multistep.ActionContinue, step.Run(context.Background(), state))
+		step.Cleanup(state)
+
+		assert.Equal(t, 1, inner.runs)
+		assert.Equal(t, 1, inner.cleanups)
+	})
+
+	t.Run("continues without running or cleaning up the step on a hit", func(t *testing.T) {
+		inner := &countingStep{}
+		step := &skipOnBuildCacheHit{Step: inner}
+		state := new(multistep.BasicStateBag)
+		state.Put("build_cache_hit", buildCacheRecord{VMName: "foo-cached"})
+
+		assert.Equal(t, multistep.ActionContinue, step.Run(context.Background(), state))
+		step.Cleanup(state)
+
+		assert.Equal(t, 0, inner.runs)
+		assert.Equal(t, 0, inner.cleanups)
+	})
+}
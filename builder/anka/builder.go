@@ -3,8 +3,6 @@ package anka
 import (
 	"context"
 	"errors"
-	"fmt"
-	"log"
 
 	"github.com/hashicorp/hcl/v2/hcldec"
 	"github.com/hashicorp/packer-plugin-sdk/communicator"
@@ -27,14 +25,20 @@ type Builder struct {
 
 // Prepare processes the build configuration parameters.
 func (b *Builder) Prepare(raws ...interface{}) ([]string, []string, error) {
-	generatedData := []string{"VMName", "OSVersion", "DarwinVersion"}
-
 	c, errs := NewConfig(raws...)
 	if errs != nil {
 		return nil, nil, errs
 	}
 	b.config = c
 
+	generatedData := append([]string{}, generatedDataNames...)
+	for _, rule := range c.PortForwardingRules {
+		generatedData = append(generatedData, portForwardGeneratedDataName(rule.PortForwardingRuleName))
+	}
+	for name := range c.GeneratedDataCommands {
+		generatedData = append(generatedData, name)
+	}
+
 	return generatedData, nil, nil
 }
 
@@ -54,6 +58,10 @@ func (b *Builder) Run(ctx context.Context, ui packer.Ui, hook packer.Hook) (pack
 	generatedData := &packerbuilderdata.GeneratedData{State: state}
 
 	steps := []multistep.Step{
+		&StepHostLocks{},
+		&StepPreflight{},
+		&StepCleanupOrphanedVMs{},
+		&StepCheckHostResources{},
 		&StepTempDir{},
 	}
 
@@ -66,7 +74,8 @@ func (b *Builder) Run(ctx context.Context, ui packer.Ui, hook packer.Hook) (pack
 		return nil, errors.New("wrong type for builder. must be of type clone or create")
 	}
 
-	steps = append(steps,
+	// Nothing else runs on a build cache hit
+	for _, step := range []multistep.Step{
 		&StepStartVM{},
 		&communicator.StepConnect{
 			Config: &b.config.Comm,
@@ -81,7 +90,14 @@ func (b *Builder) Run(ctx context.Context, ui packer.Ui, hook packer.Hook) (pack
 			GeneratedData: generatedData,
 		},
 		&commonsteps.StepProvision{},
-	)
+		&StepSetGeneratedData{
+			GeneratedData: generatedData,
+		},
+		&StepDetachDrives{},
+		&StepSetFinalState{},
+	} {
+		steps = append(steps, &skipOnBuildCacheHit{Step: step})
+	}
 
 	// Run!
 	b.runner = commonsteps.NewRunner(steps, b.config.PackerConfig, ui)
@@ -99,43 +115,39 @@ func (b *Builder) Run(ctx context.Context, ui packer.Ui, hook packer.Hook) (pack
 		return nil, nil
 	}
 
+	// An earlier build from the same inputs is the artifact
+	if rawHit, ok := state.GetOk("build_cache_hit"); ok {
+		return buildCacheArtifact(ankaClient, rawHit.(buildCacheRecord))
+	}
+
 	// Check we can describe the VM
 	descr, err := ankaClient.Describe(state.Get("vm_name").(string))
 	if err != nil {
 		return nil, err
 	}
 
-	license, err := ankaClient.License()
-	if err != nil {
-		return nil, err
+	stateData := map[string]interface{}{
+		"generated_data": generatedData.State.Get("generated_data"),
+		"hard_drives":    descr.HardDrives,
+		"optical_drives": descr.OpticalDrives,
+		"final_state":    resolvedFinalState(state),
 	}
 
-	if license.LicenseType == "com.veertu.anka.develop" {
-		log.Printf("developer license present, can only stop vms: https://docs.veertu.com/anka/licensing/#anka-license-feature-differences")
-		b.config.StopVM = true
+	// The installer the VM was created from, so the build can be reproduced
+	if installerVersion, ok := state.GetOk("installer_version"); ok {
+		stateData["installer_version"] = installerVersion
+		stateData["installer_build"] = state.Get("installer_build")
 	}
 
-	if b.config.StopVM {
-		ui.Say(fmt.Sprintf("Stopping VM %s", descr.Name))
-
-		err := ankaClient.Stop(client.StopParams{VMName: descr.Name})
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		ui.Say(fmt.Sprintf("Suspending VM %s", descr.Name))
-
-		err := ankaClient.Suspend(client.SuspendParams{VMName: descr.Name})
-		if err != nil {
-			return nil, err
-		}
+	if fingerprint, ok := state.GetOk("build_cache_fingerprint"); ok {
+		saveBuildCacheRecord(ui, fingerprint.(string), descr.UUID, descr.Name, stateData)
 	}
 
 	// No errors, must've worked
 	return &Artifact{
 		vmId:      descr.UUID,
 		vmName:    descr.Name,
-		StateData: map[string]interface{}{"generated_data": generatedData.State.Get("generated_data")},
+		StateData: stateData,
 	}, nil
 }
 
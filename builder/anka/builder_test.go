@@ -8,7 +8,7 @@ func testConfig() map[string]interface{} {
 	return map[string]interface{}{
 		"type":          "veertu-anka-create-vm",
 		"installer": "/Applications/Install macOS Big Sur.app",
-		"disk_size":     80,
+		"disk_size":     "80G",
 		"vm_name":       "test-prepare-anka-create",
 	}
 }
@@ -1,13 +1,22 @@
-//go:generate packer-sdc mapstructure-to-hcl2 -type Config,PortForwardingRule,HostDirectoryMount
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config,PortForwardingRule,HostDirectoryMount,AdditionalDisk,OpticalDrive,OrphanedVMCleanup,RegistryRemote
 
 package anka
 
 import (
 	"errors"
+	"fmt"
+	"math"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/hashicorp/go-version"
 	"github.com/hashicorp/packer-plugin-sdk/common"
 	"github.com/hashicorp/packer-plugin-sdk/communicator"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
@@ -19,6 +28,26 @@ import (
 
 const defaultBootDelay = "7s"
 
+const defaultFinalStateTimeout = "5m"
+
+// defaultPullAttempts pulls a source that fails pull_verify once more
+const defaultPullAttempts = 2
+
+// Final states the VM can be left in once the build has finished
+const (
+	finalStateStop     = "stop"
+	finalStateSuspend  = "suspend"
+	finalStateRunning  = "running"
+	finalStateShutdown = "shutdown"
+)
+
+// How failing generated_data_commands are handled
+const (
+	generatedDataOnErrorFail   = "fail"
+	generatedDataOnErrorWarn   = "warn"
+	generatedDataOnErrorIgnore = "ignore"
+)
+
 // PortForwardingRule defines the requirements for port forwarding
 type PortForwardingRule struct {
 	PortForwardingGuestPort int    `mapstructure:"port_forwarding_guest_port"`
@@ -36,16 +65,70 @@ type Config struct {
 	AnkaUser     string `mapstructure:"anka_user"`
 	AnkaPassword string `mapstructure:"anka_password"`
 
-	Installer    string `mapstructure:"installer"`
-	SourceVMName string `mapstructure:"source_vm_name"`
-	SourceVMTag  string `mapstructure:"source_vm_tag"`
+	Installer string `mapstructure:"installer"`
+	// InstallerURL is an .ipsw downloaded into the packer cache, instead of a local installer
+	InstallerURL string `mapstructure:"installer_url"`
+	// InstallerChecksum verifies installer_url, or the installer anka lists for an installer version
+	InstallerChecksum string `mapstructure:"installer_checksum"`
+	// InstallerBuild pins an installer version or constraint to one macOS build, such as 23F79
+	InstallerBuild string `mapstructure:"installer_build"`
+	// InstallerStrict fails the build when anka lists no installer for the version, instead of
+	// warning and passing the version to anka create as is
+	InstallerStrict bool   `mapstructure:"installer_strict"`
+	SourceVMName    string `mapstructure:"source_vm_name"`
+	SourceVMTag     string `mapstructure:"source_vm_tag"`
+	// SourceVMTagFilter picks the source tag from the registry by glob, or by regular expression
+	// between slashes, instead of an exact source_vm_tag
+	SourceVMTagFilter string `mapstructure:"source_vm_tag_filter"`
+	// SourceVMTagSort orders the tags matching source_vm_tag_filter: newest, semver or date
+	SourceVMTagSort string `mapstructure:"source_vm_tag_sort"`
+	// SourceVMID pins the source to the template with this registry ID, so a local VM named
+	// source_vm_name that is a different template isn't used
+	SourceVMID string `mapstructure:"source_vm_id"`
+	// SourceVMTagID pins the source to the registry tag with this ID. A local copy at another
+	// tag is pulled again.
+	SourceVMTagID string `mapstructure:"source_vm_tag_id"`
 
 	VMName    string `mapstructure:"vm_name"`
 	DiskSize  string `mapstructure:"disk_size"`
 	RAMSize   string `mapstructure:"ram_size"`
 	VCPUCount string `mapstructure:"vcpu_count"`
 
+	// AllowDiskShrink lets vm-clone shrink the disk when disk_size is smaller than the source's.
+	AllowDiskShrink bool `mapstructure:"allow_disk_shrink"`
+
 	AlwaysFetch bool `mapstructure:"always_fetch"`
+	// FetchPolicy decides when the source is pulled: always, never, if_missing (the default)
+	// or if_newer. always_fetch is the same as always.
+	FetchPolicy string `mapstructure:"fetch_policy"`
+	// PullLocal pulls the source with anka registry pull --local, and PullShrink also passes
+	// --shrink to remove the source's other local tags
+	PullLocal  bool `mapstructure:"pull_local"`
+	PullShrink bool `mapstructure:"pull_shrink"`
+	// PullVerify compares the pulled source with the registry, and deletes and pulls it again
+	// when they differ, up to PullAttempts times
+	PullVerify   bool `mapstructure:"pull_verify"`
+	PullAttempts int  `mapstructure:"pull_attempts"`
+
+	// CloneMode is linked (the default), sharing the source's image, or full for an independent copy
+	CloneMode string `mapstructure:"clone_mode"`
+	// CreateLocalTag tags an untagged source before linked clones on Anka 3. Nil/unset defaults to true.
+	CreateLocalTag *bool `mapstructure:"create_local_tag"`
+	// LocalTag names that tag, and can use the vm_name template variables
+	LocalTag string `mapstructure:"local_tag"`
+	// LocalTagKeep prunes the oldest local tags the builder created on a source beyond this many.
+	// 0 keeps them all.
+	LocalTagKeep int `mapstructure:"local_tag_keep"`
+
+	// MinFreeDisk is extra free space (in "[0-9]+G" format) that must remain on the anka
+	// library volume on top of what the build is estimated to need.
+	MinFreeDisk string `mapstructure:"min_free_disk"`
+
+	OrphanedVMCleanup OrphanedVMCleanup `mapstructure:"orphaned_vm_cleanup"`
+
+	// LockTimeout is how long to wait for another build on the same host to release the
+	// VM name, host port or source pull this build needs.
+	LockTimeout string `mapstructure:"lock_timeout"`
 
 	UpdateAddons bool `mapstructure:"update_addons"`
 
@@ -54,9 +137,16 @@ type Config struct {
 	NodeKeyPath  string `mapstructure:"key"`
 	CaRootPath   string `mapstructure:"cacert"`
 	IsInsecure   bool   `mapstructure:"insecure"`
+	// Remotes are registries to pull the source from in order, falling back to the next
+	// when one fails its health check or the pull. Conflicts with remote and its certificates.
+	Remotes []RegistryRemote `mapstructure:"remotes"`
+	// RemoteTimeout is how long the health check of each of remotes may take
+	RemoteTimeout string `mapstructure:"remote_timeout"`
 
 	PortForwardingRules []PortForwardingRule `mapstructure:"port_forwarding_rules"`
 	HostDirectoryMounts []HostDirectoryMount `mapstructure:"host_directory_mounts"`
+	AdditionalDisks     []AdditionalDisk     `mapstructure:"additional_disks"`
+	OpticalDrives       []OpticalDrive       `mapstructure:"optical_drives"`
 
 	HWUUID            string `mapstructure:"hw_uuid,omitempty"`
 	BootDelay         string `mapstructure:"boot_delay"`
@@ -68,9 +158,28 @@ type Config struct {
 
 	StopVM bool `mapstructure:"stop_vm"`
 
+	// FinalState is the state the VM is left in after the build: stop, suspend, running or shutdown.
+	// Unset suspends the VM, or stops it when the license doesn't support suspending.
+	FinalState        string `mapstructure:"final_state"`
+	FinalStateTimeout string `mapstructure:"final_state_timeout"`
+
 	HostArch string `mapstructure:"host_arch,omitempty"`
 
+	// GeneratedDataCommands maps generated data names to shell commands run in the guest once
+	// the VM is ready and again after provisioning. Their trimmed output becomes build.<Name>.
+	GeneratedDataCommands map[string]string `mapstructure:"generated_data_commands"`
+	// GeneratedDataCommandsOnError is fail, warn or ignore.
+	GeneratedDataCommandsOnError string `mapstructure:"generated_data_commands_on_error"`
+
+	// BuildCache skips the build and returns the VM from an earlier one when nothing it was built
+	// from has changed. BuildCacheInputs lists the files (globs or directories) provisioners read,
+	// since the builder can't see them.
+	BuildCache       bool     `mapstructure:"build_cache"`
+	BuildCacheInputs []string `mapstructure:"build_cache_inputs"`
+
 	ctx interpolate.Context //nolint:structcheck
+
+	buildCacheConfigHash string
 }
 
 // NewConfig generates a machine readable config from the generic map values above
@@ -81,8 +190,13 @@ func NewConfig(raws ...interface{}) (*Config, error) {
 
 	var md mapstructure.Metadata
 	err := config.Decode(&c, &config.DecodeOpts{
-		Metadata:    &md,
-		Interpolate: true,
+		Metadata:           &md,
+		Interpolate:        true,
+		InterpolateContext: &c.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			// Rendered by the create and clone steps once installer and source details are known
+			Exclude: []string{"vm_name", "local_tag"},
+		},
 	}, raws...)
 	if err != nil {
 		return nil, err
@@ -92,6 +206,34 @@ func NewConfig(raws ...interface{}) (*Config, error) {
 		c.BootDelay = defaultBootDelay
 	}
 
+	if c.FinalStateTimeout == "" {
+		c.FinalStateTimeout = defaultFinalStateTimeout
+	}
+
+	if c.GeneratedDataCommandsOnError == "" {
+		c.GeneratedDataCommandsOnError = generatedDataOnErrorFail
+	}
+
+	if c.LockTimeout == "" {
+		c.LockTimeout = defaultLockTimeout
+	}
+
+	if c.CloneMode == "" {
+		c.CloneMode = cloneModeLinked
+	}
+
+	if c.PullVerify && c.PullAttempts == 0 {
+		c.PullAttempts = defaultPullAttempts
+	}
+
+	if len(c.Remotes) > 0 && c.RemoteTimeout == "" {
+		c.RemoteTimeout = defaultRemoteTimeout
+	}
+
+	if c.SourceVMTagFilter != "" && c.SourceVMTagSort == "" {
+		c.SourceVMTagSort = sourceTagSortNewest
+	}
+
 	if c.AnkaPassword != "" {
 		os.Setenv("ANKA_DEFAULT_PASSWD", c.AnkaPassword)
 	}
@@ -112,34 +254,274 @@ func NewConfig(raws ...interface{}) (*Config, error) {
 
 	c.HostArch = runtime.GOARCH
 
-	if c.Installer == "" && c.SourceVMName == "" {
-		errs = packer.MultiErrorAppend(errs, errors.New("installer or source_vm_name must be specified"))
+	if c.Installer == "" && c.InstallerURL == "" && c.SourceVMName == "" {
+		errs = packer.MultiErrorAppend(errs, errors.New("installer, installer_url or source_vm_name must be specified"))
 	}
 
-	if c.Installer != "" && c.SourceVMName != "" {
+	if (c.Installer != "" || c.InstallerURL != "") && c.SourceVMName != "" {
 		errs = packer.MultiErrorAppend(errs, errors.New("cannot specify both an installer and source_vm_name"))
 	}
 
+	if c.Installer != "" && c.InstallerURL != "" {
+		errs = packer.MultiErrorAppend(errs, errors.New("cannot specify both installer and installer_url"))
+	}
+
+	if c.InstallerURL != "" {
+		installerURL, err := url.Parse(c.InstallerURL)
+		switch {
+		case err != nil:
+			errs = packer.MultiErrorAppend(errs, fieldError("installer_url", "%s", err))
+		case installerURL.Scheme != "http" && installerURL.Scheme != "https":
+			errs = packer.MultiErrorAppend(errs, fieldError("installer_url", "%q must be an http or https URL", c.InstallerURL))
+		case !strings.HasSuffix(strings.ToLower(installerURL.Path), ".ipsw"):
+			errs = packer.MultiErrorAppend(errs, fieldError("installer_url", "%q must point to an .ipsw", c.InstallerURL))
+		}
+		if c.InstallerChecksum == "" {
+			errs = packer.MultiErrorAppend(errs, fieldError("installer_checksum", "is required with installer_url, set it to %q to skip verification", installerChecksumNone))
+		}
+	}
+
+	if c.Installer != "" && !isInstallerPath(c.Installer) && isInstallerConstraint(c.Installer) {
+		if _, err := version.NewConstraint(c.Installer); err != nil {
+			errs = packer.MultiErrorAppend(errs, fieldError("installer", "%q is not a version, latest or a version constraint: %s", c.Installer, err))
+		}
+	}
+
+	if c.InstallerBuild != "" && (c.Installer == "" || isInstallerPath(c.Installer)) {
+		errs = packer.MultiErrorAppend(errs, fieldError("installer_build", "only applies to an installer version or constraint"))
+	}
+
+	if c.InstallerChecksum != "" {
+		if _, err := parseInstallerChecksum(c.InstallerChecksum); err != nil {
+			errs = packer.MultiErrorAppend(errs, fieldError("installer_checksum", "%s", err))
+		}
+		if isInstallerPath(c.Installer) {
+			errs = packer.MultiErrorAppend(errs, fieldError("installer_checksum", "only applies to installer_url or an installer version"))
+		}
+	}
+
 	if c.SourceVMName != "" && strings.ContainsAny(c.SourceVMName, " \n") {
-		errs = packer.MultiErrorAppend(errs, errors.New("source_vm_name name contains spaces"))
+		errs = packer.MultiErrorAppend(errs, fieldError("source_vm_name", "name contains spaces"))
+	}
+
+	if c.SourceVMTagFilter != "" {
+		if c.SourceVMTag != "" {
+			errs = packer.MultiErrorAppend(errs, fieldError("source_vm_tag_filter", "conflicts with source_vm_tag"))
+		}
+		if _, err := newSourceTagMatcher(c.SourceVMTagFilter); err != nil {
+			errs = packer.MultiErrorAppend(errs, fieldError("source_vm_tag_filter", "%s", err))
+		}
+		if !containsString(validSourceTagSorts, c.SourceVMTagSort) {
+			errs = packer.MultiErrorAppend(errs, fieldError("source_vm_tag_sort", "%q must be one of %s", c.SourceVMTagSort, strings.Join(validSourceTagSorts, ", ")))
+		}
+	} else if c.SourceVMTagSort != "" {
+		errs = packer.MultiErrorAppend(errs, fieldError("source_vm_tag_sort", "only applies with source_vm_tag_filter"))
+	}
+
+	if c.FetchPolicy != "" {
+		if !containsString(validFetchPolicies, c.FetchPolicy) {
+			errs = packer.MultiErrorAppend(errs, fieldError("fetch_policy", "%q must be one of %s", c.FetchPolicy, strings.Join(validFetchPolicies, ", ")))
+		} else if c.AlwaysFetch && c.FetchPolicy != fetchPolicyAlways {
+			errs = packer.MultiErrorAppend(errs, fieldError("fetch_policy", "conflicts with always_fetch"))
+		}
 	}
 
-	if len(c.PortForwardingRules) > 0 {
-		for index, rule := range c.PortForwardingRules {
-			if rule.PortForwardingGuestPort == 0 {
-				errs = packer.MultiErrorAppend(errs, errors.New("guest port is required"))
+	if !containsString(validCloneModes, c.CloneMode) {
+		errs = packer.MultiErrorAppend(errs, fieldError("clone_mode", "%q must be one of %s", c.CloneMode, strings.Join(validCloneModes, ", ")))
+	}
+
+	if c.LocalTag != "" || c.LocalTagKeep != 0 {
+		if !c.shouldCreateLocalTag() {
+			errs = packer.MultiErrorAppend(errs, fieldError("local_tag", "only applies when create_local_tag is enabled and clone_mode is %s", cloneModeLinked))
+		}
+		if c.LocalTag != "" {
+			if err := validateNameTemplate(&c, c.LocalTag); err != nil {
+				errs = packer.MultiErrorAppend(errs, fieldError("local_tag", "%s", err))
 			}
-			if rule.PortForwardingRuleName == "" {
-				c.PortForwardingRules[index].PortForwardingRuleName = util.RandSeq(10)
+		}
+		if c.LocalTagKeep < 0 {
+			errs = packer.MultiErrorAppend(errs, fieldError("local_tag_keep", "%d must not be negative", c.LocalTagKeep))
+		}
+	}
+
+	if c.PullShrink && !c.PullLocal {
+		errs = packer.MultiErrorAppend(errs, fieldError("pull_shrink", "requires pull_local"))
+	}
+
+	if c.PullVerify && c.PullAttempts < 1 {
+		errs = packer.MultiErrorAppend(errs, fieldError("pull_attempts", "%d must be at least 1", c.PullAttempts))
+	} else if !c.PullVerify && c.PullAttempts != 0 {
+		errs = packer.MultiErrorAppend(errs, fieldError("pull_attempts", "only applies with pull_verify"))
+	}
+
+	if c.SourceVMID != "" && strings.ContainsAny(c.SourceVMID, " \n") {
+		errs = packer.MultiErrorAppend(errs, fieldError("source_vm_id", "id contains spaces"))
+	}
+
+	if c.SourceVMTagID != "" {
+		if strings.ContainsAny(c.SourceVMTagID, " \n") {
+			errs = packer.MultiErrorAppend(errs, fieldError("source_vm_tag_id", "id contains spaces"))
+		}
+		if c.SourceVMTagFilter != "" {
+			errs = packer.MultiErrorAppend(errs, fieldError("source_vm_tag_id", "conflicts with source_vm_tag_filter"))
+		}
+	}
+
+	if c.VMName != "" {
+		if err := validateVMNameTemplate(&c); err != nil {
+			errs = packer.MultiErrorAppend(errs, fieldError("vm_name", "%s", err))
+		}
+	}
+
+	if c.DiskSize != "" {
+		diskSize := c.DiskSize
+		if isRelativeDiskSize(diskSize) {
+			if c.Installer != "" || c.InstallerURL != "" {
+				errs = packer.MultiErrorAppend(errs, fieldError("disk_size", "can only be relative to the source VM when cloning"))
 			}
+			diskSize = strings.TrimPrefix(diskSize, "+")
+		}
+		if _, err := util.ConvertDiskSizeToBytes(diskSize); err != nil {
+			errs = packer.MultiErrorAppend(errs, fieldError("disk_size", "%q must be in [0-9]+G or [0-9]+M format (or +[0-9]+G when cloning)", c.DiskSize))
 		}
 	}
 
-	if len(c.HostDirectoryMounts) > 0 {
-		for _, hostDirectoryMount := range c.HostDirectoryMounts {
-			if hostDirectoryMount.HostPath == "" {
-				errs = packer.MultiErrorAppend(errs, errors.New("host_path is required for host_directory_mounts"))
+	if c.RAMSize != "" {
+		if isRelativeRAMSize(c.RAMSize) {
+			if _, err := parsePercentage(c.RAMSize); err != nil {
+				errs = packer.MultiErrorAppend(errs, fieldError("ram_size", "%s", err))
 			}
+		} else if !sizePattern.MatchString(c.RAMSize) {
+			errs = packer.MultiErrorAppend(errs, fieldError("ram_size", "%q must be in [0-9]+G or [0-9]+M format, or a percentage of host memory", c.RAMSize))
+		}
+	}
+
+	if c.MinFreeDisk != "" && !sizePattern.MatchString(c.MinFreeDisk) {
+		errs = packer.MultiErrorAppend(errs, fieldError("min_free_disk", "%q must be in [0-9]+G or [0-9]+M format", c.MinFreeDisk))
+	}
+
+	if c.VCPUCount != "" {
+		if err := validateVCPUCount(c.VCPUCount); err != nil {
+			errs = packer.MultiErrorAppend(errs, fieldError("vcpu_count", "%s", err))
+		}
+	}
+
+	if c.DisplayController != "" && !containsString(validDisplayControllers, c.DisplayController) {
+		errs = packer.MultiErrorAppend(errs, fieldError("display_controller", "%q must be one of %s", c.DisplayController, strings.Join(validDisplayControllers, ", ")))
+	}
+
+	if c.HWUUID != "" && !hwUUIDPattern.MatchString(c.HWUUID) {
+		errs = packer.MultiErrorAppend(errs, fieldError("hw_uuid", "%q is not a UUID (generate one with uuidgen)", c.HWUUID))
+	}
+
+	if _, err := time.ParseDuration(c.BootDelay); err != nil {
+		errs = packer.MultiErrorAppend(errs, fieldError("boot_delay", "%s", err))
+	}
+
+	if c.AnkaLogLevel != "" && !containsString(validLogLevels, c.AnkaLogLevel) {
+		errs = packer.MultiErrorAppend(errs, fieldError("log_level", "%q must be one of %s", c.AnkaLogLevel, strings.Join(validLogLevels, ", ")))
+	}
+
+	if c.FinalState != "" && !containsString(validFinalStates, c.FinalState) {
+		errs = packer.MultiErrorAppend(errs, fieldError("final_state", "%q must be one of %s", c.FinalState, strings.Join(validFinalStates, ", ")))
+	}
+
+	if c.StopVM {
+		if c.FinalState == "" {
+			c.FinalState = finalStateStop
+		} else if c.FinalState != finalStateStop {
+			errs = packer.MultiErrorAppend(errs, fieldError("final_state", "%q conflicts with stop_vm", c.FinalState))
+		}
+	}
+
+	if timeout, err := time.ParseDuration(c.FinalStateTimeout); err != nil {
+		errs = packer.MultiErrorAppend(errs, fieldError("final_state_timeout", "%s", err))
+	} else if timeout <= 0 {
+		errs = packer.MultiErrorAppend(errs, fieldError("final_state_timeout", "%q must be greater than 0", c.FinalStateTimeout))
+	}
+
+	if timeout, err := time.ParseDuration(c.LockTimeout); err != nil {
+		errs = packer.MultiErrorAppend(errs, fieldError("lock_timeout", "%s", err))
+	} else if timeout < 0 {
+		errs = packer.MultiErrorAppend(errs, fieldError("lock_timeout", "%q must not be negative", c.LockTimeout))
+	}
+
+	if !containsString(validGeneratedDataOnErrors, c.GeneratedDataCommandsOnError) {
+		errs = packer.MultiErrorAppend(errs, fieldError("generated_data_commands_on_error", "%q must be one of %s", c.GeneratedDataCommandsOnError, strings.Join(validGeneratedDataOnErrors, ", ")))
+	}
+
+	for name, command := range c.GeneratedDataCommands {
+		field := fmt.Sprintf("generated_data_commands[%q]", name)
+		switch {
+		case !generatedDataNamePattern.MatchString(name):
+			errs = packer.MultiErrorAppend(errs, fieldError(field, "name must start with a letter and contain only letters, digits and underscores"))
+		case containsString(generatedDataNames, name) || strings.HasPrefix(name, portForwardGeneratedDataName("")):
+			errs = packer.MultiErrorAppend(errs, fieldError(field, "name is already used by the builder's own generated data"))
+		}
+		if strings.TrimSpace(command) == "" {
+			errs = packer.MultiErrorAppend(errs, fieldError(field, "command is required"))
+		}
+	}
+
+	errs = packer.MultiErrorAppend(errs, validateOrphanedVMCleanup(&c.OrphanedVMCleanup)...)
+	errs = packer.MultiErrorAppend(errs, validateRegistryRemotes(&c)...)
+
+	if c.BuildCache {
+		for index, pattern := range c.BuildCacheInputs {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				errs = packer.MultiErrorAppend(errs, fieldError(fmt.Sprintf("build_cache_inputs[%d]", index), "%q is not a valid pattern", pattern))
+			}
+		}
+
+		c.buildCacheConfigHash, err = buildCacheConfigHash(raws...)
+		if err != nil {
+			errs = packer.MultiErrorAppend(errs, fieldError("build_cache", "failed to fingerprint the configuration: %s", err))
+		}
+	} else if len(c.BuildCacheInputs) > 0 {
+		errs = packer.MultiErrorAppend(errs, fieldError("build_cache_inputs", "only applies with build_cache"))
+	}
+
+	for index, rule := range c.PortForwardingRules {
+		if rule.PortForwardingGuestPort == 0 {
+			errs = packer.MultiErrorAppend(errs, fieldError(fmt.Sprintf("port_forwarding_rules[%d].port_forwarding_guest_port", index), "guest port is required"))
+		} else if rule.PortForwardingGuestPort < 0 || rule.PortForwardingGuestPort > 65535 {
+			errs = packer.MultiErrorAppend(errs, fieldError(fmt.Sprintf("port_forwarding_rules[%d].port_forwarding_guest_port", index), "%d is not a valid port", rule.PortForwardingGuestPort))
+		}
+		if rule.PortForwardingHostPort < 0 || rule.PortForwardingHostPort > 65535 {
+			errs = packer.MultiErrorAppend(errs, fieldError(fmt.Sprintf("port_forwarding_rules[%d].port_forwarding_host_port", index), "%d is not a valid port", rule.PortForwardingHostPort))
+		}
+		// Named after the guest port so the PortForward_<rule_name> generated data is predictable.
+		// Anka only forwards tcp.
+		if rule.PortForwardingRuleName == "" {
+			c.PortForwardingRules[index].PortForwardingRuleName = fmt.Sprintf("%d-tcp", rule.PortForwardingGuestPort)
+		}
+	}
+
+	ruleNames := map[string]bool{}
+	for index, rule := range c.PortForwardingRules {
+		if ruleNames[rule.PortForwardingRuleName] {
+			errs = packer.MultiErrorAppend(errs, fieldError(fmt.Sprintf("port_forwarding_rules[%d].port_forwarding_rule_name", index), "%q is used by another rule", rule.PortForwardingRuleName))
+		}
+		ruleNames[rule.PortForwardingRuleName] = true
+	}
+
+	for index, hostDirectoryMount := range c.HostDirectoryMounts {
+		if hostDirectoryMount.HostPath == "" {
+			errs = packer.MultiErrorAppend(errs, fieldError(fmt.Sprintf("host_directory_mounts[%d].host_path", index), "host_path is required for host_directory_mounts"))
+		}
+	}
+
+	for index, additionalDisk := range c.AdditionalDisks {
+		if additionalDisk.Size == "" {
+			errs = packer.MultiErrorAppend(errs, fieldError(fmt.Sprintf("additional_disks[%d].size", index), "size is required for additional_disks"))
+		} else if _, err := util.ConvertDiskSizeToBytes(additionalDisk.Size); err != nil {
+			errs = packer.MultiErrorAppend(errs, fieldError(fmt.Sprintf("additional_disks[%d].size", index), "%q must be in [0-9]+G or [0-9]+M format", additionalDisk.Size))
+		}
+	}
+
+	for index, opticalDrive := range c.OpticalDrives {
+		if opticalDrive.Path == "" {
+			errs = packer.MultiErrorAppend(errs, fieldError(fmt.Sprintf("optical_drives[%d].path", index), "path is required for optical_drives"))
 		}
 	}
 
@@ -150,6 +532,83 @@ func NewConfig(raws ...interface{}) (*Config, error) {
 	return &c, nil
 }
 
+var (
+	sizePattern             = regexp.MustCompile("^[0-9]+[gGmM]$")
+	hwUUIDPattern           = regexp.MustCompile("^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$")
+	validDisplayControllers = []string{"fbuf", "pg"}
+	validLogLevels          = []string{"debug"}
+	validFinalStates        = []string{finalStateStop, finalStateSuspend, finalStateRunning, finalStateShutdown}
+
+	validGeneratedDataOnErrors = []string{generatedDataOnErrorFail, generatedDataOnErrorWarn, generatedDataOnErrorIgnore}
+	generatedDataNamePattern   = regexp.MustCompile("^[A-Za-z][A-Za-z0-9_]*$")
+)
+
+// fieldError prefixes a validation error with the config field path it applies to
+func fieldError(field string, format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...))
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// validateVCPUCount accepts a positive count or one of the host relative expressions
+// understood by resolveVCPUCount (host, host-N, N%).
+func validateVCPUCount(vcpuCount string) error {
+	if count, err := strconv.Atoi(vcpuCount); err == nil {
+		if count < 1 {
+			return fmt.Errorf("%q must be at least 1", vcpuCount)
+		}
+		return nil
+	}
+
+	if !isRelativeVCPUCount(vcpuCount) {
+		return fmt.Errorf("%q must be a number, host, host-N or a percentage", vcpuCount)
+	}
+
+	// The syntax is the same whatever the host looks like
+	_, err := resolveVCPUCount(vcpuCount, math.MaxInt32)
+	if err != nil {
+		return errors.New(strings.TrimPrefix(err.Error(), "vcpu_count: "))
+	}
+	return nil
+}
+
+// validateOrphanedVMCleanup requires explicit patterns that can't match every VM on the host
+func validateOrphanedVMCleanup(cleanup *OrphanedVMCleanup) []error {
+	var errs []error
+
+	if len(cleanup.Patterns) == 0 {
+		if cleanup.OlderThan != "" || cleanup.Force || cleanup.DryRun {
+			errs = append(errs, fieldError("orphaned_vm_cleanup.patterns", "at least one pattern is required"))
+		}
+		return errs
+	}
+
+	for index, pattern := range cleanup.Patterns {
+		field := fmt.Sprintf("orphaned_vm_cleanup.patterns[%d]", index)
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fieldError(field, "%q is not a valid pattern: %s", pattern, err))
+		} else if strings.Trim(pattern, "*?") == "" {
+			errs = append(errs, fieldError(field, "%q would match every VM, include part of the name such as anka-packer-base-*", pattern))
+		}
+	}
+
+	if cleanup.OlderThan == "" {
+		cleanup.OlderThan = defaultOrphanedVMCleanupOlderThan
+	}
+	if _, err := time.ParseDuration(cleanup.OlderThan); err != nil {
+		errs = append(errs, fieldError("orphaned_vm_cleanup.older_than", "%s", err))
+	}
+
+	return errs
+}
+
 func (c *Config) shouldWaitForGuestNetworking() bool {
 	if c.WaitForNetworking == nil {
 		return true
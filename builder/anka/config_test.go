@@ -0,0 +1,216 @@
+package anka
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func cloneTestConfig(overrides map[string]interface{}) map[string]interface{} {
+	raw := map[string]interface{}{
+		"type":           "veertu-anka-vm-clone",
+		"source_vm_name": "source",
+		"vm_name":        "test-config",
+	}
+	for key, value := range overrides {
+		raw[key] = value
+	}
+	return raw
+}
+
+func TestNewConfigValid(t *testing.T) {
+	config, err := NewConfig(cloneTestConfig(map[string]interface{}{
+		"disk_size":          "+20G",
+		"ram_size":           "50%",
+		"vcpu_count":         "host-2",
+		"display_controller": "pg",
+		"hw_uuid":            "2CD9F4A6-1D0B-4B5C-9E1F-6A2B9F8C3D41",
+		"boot_delay":         "10s",
+		"log_level":          "debug",
+		"port_forwarding_rules": []map[string]interface{}{
+			{"port_forwarding_guest_port": 22, "port_forwarding_host_port": 2222},
+		},
+		"additional_disks": []map[string]interface{}{
+			{"size": "10G"},
+		},
+	}))
+
+	assert.NilError(t, err)
+	assert.Equal(t, "22-tcp", config.PortForwardingRules[0].PortForwardingRuleName)
+}
+
+func TestNewConfigValidation(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		overrides map[string]interface{}
+		expected  string
+	}{
+		{"disk_size format", map[string]interface{}{"disk_size": "80"}, `disk_size: "80" must be in [0-9]+G or [0-9]+M format`},
+		{"ram_size format", map[string]interface{}{"ram_size": "8GB"}, `ram_size: "8GB" must be in [0-9]+G or [0-9]+M format`},
+		{"ram_size percentage", map[string]interface{}{"ram_size": "120%"}, `ram_size: "120%" is not a percentage between 1% and 100%`},
+		{"vcpu_count zero", map[string]interface{}{"vcpu_count": "0"}, `vcpu_count: "0" must be at least 1`},
+		{"vcpu_count expression", map[string]interface{}{"vcpu_count": "lots"}, `vcpu_count: "lots" must be a number, host, host-N or a percentage`},
+		{"display_controller", map[string]interface{}{"display_controller": "vga"}, `display_controller: "vga" must be one of fbuf, pg`},
+		{"hw_uuid", map[string]interface{}{"hw_uuid": "abcdefgh"}, `hw_uuid: "abcdefgh" is not a UUID`},
+		{"boot_delay", map[string]interface{}{"boot_delay": "10"}, `boot_delay: time: missing unit in duration "10"`},
+		{"log_level", map[string]interface{}{"log_level": "trace"}, `log_level: "trace" must be one of debug`},
+		{"final_state", map[string]interface{}{"final_state": "paused"}, `final_state: "paused" must be one of stop, suspend, running, shutdown`},
+		{"final_state with stop_vm", map[string]interface{}{"stop_vm": true, "final_state": "running"}, `final_state: "running" conflicts with stop_vm`},
+		{"final_state_timeout", map[string]interface{}{"final_state_timeout": "0s"}, `final_state_timeout: "0s" must be greater than 0`},
+		{"lock_timeout", map[string]interface{}{"lock_timeout": "-1m"}, `lock_timeout: "-1m" must not be negative`},
+		{"vm_name characters", map[string]interface{}{"vm_name": "my vm"}, `vm_name: "my vm" must start with a letter or digit`},
+		{"vm_name template field", map[string]interface{}{"vm_name": "team-{{ .Flavor }}"}, `can't evaluate field Flavor in type anka.vmNameData`},
+		{"installer_url scheme", map[string]interface{}{"source_vm_name": "", "installer_url": "ftp://example.com/macos.ipsw", "installer_checksum": "none"}, `installer_url: "ftp://example.com/macos.ipsw" must be an http or https URL`},
+		{"installer_url extension", map[string]interface{}{"source_vm_name": "", "installer_url": "https://example.com/macos.dmg", "installer_checksum": "none"}, `installer_url: "https://example.com/macos.dmg" must point to an .ipsw`},
+		{"installer_url checksum", map[string]interface{}{"source_vm_name": "", "installer_url": "https://example.com/macos.ipsw"}, `installer_checksum: is required with installer_url, set it to "none" to skip verification`},
+		{"installer_url with installer", map[string]interface{}{"source_vm_name": "", "installer": "latest", "installer_url": "https://example.com/macos.ipsw", "installer_checksum": "none"}, `cannot specify both installer and installer_url`},
+		{"installer_checksum format", map[string]interface{}{"source_vm_name": "", "installer": "latest", "installer_checksum": "md5:abc"}, `installer_checksum: "md5" is not a supported checksum type`},
+		{"installer_checksum with local installer", map[string]interface{}{"source_vm_name": "", "installer": "/Applications/Install macOS Big Sur.app", "installer_checksum": "none"}, `installer_checksum: only applies to installer_url or an installer version`},
+		{"installer constraint", map[string]interface{}{"source_vm_name": "", "installer": ">= fifteen"}, `installer: ">= fifteen" is not a version, latest or a version constraint`},
+		{"installer_build with local installer", map[string]interface{}{"source_vm_name": "", "installer": "/Applications/Install macOS Sonoma.app", "installer_build": "23A344"}, `installer_build: only applies to an installer version or constraint`},
+		{"source_vm_tag_filter with source_vm_tag", map[string]interface{}{"source_vm_tag": "v1", "source_vm_tag_filter": "v*"}, `source_vm_tag_filter: conflicts with source_vm_tag`},
+		{"source_vm_tag_filter glob", map[string]interface{}{"source_vm_tag_filter": "v[1"}, `source_vm_tag_filter: "v[1" is not a valid glob`},
+		{"source_vm_tag_filter regex", map[string]interface{}{"source_vm_tag_filter": "/v(/"}, "source_vm_tag_filter: error parsing regexp"},
+		{"source_vm_tag_sort", map[string]interface{}{"source_vm_tag_filter": "v*", "source_vm_tag_sort": "oldest"}, `source_vm_tag_sort: "oldest" must be one of newest, semver, date`},
+		{"source_vm_tag_sort without filter", map[string]interface{}{"source_vm_tag_sort": "date"}, `source_vm_tag_sort: only applies with source_vm_tag_filter`},
+		{"source_vm_id spaces", map[string]interface{}{"source_vm_id": "1234 5678"}, `source_vm_id: id contains spaces`},
+		{"source_vm_tag_id with source_vm_tag_filter", map[string]interface{}{"source_vm_tag_id": "img-1", "source_vm_tag_filter": "v*"}, `source_vm_tag_id: conflicts with source_vm_tag_filter`},
+		{"remotes with remote", map[string]interface{}{"remote": "primary", "remotes": []map[string]interface{}{{"remote": "mirror"}}}, `remotes: conflicts with remote, cert, key, cacert and insecure`},
+		{"remotes remote", map[string]interface{}{"remotes": []map[string]interface{}{{"cert": "/certs/node.pem"}}}, `remotes[0].remote: is required`},
+		{"remotes URL", map[string]interface{}{"remotes": []map[string]interface{}{{"remote": "ftp://mirror.example.com"}}}, `remotes[0].remote: "ftp://mirror.example.com" must be an http or https URL`},
+		{"remotes duplicate", map[string]interface{}{"remotes": []map[string]interface{}{{"remote": "mirror"}, {"remote": "mirror"}}}, `remotes[1].remote: "mirror" is listed more than once`},
+		{"remotes key", map[string]interface{}{"remotes": []map[string]interface{}{{"remote": "mirror", "key": "/certs/node-key.pem"}}}, `remotes[0].key: requires cert`},
+		{"remote_timeout", map[string]interface{}{"remotes": []map[string]interface{}{{"remote": "mirror"}}, "remote_timeout": "0s"}, `remote_timeout: "0s" must be positive`},
+		{"remote_timeout without remotes", map[string]interface{}{"remote_timeout": "5s"}, `remote_timeout: only applies with remotes`},
+		{"fetch_policy", map[string]interface{}{"fetch_policy": "sometimes"}, `fetch_policy: "sometimes" must be one of always, never, if_missing, if_newer`},
+		{"fetch_policy with always_fetch", map[string]interface{}{"fetch_policy": "if_newer", "always_fetch": true}, `fetch_policy: conflicts with always_fetch`},
+		{"clone_mode", map[string]interface{}{"clone_mode": "thin"}, `clone_mode: "thin" must be one of linked, full`},
+		{"local_tag with clone_mode full", map[string]interface{}{"clone_mode": "full", "local_tag": "packer-{{ .Random }}"}, `local_tag: only applies when create_local_tag is enabled and clone_mode is linked`},
+		{"local_tag without create_local_tag", map[string]interface{}{"create_local_tag": false, "local_tag_keep": 3}, `local_tag: only applies when create_local_tag is enabled`},
+		{"local_tag template field", map[string]interface{}{"local_tag": "packer-{{ .Flavor }}"}, `can't evaluate field Flavor in type anka.vmNameData`},
+		{"local_tag name", map[string]interface{}{"local_tag": "my tag"}, `local_tag: "my tag" must start with a letter or digit`},
+		{"local_tag_keep", map[string]interface{}{"local_tag_keep": -1}, `local_tag_keep: -1 must not be negative`},
+		{"pull_shrink without pull_local", map[string]interface{}{"pull_shrink": true}, `pull_shrink: requires pull_local`},
+		{"pull_attempts", map[string]interface{}{"pull_verify": true, "pull_attempts": -1}, `pull_attempts: -1 must be at least 1`},
+		{"pull_attempts without pull_verify", map[string]interface{}{"pull_attempts": 3}, `pull_attempts: only applies with pull_verify`},
+		{"build_cache_inputs without build_cache", map[string]interface{}{"build_cache_inputs": []string{"scripts"}}, `build_cache_inputs: only applies with build_cache`},
+		{"build_cache_inputs pattern", map[string]interface{}{"build_cache": true, "build_cache_inputs": []string{"scripts/["}}, `build_cache_inputs[0]: "scripts/[" is not a valid pattern`},
+		{"generated_data_commands_on_error", map[string]interface{}{"generated_data_commands_on_error": "retry"}, `generated_data_commands_on_error: "retry" must be one of fail, warn, ignore`},
+		{"generated_data_commands name", map[string]interface{}{"generated_data_commands": map[string]string{"xcode-version": "xcodebuild -version"}}, `generated_data_commands["xcode-version"]: name must start with a letter`},
+		{"generated_data_commands builtin name", map[string]interface{}{"generated_data_commands": map[string]string{"OSVersion": "sw_vers"}}, `generated_data_commands["OSVersion"]: name is already used`},
+		{"generated_data_commands port name", map[string]interface{}{"generated_data_commands": map[string]string{"PortForward_ssh": "echo 22"}}, `generated_data_commands["PortForward_ssh"]: name is already used`},
+		{"generated_data_commands command", map[string]interface{}{"generated_data_commands": map[string]string{"Empty": " "}}, `generated_data_commands["Empty"]: command is required`},
+		{
+			"port forwarding guest port",
+			map[string]interface{}{"port_forwarding_rules": []map[string]interface{}{
+				{"port_forwarding_guest_port": 22},
+				{"port_forwarding_guest_port": 70000},
+			}},
+			`port_forwarding_rules[1].port_forwarding_guest_port: 70000 is not a valid port`,
+		},
+		{
+			"port forwarding host port",
+			map[string]interface{}{"port_forwarding_rules": []map[string]interface{}{
+				{"port_forwarding_guest_port": 22, "port_forwarding_host_port": -1},
+			}},
+			`port_forwarding_rules[0].port_forwarding_host_port: -1 is not a valid port`,
+		},
+		{
+			"port forwarding rule names",
+			map[string]interface{}{"port_forwarding_rules": []map[string]interface{}{
+				{"port_forwarding_guest_port": 22, "port_forwarding_host_port": 2222},
+				{"port_forwarding_guest_port": 22, "port_forwarding_host_port": 2223},
+			}},
+			`port_forwarding_rules[1].port_forwarding_rule_name: "22-tcp" is used by another rule`,
+		},
+		{
+			"orphaned_vm_cleanup without patterns",
+			map[string]interface{}{"orphaned_vm_cleanup": map[string]interface{}{"dry_run": true}},
+			`orphaned_vm_cleanup.patterns: at least one pattern is required`,
+		},
+		{
+			"orphaned_vm_cleanup matching everything",
+			map[string]interface{}{"orphaned_vm_cleanup": map[string]interface{}{"patterns": []string{"anka-*", "*"}}},
+			`orphaned_vm_cleanup.patterns[1]: "*" would match every VM`,
+		},
+		{
+			"additional disk size",
+			map[string]interface{}{"additional_disks": []map[string]interface{}{{"size": "10"}}},
+			`additional_disks[0].size: "10" must be in [0-9]+G or [0-9]+M format`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewConfig(cloneTestConfig(tc.overrides))
+
+			assert.ErrorContains(t, err, tc.expected)
+		})
+	}
+
+	t.Run("source_vm_tag_filter sorts by newest", func(t *testing.T) {
+		c, err := NewConfig(cloneTestConfig(map[string]interface{}{"source_vm_tag_filter": "14.*"}))
+
+		assert.NilError(t, err)
+		assert.Equal(t, sourceTagSortNewest, c.SourceVMTagSort)
+	})
+
+	t.Run("remotes default remote_timeout", func(t *testing.T) {
+		c, err := NewConfig(cloneTestConfig(map[string]interface{}{"remotes": []map[string]interface{}{{"remote": "primary"}, {"remote": "https://mirror.example.com:8089", "insecure": true}}}))
+
+		assert.NilError(t, err)
+		assert.Equal(t, defaultRemoteTimeout, c.RemoteTimeout)
+		assert.DeepEqual(t, []RegistryRemote{{Remote: "primary"}, {Remote: "https://mirror.example.com:8089", IsInsecure: true}}, c.Remotes)
+	})
+
+	t.Run("pull_verify defaults pull_attempts", func(t *testing.T) {
+		c, err := NewConfig(cloneTestConfig(map[string]interface{}{"pull_verify": true}))
+
+		assert.NilError(t, err)
+		assert.Equal(t, defaultPullAttempts, c.PullAttempts)
+	})
+
+	t.Run("stop_vm sets final_state", func(t *testing.T) {
+		c, err := NewConfig(cloneTestConfig(map[string]interface{}{"stop_vm": true}))
+
+		assert.NilError(t, err)
+		assert.Equal(t, finalStateStop, c.FinalState)
+		assert.Equal(t, defaultFinalStateTimeout, c.FinalStateTimeout)
+	})
+
+	t.Run("vm_name templates are rendered at build time", func(t *testing.T) {
+		c, err := NewConfig(cloneTestConfig(map[string]interface{}{"vm_name": "team-{{ .SourceName }}-{{ .Arch }}-{{ .Timestamp }}"}))
+
+		assert.NilError(t, err)
+		assert.Equal(t, "team-{{ .SourceName }}-{{ .Arch }}-{{ .Timestamp }}", c.VMName)
+	})
+
+	t.Run("installer_url creates", func(t *testing.T) {
+		_, err := NewConfig(map[string]interface{}{
+			"installer_url":      "https://updates.cdn-apple.com/UniversalMac_14.0_23A344_Restore.ipsw?source=ci",
+			"installer_checksum": "sha256:" + strings.Repeat("0", 64),
+			"disk_size":          "+20G",
+		})
+
+		assert.ErrorContains(t, err, "disk_size: can only be relative to the source VM when cloning")
+		assert.ErrorContains(t, err, "1 error(s) occurred")
+	})
+
+	t.Run("relative disk_size when creating", func(t *testing.T) {
+		_, err := NewConfig(map[string]interface{}{
+			"installer": "/Applications/Install macOS Big Sur.app",
+			"disk_size": "+20G",
+		})
+
+		assert.ErrorContains(t, err, "disk_size: can only be relative to the source VM when cloning")
+	})
+
+	t.Run("reports every error", func(t *testing.T) {
+		_, err := NewConfig(cloneTestConfig(map[string]interface{}{
+			"disk_size":  "80",
+			"ram_size":   "8",
+			"boot_delay": "soon",
+		}))
+
+		assert.ErrorContains(t, err, "3 error(s) occurred")
+	})
+}
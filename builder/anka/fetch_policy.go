@@ -0,0 +1,62 @@
+package anka
+
+import (
+	"fmt"
+
+	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+)
+
+// When vm-clone pulls the source from the registry
+const (
+	fetchPolicyAlways    = "always"
+	fetchPolicyNever     = "never"
+	fetchPolicyIfMissing = "if_missing"
+	fetchPolicyIfNewer   = "if_newer"
+)
+
+var validFetchPolicies = []string{fetchPolicyAlways, fetchPolicyNever, fetchPolicyIfMissing, fetchPolicyIfNewer}
+
+// fetchPolicy is fetch_policy, with always_fetch meaning always and if_missing when neither is set
+func (c *Config) fetchPolicy() string {
+	if c.AlwaysFetch {
+		return fetchPolicyAlways
+	}
+	if c.FetchPolicy == "" {
+		return fetchPolicyIfMissing
+	}
+	return c.FetchPolicy
+}
+
+// registrySourceVersion is the version of the source a pull would fetch: sourceTag, or the
+// latest tag without one
+func registrySourceVersion(describe client.RegistryDescribeResponse, sourceTag string) (client.RegistryDescribeVersion, bool) {
+	var latest client.RegistryDescribeVersion
+	found := false
+
+	for _, version := range describe.Versions {
+		if sourceTag != "" {
+			if version.Tag == sourceTag {
+				return version, true
+			}
+			continue
+		}
+		if !found || version.Number > latest.Number {
+			latest = version
+			found = true
+		}
+	}
+
+	return latest, found
+}
+
+// staleSourceReason describes how a local source is behind the registry version, or returns ""
+// when it's up to date. A tag pushed again to the registry keeps its name but gets a new image.
+func staleSourceReason(local client.ShowResponse, version client.RegistryDescribeVersion) string {
+	if local.Version != version.Tag {
+		return fmt.Sprintf("local tag %q, registry has %s", local.Version, version.Tag)
+	}
+	if version.ImageID != "" && local.ImageID != "" && local.ImageID != version.ImageID {
+		return fmt.Sprintf("local image %s, registry has %s for tag %s", local.ImageID, version.ImageID, version.Tag)
+	}
+	return ""
+}
@@ -1,6 +1,158 @@
 package anka
 
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/groob/plist"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+)
+
+// guestAPFSContainerLookupShellCommand resolves the guest APFS container into APFS_CONTAINER
+// from diskutil info on the root volume, with diskutil apfs list as a fallback.
+const guestAPFSContainerLookupShellCommand = `DISKUTIL_INFO=$(diskutil info / 2>/dev/null); APFS_CONTAINER=$(echo "${DISKUTIL_INFO}" | awk '/APFS Container:/ {print $NF; exit}'); if [ -z "${APFS_CONTAINER}" ]; then APFS_CONTAINER=$(echo "${DISKUTIL_INFO}" | awk '/APFS Physical Store:/ {print $NF; exit}'); fi; if [ -z "${APFS_CONTAINER}" ]; then APFS_CONTAINER=$(diskutil apfs list 2>/dev/null | awk '/^\+-- Container / {print $3; exit}'); fi; if [ -z "${APFS_CONTAINER}" ] || ! diskutil info "${APFS_CONTAINER}" >/dev/null 2>&1; then echo "Could not determine APFS container to resize" >&2; exit 1; fi;`
+
 // guestAPFSResizeContainerShellCommand grows the guest APFS container to fill the
-// virtual disk after `anka modify set hard-drive`. The container is resolved from
-// diskutil info on the root volume, with diskutil apfs list as a fallback.
-const guestAPFSResizeContainerShellCommand = `DISKUTIL_INFO=$(diskutil info / 2>/dev/null); APFS_CONTAINER=$(echo "${DISKUTIL_INFO}" | awk '/APFS Container:/ {print $NF; exit}'); if [ -z "${APFS_CONTAINER}" ]; then APFS_CONTAINER=$(echo "${DISKUTIL_INFO}" | awk '/APFS Physical Store:/ {print $NF; exit}'); fi; if [ -z "${APFS_CONTAINER}" ]; then APFS_CONTAINER=$(diskutil apfs list 2>/dev/null | awk '/^\+-- Container / {print $3; exit}'); fi; if [ -z "${APFS_CONTAINER}" ] || ! diskutil info "${APFS_CONTAINER}" >/dev/null 2>&1; then echo "Could not determine APFS container to resize" >&2; exit 1; fi; diskutil apfs resizeContainer "${APFS_CONTAINER}" 0`
+// virtual disk after `anka modify set hard-drive`.
+const guestAPFSResizeContainerShellCommand = guestAPFSContainerLookupShellCommand + ` diskutil apfs resizeContainer "${APFS_CONTAINER}" 0`
+
+// guestDiskInfoShellCommand prints the root volume's diskutil info as a plist so the
+// APFS container size and free space can be decoded on the host.
+const guestDiskInfoShellCommand = "diskutil info -plist /"
+
+// guestDiskShrinkMinimumHeadroom is the free space (in bytes) that must remain in the APFS
+// container after shrinking so macOS can still boot and update itself.
+const guestDiskShrinkMinimumHeadroom = uint64(5 * 1024 * 1024 * 1024)
+
+// guestAPFSShrinkContainerShellCommand shrinks the guest APFS container to targetBytes ahead of
+// shrinking the virtual disk; diskutil treats the B suffix as bytes.
+func guestAPFSShrinkContainerShellCommand(targetBytes uint64) string {
+	return fmt.Sprintf(`%s diskutil apfs resizeContainer "${APFS_CONTAINER}" %dB`, guestAPFSContainerLookupShellCommand, targetBytes)
+}
+
+// guestDiskInfo holds the APFS container figures reported by `diskutil info -plist /`.
+type guestDiskInfo struct {
+	ContainerSize uint64 `plist:"APFSContainerSize"`
+	ContainerFree uint64 `plist:"APFSContainerFree"`
+}
+
+func (i guestDiskInfo) used() uint64 {
+	return i.ContainerSize - i.ContainerFree
+}
+
+func parseGuestDiskInfo(output []byte) (guestDiskInfo, error) {
+	info := guestDiskInfo{}
+
+	err := plist.Unmarshal(output, &info)
+	if err != nil {
+		return info, fmt.Errorf("failed to parse guest diskutil output: %w", err)
+	}
+	if info.ContainerSize == 0 {
+		return info, fmt.Errorf("guest diskutil output did not include the APFS container size")
+	}
+
+	return info, nil
+}
+
+// guestShrinkContainerTarget works out the APFS container size that fits in a virtual disk of
+// diskSizeBytes, keeping whatever the guest has outside the container (EFI, recovery) as-is.
+// It returns an error when the data in use plus guestDiskShrinkMinimumHeadroom wouldn't fit.
+func guestShrinkContainerTarget(info guestDiskInfo, currentDiskBytes uint64, diskSizeBytes uint64) (uint64, error) {
+	overhead := uint64(0)
+	if currentDiskBytes > info.ContainerSize {
+		overhead = currentDiskBytes - info.ContainerSize
+	}
+
+	required := info.used() + guestDiskShrinkMinimumHeadroom + overhead
+	if diskSizeBytes < required {
+		return 0, fmt.Errorf(
+			"not enough headroom to shrink the VM disk to %d bytes: %d bytes are in use, %d bytes of headroom and %d bytes outside the APFS container are required (minimum disk size: %d bytes)",
+			diskSizeBytes, info.used(), guestDiskShrinkMinimumHeadroom, overhead, required,
+		)
+	}
+
+	return diskSizeBytes - overhead, nil
+}
+
+// shrinkVMDisk shrinks the guest APFS container and then the virtual disk of vmName to diskSize.
+// Guest usage is checked first and the VM is left untouched if there isn't enough headroom. If
+// the virtual disk can't be shrunk, the container is grown back to fill it.
+// The VM is booted afterwards to make sure it still starts.
+func shrinkVMDisk(ankaClient client.Client, vmName string, diskSize string, diskSizeBytes uint64, currentDiskBytes uint64, ui packer.Ui) error {
+	stopParams := client.StopParams{
+		VMName: vmName,
+	}
+
+	ui.Say(fmt.Sprintf("Checking guest disk usage of %s before shrinking its disk to %s", vmName, diskSize))
+
+	var diskInfoOutput bytes.Buffer
+	_, err := ankaClient.Run(client.RunParams{
+		VMName:  vmName,
+		Command: []string{guestDiskInfoShellCommand},
+		Stdout:  &diskInfoOutput,
+	})
+	if err != nil {
+		return err
+	}
+
+	info, err := parseGuestDiskInfo(diskInfoOutput.Bytes())
+	if err != nil {
+		return err
+	}
+
+	targetContainerBytes, err := guestShrinkContainerTarget(info, currentDiskBytes, diskSizeBytes)
+	if err != nil {
+		stopErr := ankaClient.Stop(stopParams)
+		if stopErr != nil {
+			ui.Error(fmt.Sprint(stopErr))
+		}
+		return err
+	}
+
+	ui.Say(fmt.Sprintf("Shrinking %s APFS container to %d bytes (%d bytes in use)", vmName, targetContainerBytes, info.used()))
+
+	_, err = ankaClient.Run(client.RunParams{
+		VMName:  vmName,
+		Command: []string{guestAPFSShrinkContainerShellCommand(targetContainerBytes)},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = ankaClient.Stop(stopParams)
+	if err == nil {
+		ui.Say(fmt.Sprintf("Modifying VM %s disk size to %s", vmName, diskSize))
+
+		err = ankaClient.Modify(vmName, "set", "hard-drive", "-s", diskSize)
+	}
+	if err != nil {
+		// The virtual disk is unchanged, so grow the container back to fill it
+		ui.Say(fmt.Sprintf("Growing %s APFS container back to its full size", vmName))
+
+		_, growErr := ankaClient.Run(client.RunParams{
+			VMName:  vmName,
+			Command: []string{guestAPFSResizeContainerShellCommand},
+		})
+		if growErr == nil {
+			growErr = ankaClient.Stop(stopParams)
+		}
+		if growErr != nil {
+			ui.Error(fmt.Sprintf("Failed to grow %s APFS container back after failing to shrink its disk: %s", vmName, growErr))
+		}
+		return err
+	}
+
+	ui.Say(fmt.Sprintf("Verifying %s still boots after shrinking its disk", vmName))
+
+	_, err = ankaClient.Run(client.RunParams{
+		VMName:  vmName,
+		Command: []string{"true"},
+	})
+	if err != nil {
+		return fmt.Errorf("VM %s failed to boot after shrinking its disk: %w", vmName, err)
+	}
+
+	// Prevent 'VM is already running' error
+	return ankaClient.Stop(stopParams)
+}
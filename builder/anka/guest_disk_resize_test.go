@@ -1,9 +1,14 @@
 package anka
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
+	"github.com/golang/mock/gomock"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+	mocks "github.com/veertuinc/packer-plugin-veertu-anka/mocks"
 	"gotest.tools/v3/assert"
 )
 
@@ -14,3 +19,117 @@ func TestGuestAPFSResizeContainerShellCommand(t *testing.T) {
 	assert.Assert(t, strings.Contains(guestAPFSResizeContainerShellCommand, "/APFS Physical Store:/"))
 	assert.Assert(t, strings.Contains(guestAPFSResizeContainerShellCommand, "diskutil apfs resizeContainer"))
 }
+
+const testGuestDiskInfoPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>APFSContainerFree</key>
+	<integer>53687091200</integer>
+	<key>APFSContainerSize</key>
+	<integer>85899345920</integer>
+	<key>DeviceIdentifier</key>
+	<string>disk3s1s1</string>
+</dict>
+</plist>`
+
+func TestGuestAPFSShrinkContainerShellCommand(t *testing.T) {
+	command := guestAPFSShrinkContainerShellCommand(42949672960)
+
+	assert.Assert(t, strings.HasPrefix(command, guestAPFSContainerLookupShellCommand))
+	assert.Assert(t, strings.HasSuffix(command, `diskutil apfs resizeContainer "${APFS_CONTAINER}" 42949672960B`))
+}
+
+func TestParseGuestDiskInfo(t *testing.T) {
+	t.Run("decodes container size and free space", func(t *testing.T) {
+		info, err := parseGuestDiskInfo([]byte(testGuestDiskInfoPlist))
+
+		assert.NilError(t, err)
+		assert.Equal(t, uint64(85899345920), info.ContainerSize)
+		assert.Equal(t, uint64(53687091200), info.ContainerFree)
+		assert.Equal(t, uint64(32212254720), info.used())
+	})
+
+	t.Run("errors without container size", func(t *testing.T) {
+		_, err := parseGuestDiskInfo([]byte(`<plist version="1.0"><dict></dict></plist>`))
+
+		assert.ErrorContains(t, err, "did not include the APFS container size")
+	})
+}
+
+func TestGuestShrinkContainerTarget(t *testing.T) {
+	gib := uint64(1024 * 1024 * 1024)
+	info := guestDiskInfo{ContainerSize: 79 * gib, ContainerFree: 49 * gib}
+
+	t.Run("keeps space outside the container", func(t *testing.T) {
+		target, err := guestShrinkContainerTarget(info, 80*gib, 50*gib)
+
+		assert.NilError(t, err)
+		assert.Equal(t, 49*gib, target)
+	})
+
+	t.Run("errors without enough headroom", func(t *testing.T) {
+		_, err := guestShrinkContainerTarget(info, 80*gib, 35*gib)
+
+		assert.ErrorContains(t, err, "not enough headroom")
+	})
+}
+
+func TestShrinkVMDisk(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	ankaClient := mocks.NewMockClient(mockCtrl)
+	ui := packer.TestUi(t)
+	gib := uint64(1024 * 1024 * 1024)
+	stopParams := client.StopParams{VMName: "foo"}
+	writeDiskInfo := func(params client.RunParams) {
+		params.Stdout.Write([]byte(testGuestDiskInfoPlist))
+	}
+
+	t.Run("shrinks the container, then the disk, then boots the vm", func(t *testing.T) {
+		gomock.InOrder(
+			ankaClient.EXPECT().Run(gomock.Any()).Do(writeDiskInfo).Return(0, nil).Times(1),
+			ankaClient.EXPECT().Run(client.RunParams{
+				VMName:  "foo",
+				Command: []string{guestAPFSShrinkContainerShellCommand(50 * gib)},
+			}).Return(0, nil).Times(1),
+			ankaClient.EXPECT().Stop(stopParams).Return(nil).Times(1),
+			ankaClient.EXPECT().Modify("foo", "set", "hard-drive", "-s", "50G").Return(nil).Times(1),
+			ankaClient.EXPECT().Run(client.RunParams{VMName: "foo", Command: []string{"true"}}).Return(0, nil).Times(1),
+			ankaClient.EXPECT().Stop(stopParams).Return(nil).Times(1),
+		)
+
+		err := shrinkVMDisk(ankaClient, "foo", "50G", 50*gib, 80*gib, ui)
+
+		assert.NilError(t, err)
+	})
+
+	t.Run("leaves the vm untouched without enough headroom", func(t *testing.T) {
+		gomock.InOrder(
+			ankaClient.EXPECT().Run(gomock.Any()).Do(writeDiskInfo).Return(0, nil).Times(1),
+			ankaClient.EXPECT().Stop(stopParams).Return(nil).Times(1),
+		)
+
+		err := shrinkVMDisk(ankaClient, "foo", "30G", 30*gib, 80*gib, ui)
+
+		assert.ErrorContains(t, err, "not enough headroom")
+	})
+
+	t.Run("grows the container back when the disk can't be shrunk", func(t *testing.T) {
+		gomock.InOrder(
+			ankaClient.EXPECT().Run(gomock.Any()).Do(writeDiskInfo).Return(0, nil).Times(1),
+			ankaClient.EXPECT().Run(client.RunParams{
+				VMName:  "foo",
+				Command: []string{guestAPFSShrinkContainerShellCommand(50 * gib)},
+			}).Return(0, nil).Times(1),
+			ankaClient.EXPECT().Stop(stopParams).Return(nil).Times(1),
+			ankaClient.EXPECT().Modify("foo", "set", "hard-drive", "-s", "50G").Return(fmt.Errorf("hard drive is in use")).Times(1),
+			ankaClient.EXPECT().Run(client.RunParams{VMName: "foo", Command: []string{guestAPFSResizeContainerShellCommand}}).Return(0, nil).Times(1),
+			ankaClient.EXPECT().Stop(stopParams).Return(nil).Times(1),
+		)
+
+		err := shrinkVMDisk(ankaClient, "foo", "50G", 50*gib, 80*gib, ui)
+
+		assert.Error(t, err, "hard drive is in use")
+	})
+}
@@ -0,0 +1,221 @@
+package anka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+// Kinds of host lock, one per resource concurrent builds can fight over
+const (
+	hostLockVMName    = "vm"
+	hostLockHostPort  = "port"
+	hostLockPull      = "pull"
+	hostLockInstaller = "installer"
+)
+
+const (
+	defaultLockTimeout      = "1h"
+	defaultLockPollInterval = 2 * time.Second
+)
+
+var hostLockNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// hostLockDir is shared by every packer process run by the same user on the host
+func hostLockDir() string {
+	return filepath.Join(os.TempDir(), "packer-plugin-veertu-anka-locks")
+}
+
+// hostLocker coordinates builds on the same host with lock files created with O_EXCL that
+// contain the owner's PID. Locks left behind by processes that no longer exist are removed.
+// A nil *hostLocker doesn't lock anything.
+type hostLocker struct {
+	dir          string
+	timeout      time.Duration
+	pollInterval time.Duration
+	held         map[string]string
+}
+
+func newHostLocker(dir string, timeout time.Duration) *hostLocker {
+	return &hostLocker{
+		dir:          dir,
+		timeout:      timeout,
+		pollInterval: defaultLockPollInterval,
+		held:         map[string]string{},
+	}
+}
+
+func hostLockKey(kind string, name string) string {
+	return kind + "-" + hostLockNameUnsafe.ReplaceAllString(name, "_")
+}
+
+func (l *hostLocker) path(kind string, name string) string {
+	return filepath.Join(l.dir, hostLockKey(kind, name)+".lock")
+}
+
+// Acquire waits until the named lock is free and takes it. Taking a lock this locker
+// already holds is a no-op.
+func (l *hostLocker) Acquire(ctx context.Context, kind string, name string) error {
+	if l == nil {
+		return nil
+	}
+
+	key := hostLockKey(kind, name)
+	if _, ok := l.held[key]; ok {
+		return nil
+	}
+
+	err := os.MkdirAll(l.dir, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create lock directory %s: %w", l.dir, err)
+	}
+
+	lockPath := l.path(kind, name)
+	deadline := time.Now().Add(l.timeout)
+	waiting := false
+
+	for {
+		owner, acquired, err := l.tryAcquire(kind, name)
+		if err != nil || acquired {
+			return err
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s waiting for the %s lock on %s held by PID %d (%s)", l.timeout, kind, name, owner, lockPath)
+		}
+		if !waiting {
+			log.Printf("Waiting for the %s lock on %s held by PID %d", kind, name, owner)
+			waiting = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(l.pollInterval):
+		}
+	}
+}
+
+// tryAcquire creates the lock file, removing it first if its owner is gone. When the lock
+// is held by a live process it returns that process' PID.
+func (l *hostLocker) tryAcquire(kind string, name string) (int, bool, error) {
+	lockPath := l.path(kind, name)
+
+	for {
+		file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, err = file.WriteString(strconv.Itoa(os.Getpid()))
+			closeErr := file.Close()
+			if err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(lockPath)
+				return 0, false, fmt.Errorf("failed to write lock %s: %w", lockPath, err)
+			}
+
+			l.held[hostLockKey(kind, name)] = lockPath
+			log.Printf("Acquired %s lock on %s", kind, name)
+			return 0, true, nil
+		}
+		if !os.IsExist(err) {
+			return 0, false, fmt.Errorf("failed to create lock %s: %w", lockPath, err)
+		}
+
+		owner, alive := lockOwner(lockPath)
+		if alive {
+			return owner, false, nil
+		}
+
+		log.Printf("Removing stale %s lock on %s left by PID %d", kind, name, owner)
+		err = os.Remove(lockPath)
+		if err != nil && !os.IsNotExist(err) {
+			return 0, false, fmt.Errorf("failed to remove stale lock %s: %w", lockPath, err)
+		}
+	}
+}
+
+// Release gives up a lock held by this locker
+func (l *hostLocker) Release(kind string, name string) {
+	if l == nil {
+		return
+	}
+
+	key := hostLockKey(kind, name)
+	lockPath, ok := l.held[key]
+	if !ok {
+		return
+	}
+
+	err := os.Remove(lockPath)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to release %s lock on %s: %s", kind, name, err)
+	}
+	delete(l.held, key)
+}
+
+// ReleaseAll gives up every lock held by this locker
+func (l *hostLocker) ReleaseAll() {
+	if l == nil {
+		return
+	}
+
+	for key, lockPath := range l.held {
+		err := os.Remove(lockPath)
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to release lock %s: %s", lockPath, err)
+		}
+		delete(l.held, key)
+	}
+}
+
+// HeldByOther reports whether another live process holds the named lock
+func (l *hostLocker) HeldByOther(kind string, name string) bool {
+	if l == nil {
+		return false
+	}
+	if _, ok := l.held[hostLockKey(kind, name)]; ok {
+		return false
+	}
+
+	_, alive := lockOwner(l.path(kind, name))
+	return alive
+}
+
+// lockOwner reads the PID from a lock file and checks whether that process is still running.
+// A missing or unreadable lock counts as not alive.
+func lockOwner(lockPath string) (int, bool) {
+	content, err := os.ReadFile(lockPath)
+	if err != nil {
+		return 0, false
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil || pid <= 0 {
+		// Another process may be between creating the file and writing its PID
+		info, statErr := os.Stat(lockPath)
+		return 0, statErr == nil && time.Since(info.ModTime()) < time.Minute
+	}
+
+	err = syscall.Kill(pid, 0)
+	return pid, err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// hostLocksFrom returns the build's locker, or nil when locking isn't set up
+func hostLocksFrom(state multistep.StateBag) *hostLocker {
+	locks, ok := state.GetOk("host_locks")
+	if !ok {
+		return nil
+	}
+	return locks.(*hostLocker)
+}
@@ -0,0 +1,121 @@
+package anka
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// deadPID is above any PID the kernel hands out, so kill(2) reports ESRCH for it
+const deadPID = 2147483647
+
+func testHostLocker(t *testing.T, timeout time.Duration) *hostLocker {
+	locker := newHostLocker(t.TempDir(), timeout)
+	locker.pollInterval = 10 * time.Millisecond
+	return locker
+}
+
+func TestHostLocker(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("acquire writes the pid and release removes the lock", func(t *testing.T) {
+		locker := testHostLocker(t, time.Second)
+
+		err := locker.Acquire(ctx, hostLockVMName, "source-AbCdEfGhIj")
+		assert.NilError(t, err)
+
+		content, err := os.ReadFile(locker.path(hostLockVMName, "source-AbCdEfGhIj"))
+		assert.NilError(t, err)
+		assert.Equal(t, strconv.Itoa(os.Getpid()), string(content))
+
+		err = locker.Acquire(ctx, hostLockVMName, "source-AbCdEfGhIj")
+		assert.NilError(t, err)
+
+		locker.Release(hostLockVMName, "source-AbCdEfGhIj")
+		_, err = os.Stat(locker.path(hostLockVMName, "source-AbCdEfGhIj"))
+		assert.Assert(t, os.IsNotExist(err))
+	})
+
+	t.Run("names are sanitized", func(t *testing.T) {
+		locker := testHostLocker(t, time.Second)
+
+		err := locker.Acquire(ctx, hostLockPull, "source@v1/latest")
+		assert.NilError(t, err)
+
+		_, err = os.Stat(locker.path(hostLockPull, "source@v1/latest"))
+		assert.NilError(t, err)
+		assert.Equal(t, "pull-source_v1_latest", hostLockKey(hostLockPull, "source@v1/latest"))
+	})
+
+	t.Run("waits for a live owner and times out", func(t *testing.T) {
+		locker := testHostLocker(t, 50*time.Millisecond)
+		other := newHostLocker(locker.dir, time.Second)
+
+		err := other.Acquire(ctx, hostLockHostPort, "2222")
+		assert.NilError(t, err)
+		assert.Assert(t, locker.HeldByOther(hostLockHostPort, "2222"))
+		assert.Assert(t, !other.HeldByOther(hostLockHostPort, "2222"))
+
+		err = locker.Acquire(ctx, hostLockHostPort, "2222")
+		assert.ErrorContains(t, err, "timed out after 50ms waiting for the port lock on 2222 held by PID "+strconv.Itoa(os.Getpid()))
+	})
+
+	t.Run("acquires once the owner releases", func(t *testing.T) {
+		locker := testHostLocker(t, time.Second)
+		other := newHostLocker(locker.dir, time.Second)
+
+		err := other.Acquire(ctx, hostLockVMName, "anka-packer-base")
+		assert.NilError(t, err)
+
+		go func() {
+			time.Sleep(30 * time.Millisecond)
+			other.ReleaseAll()
+		}()
+
+		err = locker.Acquire(ctx, hostLockVMName, "anka-packer-base")
+		assert.NilError(t, err)
+	})
+
+	t.Run("stops waiting when the context is cancelled", func(t *testing.T) {
+		locker := testHostLocker(t, time.Minute)
+		other := newHostLocker(locker.dir, time.Second)
+
+		err := other.Acquire(ctx, hostLockVMName, "anka-packer-base")
+		assert.NilError(t, err)
+
+		cancelCtx, cancel := context.WithTimeout(ctx, 30*time.Millisecond)
+		defer cancel()
+
+		err = locker.Acquire(cancelCtx, hostLockVMName, "anka-packer-base")
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+
+	t.Run("removes stale locks left by dead processes", func(t *testing.T) {
+		locker := testHostLocker(t, time.Second)
+		lockPath := locker.path(hostLockVMName, "source-AbCdEfGhIj")
+
+		err := os.WriteFile(lockPath, []byte(strconv.Itoa(deadPID)), 0644)
+		assert.NilError(t, err)
+		assert.Assert(t, !locker.HeldByOther(hostLockVMName, "source-AbCdEfGhIj"))
+
+		err = locker.Acquire(ctx, hostLockVMName, "source-AbCdEfGhIj")
+		assert.NilError(t, err)
+
+		content, err := os.ReadFile(lockPath)
+		assert.NilError(t, err)
+		assert.Equal(t, strconv.Itoa(os.Getpid()), string(content))
+	})
+
+	t.Run("nil locker does nothing", func(t *testing.T) {
+		var locker *hostLocker
+
+		assert.NilError(t, locker.Acquire(ctx, hostLockVMName, "source"))
+		assert.Assert(t, !locker.HeldByOther(hostLockVMName, "source"))
+		locker.Release(hostLockVMName, "source")
+		locker.ReleaseAll()
+	})
+}
@@ -0,0 +1,255 @@
+package anka
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// installerCacheDirName is the directory under the packer cache that downloaded installers are kept in
+const installerCacheDirName = "anka-installers"
+
+// installerChecksumNone explicitly skips verifying a downloaded installer
+const installerChecksumNone = "none"
+
+// installerChecksum is a parsed installer_checksum, such as sha256:<hex>. The zero value verifies nothing.
+type installerChecksum struct {
+	Type  string
+	Value string
+}
+
+var installerChecksumLengths = map[string]int{
+	"sha256": sha256.Size * 2,
+	"sha512": sha512.Size * 2,
+}
+
+// parseInstallerChecksum accepts <type>:<hex>, or a bare sha256 or sha512 hex digest
+func parseInstallerChecksum(checksum string) (installerChecksum, error) {
+	checksum = strings.ToLower(strings.TrimSpace(checksum))
+	if checksum == "" || checksum == installerChecksumNone {
+		return installerChecksum{}, nil
+	}
+
+	parsed := installerChecksum{Value: checksum}
+	if parts := strings.SplitN(checksum, ":", 2); len(parts) == 2 {
+		parsed = installerChecksum{Type: parts[0], Value: parts[1]}
+		if _, ok := installerChecksumLengths[parsed.Type]; !ok {
+			return parsed, fmt.Errorf("%q is not a supported checksum type, use sha256 or sha512", parsed.Type)
+		}
+	} else {
+		for checksumType, length := range installerChecksumLengths {
+			if len(checksum) == length {
+				parsed.Type = checksumType
+			}
+		}
+		if parsed.Type == "" {
+			return parsed, fmt.Errorf("%q is not a sha256 or sha512 digest", checksum)
+		}
+	}
+
+	if _, err := hex.DecodeString(parsed.Value); err != nil || len(parsed.Value) != installerChecksumLengths[parsed.Type] {
+		return parsed, fmt.Errorf("%q is not a valid %s digest", parsed.Value, parsed.Type)
+	}
+
+	return parsed, nil
+}
+
+func (c installerChecksum) String() string {
+	return c.Type + ":" + c.Value
+}
+
+func (c installerChecksum) newHash() hash.Hash {
+	if c.Type == "sha512" {
+		return sha512.New()
+	}
+	return sha256.New()
+}
+
+// verify hashes the file at path and compares it with the checksum
+func (c installerChecksum) verify(path string) error {
+	if c.Type == "" {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	h := c.newHash()
+	if _, err := io.Copy(h, file); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	actual := hex.EncodeToString(h.Sum(nil))
+	if actual != c.Value {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s:%s", path, c, c.Type, actual)
+	}
+
+	return nil
+}
+
+// installerURLPath is the path of an installer_url, without any query string
+func installerURLPath(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return parsed.Path
+}
+
+// installerCache keeps downloaded installers in the packer cache. Files are named after their
+// checksum, or after the URL when there's no checksum to verify against.
+type installerCache struct {
+	dir    string
+	client *http.Client
+	locker *hostLocker
+}
+
+func newInstallerCache(locker *hostLocker) (*installerCache, error) {
+	dir, err := packer.CachePath(installerCacheDirName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the packer cache directory: %w", err)
+	}
+
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create installer cache %s: %w", dir, err)
+	}
+
+	return &installerCache{dir: dir, client: &http.Client{}, locker: locker}, nil
+}
+
+func (c *installerCache) path(installerURL string, checksum installerChecksum) string {
+	name := checksum.Type + "-" + checksum.Value
+	if checksum.Type == "" {
+		sum := sha256.Sum256([]byte(installerURL))
+		name = "url-" + hex.EncodeToString(sum[:])
+	}
+	return filepath.Join(c.dir, name+path.Ext(installerURLPath(installerURL)))
+}
+
+// Fetch returns the cached copy of the installer at installerURL, downloading it when it isn't
+// cached yet or the cached copy no longer matches the checksum. Interrupted downloads are resumed.
+func (c *installerCache) Fetch(ctx context.Context, ui packer.Ui, installerURL string, checksum installerChecksum) (string, error) {
+	cachePath := c.path(installerURL, checksum)
+
+	err := c.locker.Acquire(ctx, hostLockInstaller, filepath.Base(cachePath))
+	if err != nil {
+		return "", err
+	}
+	defer c.locker.Release(hostLockInstaller, filepath.Base(cachePath))
+
+	if _, err := os.Stat(cachePath); err == nil {
+		err = checksum.verify(cachePath)
+		if err == nil {
+			ui.Say(fmt.Sprintf("Using cached installer %s for %s", cachePath, installerURL))
+			return cachePath, nil
+		}
+
+		ui.Say(fmt.Sprintf("Downloading the installer again, the cached copy is invalid: %s", err))
+		err = os.Remove(cachePath)
+		if err != nil {
+			return "", fmt.Errorf("failed to remove invalid cached installer: %w", err)
+		}
+	}
+
+	partialPath := cachePath + ".part"
+
+	err = c.download(ctx, ui, installerURL, partialPath)
+	if err != nil {
+		return "", err
+	}
+
+	err = checksum.verify(partialPath)
+	if err != nil {
+		os.Remove(partialPath)
+		return "", fmt.Errorf("installer downloaded from %s is invalid: %w", installerURL, err)
+	}
+
+	err = os.Rename(partialPath, cachePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to move downloaded installer into the cache: %w", err)
+	}
+
+	return cachePath, nil
+}
+
+// download writes installerURL to partialPath, continuing from the end of partialPath when
+// the server supports range requests
+func (c *installerCache) download(ctx context.Context, ui packer.Ui, installerURL string, partialPath string) error {
+	var offset int64
+	if info, err := os.Stat(partialPath); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, installerURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to download installer from %s: %w", installerURL, err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download installer from %s: %w", installerURL, err)
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusOK:
+		flags |= os.O_TRUNC
+		offset = 0
+		ui.Say(fmt.Sprintf("Downloading installer from %s", installerURL))
+	case http.StatusPartialContent:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			return fmt.Errorf("failed to resume installer download from %s: unexpected Content-Range %q", installerURL, resp.Header.Get("Content-Range"))
+		}
+		flags |= os.O_APPEND
+		ui.Say(fmt.Sprintf("Resuming installer download from %s at %d bytes", installerURL, offset))
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial download is already complete, the checksum decides whether it's usable
+		if offset > 0 {
+			return nil
+		}
+		fallthrough
+	default:
+		return fmt.Errorf("failed to download installer from %s: %s", installerURL, resp.Status)
+	}
+
+	file, err := os.OpenFile(partialPath, flags, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", partialPath, err)
+	}
+	defer file.Close()
+
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+
+	body := ui.TrackProgress(path.Base(installerURLPath(installerURL)), offset, total, resp.Body)
+	defer body.Close()
+
+	_, err = io.Copy(file, body)
+	if err != nil {
+		return fmt.Errorf("failed to download installer from %s: %w", installerURL, err)
+	}
+
+	return file.Close()
+}
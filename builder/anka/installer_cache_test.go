@@ -0,0 +1,165 @@
+package anka
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"gotest.tools/v3/assert"
+)
+
+var testInstallerContent = bytes.Repeat([]byte("UniversalMac_14.0_23A344_Restore"), 1024)
+
+func testInstallerChecksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// serveTestInstaller serves content with range support and counts the requests it gets
+func serveTestInstaller(t *testing.T, content []byte) (*httptest.Server, *int32) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.ServeContent(w, r, "installer.ipsw", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func testInstallerCache(t *testing.T) *installerCache {
+	t.Setenv("PACKER_CACHE_DIR", t.TempDir())
+	cache, err := newInstallerCache(testHostLocker(t, time.Second))
+	assert.NilError(t, err)
+	return cache
+}
+
+func TestParseInstallerChecksum(t *testing.T) {
+	sha256Digest := strings.Repeat("a", 64)
+	sha512Digest := strings.Repeat("b", 128)
+
+	for checksum, expected := range map[string]installerChecksum{
+		"":                       {},
+		"none":                   {},
+		"sha256:" + sha256Digest: {Type: "sha256", Value: sha256Digest},
+		"SHA512:" + sha512Digest: {Type: "sha512", Value: sha512Digest},
+		sha256Digest:             {Type: "sha256", Value: sha256Digest},
+		sha512Digest:             {Type: "sha512", Value: sha512Digest},
+	} {
+		parsed, err := parseInstallerChecksum(checksum)
+		assert.NilError(t, err, checksum)
+		assert.Equal(t, expected, parsed, checksum)
+	}
+
+	for checksum, expected := range map[string]string{
+		"md5:" + strings.Repeat("a", 32):    `"md5" is not a supported checksum type`,
+		"sha256:" + sha512Digest:            "is not a valid sha256 digest",
+		"sha256:" + strings.Repeat("z", 64): "is not a valid sha256 digest",
+		"abcdef":                            `"abcdef" is not a sha256 or sha512 digest`,
+	} {
+		_, err := parseInstallerChecksum(checksum)
+		assert.ErrorContains(t, err, expected, checksum)
+	}
+}
+
+func TestInstallerCacheFetch(t *testing.T) {
+	ctx := context.Background()
+	ui := packer.TestUi(t)
+	checksum, err := parseInstallerChecksum(testInstallerChecksum(testInstallerContent))
+	assert.NilError(t, err)
+
+	t.Run("downloads, verifies and reuses the cached installer", func(t *testing.T) {
+		cache := testInstallerCache(t)
+		server, requests := serveTestInstaller(t, testInstallerContent)
+
+		path, err := cache.Fetch(ctx, ui, server.URL+"/UniversalMac_14.0_23A344_Restore.ipsw", checksum)
+		assert.NilError(t, err)
+		assert.Equal(t, cache.path(server.URL+"/UniversalMac_14.0_23A344_Restore.ipsw", checksum), path)
+		assert.Assert(t, strings.HasSuffix(path, "sha256-"+checksum.Value+".ipsw"))
+
+		content, err := os.ReadFile(path)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, testInstallerContent, content)
+
+		cached, err := cache.Fetch(ctx, ui, server.URL+"/UniversalMac_14.0_23A344_Restore.ipsw", checksum)
+		assert.NilError(t, err)
+		assert.Equal(t, path, cached)
+		assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+	})
+
+	t.Run("resumes partial downloads", func(t *testing.T) {
+		cache := testInstallerCache(t)
+		server, _ := serveTestInstaller(t, testInstallerContent)
+		installerURL := server.URL + "/UniversalMac_14.0_23A344_Restore.ipsw"
+
+		err := os.WriteFile(cache.path(installerURL, checksum)+".part", testInstallerContent[:1000], 0o644)
+		assert.NilError(t, err)
+
+		mockUi := &packer.MockUi{}
+		path, err := cache.Fetch(ctx, mockUi, installerURL, checksum)
+		assert.NilError(t, err)
+		assert.Equal(t, "Resuming installer download from "+installerURL+" at 1000 bytes", mockUi.SayMessages[0].Message)
+
+		content, err := os.ReadFile(path)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, testInstallerContent, content)
+	})
+
+	t.Run("replaces cached installers that no longer match", func(t *testing.T) {
+		cache := testInstallerCache(t)
+		server, requests := serveTestInstaller(t, testInstallerContent)
+		installerURL := server.URL + "/UniversalMac_14.0_23A344_Restore.ipsw"
+
+		err := os.WriteFile(cache.path(installerURL, checksum), []byte("truncated"), 0o644)
+		assert.NilError(t, err)
+
+		path, err := cache.Fetch(ctx, ui, installerURL, checksum)
+		assert.NilError(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+
+		content, err := os.ReadFile(path)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, testInstallerContent, content)
+	})
+
+	t.Run("rejects downloads that don't match the checksum", func(t *testing.T) {
+		cache := testInstallerCache(t)
+		server, _ := serveTestInstaller(t, []byte("not the installer"))
+		installerURL := server.URL + "/UniversalMac_14.0_23A344_Restore.ipsw"
+
+		_, err := cache.Fetch(ctx, ui, installerURL, checksum)
+		assert.ErrorContains(t, err, "is invalid: checksum mismatch")
+
+		_, err = os.Stat(cache.path(installerURL, checksum) + ".part")
+		assert.Assert(t, os.IsNotExist(err))
+		_, err = os.Stat(cache.path(installerURL, checksum))
+		assert.Assert(t, os.IsNotExist(err))
+	})
+
+	t.Run("caches by url without a checksum", func(t *testing.T) {
+		cache := testInstallerCache(t)
+		server, _ := serveTestInstaller(t, testInstallerContent)
+
+		path, err := cache.Fetch(ctx, ui, server.URL+"/UniversalMac_14.0_23A344_Restore.ipsw?token=abc", installerChecksum{})
+		assert.NilError(t, err)
+		assert.Assert(t, strings.Contains(path, "url-"))
+		assert.Assert(t, strings.HasSuffix(path, ".ipsw"))
+	})
+
+	t.Run("reports server errors", func(t *testing.T) {
+		cache := testInstallerCache(t)
+		server := httptest.NewServer(http.NotFoundHandler())
+		defer server.Close()
+
+		_, err := cache.Fetch(ctx, ui, server.URL+"/missing.ipsw", checksum)
+		assert.ErrorContains(t, err, "failed to download installer from "+server.URL+"/missing.ipsw: 404 Not Found")
+	})
+}
@@ -0,0 +1,74 @@
+package anka
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+)
+
+// installerLatest selects the installer anka marks as the latest
+const installerLatest = "latest"
+
+// isInstallerConstraint reports whether installer is a version constraint, such as "~> 14.5" or
+// ">= 15.0, < 16", rather than latest or an exact version
+func isInstallerConstraint(installer string) bool {
+	return strings.ContainsAny(installer, "<>=~!,")
+}
+
+// selectInstaller picks the installer anka lists for latest, an exact version or a version
+// constraint. Constraints pick the newest matching version. A non-empty build only matches
+// installers with that build.
+func selectInstaller(available []client.CreateInstallerListResponse, installer string, build string) (client.CreateInstallerListResponse, bool, error) {
+	selection := strings.TrimSpace(strings.ToLower(installer))
+
+	var constraints version.Constraints
+	if isInstallerConstraint(selection) {
+		var err error
+		constraints, err = version.NewConstraint(selection)
+		if err != nil {
+			return client.CreateInstallerListResponse{}, false, fmt.Errorf("installer %q is not a valid version constraint: %w", installer, err)
+		}
+	}
+
+	var selected client.CreateInstallerListResponse
+	var selectedVersion *version.Version
+	found := false
+
+	for _, availableInstaller := range available {
+		if build != "" && !strings.EqualFold(strings.TrimSpace(availableInstaller.Build), build) {
+			continue
+		}
+
+		availableVersion := strings.ToLower(strings.TrimSpace(availableInstaller.Version))
+
+		switch {
+		case constraints != nil:
+			parsedVersion, err := version.NewVersion(availableVersion)
+			if err != nil || !constraints.Check(parsedVersion) {
+				continue
+			}
+			if found && !parsedVersion.GreaterThan(selectedVersion) {
+				continue
+			}
+			selectedVersion = parsedVersion
+		case selection == installerLatest:
+			if !availableInstaller.Latest {
+				continue
+			}
+		default:
+			if availableVersion != selection {
+				continue
+			}
+		}
+
+		selected = availableInstaller
+		found = true
+		if constraints == nil {
+			break
+		}
+	}
+
+	return selected, found, nil
+}
@@ -0,0 +1,57 @@
+package anka
+
+import (
+	"testing"
+
+	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+	"gotest.tools/v3/assert"
+)
+
+func TestSelectInstaller(t *testing.T) {
+	available := []client.CreateInstallerListResponse{
+		{Version: "14.5", Build: "23F79"},
+		{Version: "14.6.1", Build: "23G93"},
+		{Version: "15.0", Build: "24A335"},
+		{Version: "15.1", Build: "24B83", Latest: true},
+		{Version: "15.1", Build: "24B91"},
+	}
+
+	for _, tc := range []struct {
+		installer string
+		build     string
+		expected  string
+	}{
+		{"latest", "", "24B83"},
+		{"14.5", "", "23F79"},
+		{" 15.1 ", "", "24B83"},
+		{"15.1", "24b91", "24B91"},
+		{"~> 14.5", "", "23G93"},
+		{">= 15.0, < 16", "", "24B83"},
+		{">= 15.0, < 16", "24A335", "24A335"},
+		{"< 15", "", "23G93"},
+	} {
+		selected, found, err := selectInstaller(available, tc.installer, tc.build)
+
+		assert.NilError(t, err, tc.installer)
+		assert.Assert(t, found, tc.installer)
+		assert.Equal(t, tc.expected, selected.Build, tc.installer)
+	}
+
+	for _, tc := range []struct {
+		installer string
+		build     string
+	}{
+		{"13.5", ""},
+		{"14.5", "23G93"},
+		{"~> 16.0", ""},
+		{"latest", "24A335"},
+	} {
+		_, found, err := selectInstaller(available, tc.installer, tc.build)
+
+		assert.NilError(t, err, tc.installer)
+		assert.Assert(t, !found, tc.installer)
+	}
+
+	_, _, err := selectInstaller(available, ">= fifteen", "")
+	assert.ErrorContains(t, err, `installer ">= fifteen" is not a valid version constraint`)
+}
@@ -0,0 +1,273 @@
+package anka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+	"github.com/veertuinc/packer-plugin-veertu-anka/util"
+)
+
+// How vm-clone copies the source
+const (
+	cloneModeLinked = "linked"
+	cloneModeFull   = "full"
+)
+
+var validCloneModes = []string{cloneModeLinked, cloneModeFull}
+
+// defaultLocalTag names the local tag created on an untagged source
+const defaultLocalTag = "local-tag-{{ .Random }}"
+
+// localTagCacheDirName is the directory under the packer cache that records the local tags
+// the builder created, one file per source VM
+const localTagCacheDirName = "anka-local-tags"
+
+// shouldCreateLocalTag reports whether linked clones of an untagged source tag it first.
+// Nil/unset defaults to true.
+func (c *Config) shouldCreateLocalTag() bool {
+	if c.CloneMode == cloneModeFull {
+		return false
+	}
+	if c.CreateLocalTag == nil {
+		return true
+	}
+	return *c.CreateLocalTag
+}
+
+// localTagRecord lists the local tags the builder created on one source VM, oldest first, so
+// local_tag_keep only ever prunes those. Tags created by hand are never recorded.
+type localTagRecord struct {
+	path string
+}
+
+// localTag is a local tag the builder created and the linked clones it made from it, by UUID
+type localTag struct {
+	Tag    string   `json:"tag"`
+	Clones []string `json:"clones,omitempty"`
+}
+
+func newLocalTagRecord(sourceUUID string) (*localTagRecord, error) {
+	dir, err := packer.CachePath(localTagCacheDirName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the packer cache directory: %w", err)
+	}
+
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	return &localTagRecord{path: filepath.Join(dir, sourceUUID+".json")}, nil
+}
+
+// localTagSources lists the UUIDs of the source VMs the builder recorded local tags for
+func localTagSources() ([]string, error) {
+	dir, err := packer.CachePath(localTagCacheDirName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the packer cache directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []string
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".json" {
+			sources = append(sources, strings.TrimSuffix(entry.Name(), ".json"))
+		}
+	}
+	return sources, nil
+}
+
+func (r *localTagRecord) Load() ([]localTag, error) {
+	var tags []localTag
+
+	data, err := os.ReadFile(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return tags, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &tags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", r.path, err)
+	}
+	return tags, nil
+}
+
+func (r *localTagRecord) Save(tags []localTag) error {
+	data, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, data, 0o644)
+}
+
+// localTagLock serializes builds tagging the same source and updating its record
+func localTagLock(sourceUUID string) string {
+	return fmt.Sprintf("%s@local-tag", sourceUUID)
+}
+
+// createLocalTag tags the source so linked clones share its image and returns the tag, then prunes
+// the oldest tags the builder created beyond local_tag_keep. Linked clones share the image of the
+// tag they were made from, so tags with recorded clones that still exist are kept. Failing to
+// prune only warns.
+func (s *StepCloneVM) createLocalTag(ctx context.Context, state multistep.StateBag, config *Config, sourceRef string, sourceShow client.ShowResponse) (string, error) {
+	ui := state.Get("ui").(packer.Ui)
+	ankaUtil := state.Get("util").(util.Util)
+
+	template := config.LocalTag
+	if template == "" {
+		template = defaultLocalTag
+	}
+
+	data := newVMNameData(config.HostArch, ankaUtil.RandSeq(10), time.Now())
+	data.SourceName = config.SourceVMName
+	tag, err := renderNameTemplate(config, "local_tag", template, data)
+	if err != nil {
+		return "", err
+	}
+
+	// Builds cloning the same untagged source would each tag it otherwise
+	tagLock := localTagLock(sourceShow.UUID)
+	err = hostLocksFrom(state).Acquire(ctx, hostLockPull, tagLock)
+	if err != nil {
+		return "", err
+	}
+	defer hostLocksFrom(state).Release(hostLockPull, tagLock)
+
+	ui.Say("Preparing source VM by creating a local tag (necessary in Anka 3 to optimize disk usage of clones)")
+
+	pushParams := client.RegistryPushParams{
+		Tag:      tag,
+		RemoteVM: "",
+		Local:    true,
+		Force:    false,
+		VMID:     sourceRef,
+	}
+	err = s.client.RegistryPush(client.RegistryParams{HostArch: config.HostArch}, pushParams)
+	if err != nil {
+		return "", fmt.Errorf("failed to create local tag %s on source VM %s: %w", tag, sourceRef, err)
+	}
+
+	record, err := newLocalTagRecord(sourceShow.UUID)
+	if err != nil {
+		ui.Error(fmt.Sprintf("Warning: not recording local tag %s: %s", tag, err))
+		return tag, nil
+	}
+
+	tags, err := record.Load()
+	if err != nil {
+		ui.Error(fmt.Sprintf("Warning: not recording local tag %s: %s", tag, err))
+		return tag, nil
+	}
+	tags = append(tags, localTag{Tag: tag})
+
+	if config.LocalTagKeep > 0 && len(tags) > config.LocalTagKeep {
+		tags = s.pruneLocalTags(ui, sourceRef, tags, config.LocalTagKeep)
+	}
+
+	err = record.Save(tags)
+	if err != nil {
+		ui.Error(fmt.Sprintf("Warning: failed to record local tag %s: %s", tag, err))
+	}
+
+	return tag, nil
+}
+
+// pruneLocalTags deletes the oldest tags beyond keep that no existing linked clone was recorded
+// as made from, and returns the tags left. Clones made outside the builder aren't recorded.
+func (s *StepCloneVM) pruneLocalTags(ui packer.Ui, sourceRef string, tags []localTag, keep int) []localTag {
+	vms, err := s.client.List()
+	if err != nil {
+		ui.Error(fmt.Sprintf("Warning: not pruning local tags of source VM %s, failed to list the VMs that may use them: %s", sourceRef, err))
+		return tags
+	}
+
+	existing := map[string]bool{}
+	for _, vm := range vms {
+		existing[vm.UUID] = true
+	}
+
+	var kept []localTag
+	for _, old := range tags[:len(tags)-keep] {
+		var clones []string
+		for _, clone := range old.Clones {
+			if existing[clone] {
+				clones = append(clones, clone)
+			}
+		}
+		old.Clones = clones
+
+		if len(clones) > 0 {
+			ui.Say(fmt.Sprintf("Keeping local tag %s of source VM %s, linked clones %s still use it", old.Tag, sourceRef, strings.Join(clones, ", ")))
+			kept = append(kept, old)
+			continue
+		}
+
+		ui.Say(fmt.Sprintf("Pruning local tag %s of source VM %s", old.Tag, sourceRef))
+
+		err := s.client.Delete(client.DeleteParams{VMName: sourceRef, Tag: old.Tag})
+		if err != nil {
+			ui.Error(fmt.Sprintf("Warning: failed to prune local tag %s of source VM %s: %s", old.Tag, sourceRef, err))
+			kept = append(kept, old)
+		}
+	}
+
+	return append(kept, tags[len(tags)-keep:]...)
+}
+
+// recordLocalTagClone records a linked clone made from a local tag the builder created, so
+// local_tag_keep doesn't prune the tag while the clone exists. Tags the builder didn't create
+// aren't recorded. Failing to record only warns.
+func recordLocalTagClone(ctx context.Context, state multistep.StateBag, sourceUUID string, tag string, cloneUUID string) {
+	ui := state.Get("ui").(packer.Ui)
+
+	err := hostLocksFrom(state).Acquire(ctx, hostLockPull, localTagLock(sourceUUID))
+	if err != nil {
+		ui.Error(fmt.Sprintf("Warning: not recording clone %s of local tag %s: %s", cloneUUID, tag, err))
+		return
+	}
+	defer hostLocksFrom(state).Release(hostLockPull, localTagLock(sourceUUID))
+
+	record, err := newLocalTagRecord(sourceUUID)
+	if err != nil {
+		ui.Error(fmt.Sprintf("Warning: not recording clone %s of local tag %s: %s", cloneUUID, tag, err))
+		return
+	}
+
+	tags, err := record.Load()
+	if err != nil {
+		ui.Error(fmt.Sprintf("Warning: not recording clone %s of local tag %s: %s", cloneUUID, tag, err))
+		return
+	}
+
+	for index := range tags {
+		if tags[index].Tag != tag {
+			continue
+		}
+
+		tags[index].Clones = append(tags[index].Clones, cloneUUID)
+		err = record.Save(tags)
+		if err != nil {
+			ui.Error(fmt.Sprintf("Warning: failed to record clone %s of local tag %s: %s", cloneUUID, tag, err))
+		}
+		return
+	}
+}
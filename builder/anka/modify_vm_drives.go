@@ -0,0 +1,167 @@
+package anka
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+)
+
+// AdditionalDisk defines an extra virtual hard drive attached to the VM template.
+type AdditionalDisk struct {
+	Size             string `mapstructure:"size"`
+	Controller       string `mapstructure:"controller,omitempty"`
+	DetachAfterBuild bool   `mapstructure:"detach_after_build"`
+}
+
+// OpticalDrive defines an ISO or DMG image attached to the VM template as an optical drive.
+type OpticalDrive struct {
+	Path             string `mapstructure:"path"`
+	DetachAfterBuild bool   `mapstructure:"detach_after_build"`
+}
+
+func buildAdditionalDiskFlags(additionalDisk AdditionalDisk) []string {
+	flags := []string{"-s", additionalDisk.Size}
+
+	if additionalDisk.Controller != "" {
+		flags = append(flags, "-c", additionalDisk.Controller)
+	}
+
+	return flags
+}
+
+// applyAdditionalDisks attaches the configured disks after any drives the VM already has and
+// returns the hard drive indexes that should be detached once provisioning is done.
+func applyAdditionalDisks(
+	ankaClient client.Client,
+	stopParams client.StopParams,
+	vmName string,
+	additionalDisks []AdditionalDisk,
+	ui packer.Ui,
+) ([]int, error) {
+	describeResponse, err := ankaClient.Describe(vmName)
+	if err != nil {
+		return nil, err
+	}
+
+	detachIndexes := []int{}
+	nextIndex := len(describeResponse.HardDrives)
+
+	for _, additionalDisk := range additionalDisks {
+		ui.Say(fmt.Sprintf("Adding %s hard drive (Size: %s, Detach After Build: %t)", vmName, additionalDisk.Size, additionalDisk.DetachAfterBuild))
+
+		err := ankaClient.Stop(stopParams)
+		if err != nil {
+			return nil, err
+		}
+
+		err = ankaClient.Modify(vmName, "add", "hard-drive", buildAdditionalDiskFlags(additionalDisk)...)
+		if err != nil {
+			return nil, err
+		}
+
+		if additionalDisk.DetachAfterBuild {
+			detachIndexes = append(detachIndexes, nextIndex)
+		}
+		nextIndex++
+	}
+
+	return detachIndexes, nil
+}
+
+// applyOpticalDrives attaches the configured images and returns the paths that should be
+// detached once provisioning is done.
+func applyOpticalDrives(
+	ankaClient client.Client,
+	stopParams client.StopParams,
+	vmName string,
+	opticalDrives []OpticalDrive,
+	ui packer.Ui,
+) ([]string, error) {
+	detachPaths := []string{}
+
+	for _, opticalDrive := range opticalDrives {
+		ui.Say(fmt.Sprintf("Adding %s optical drive (Path: %s, Detach After Build: %t)", vmName, opticalDrive.Path, opticalDrive.DetachAfterBuild))
+
+		err := ankaClient.Stop(stopParams)
+		if err != nil {
+			return nil, err
+		}
+
+		err = ankaClient.Modify(vmName, "add", "optical-drive", opticalDrive.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		if opticalDrive.DetachAfterBuild {
+			detachPaths = append(detachPaths, opticalDrive.Path)
+		}
+	}
+
+	return detachPaths, nil
+}
+
+// detachDrives removes the hard drives and optical drives recorded by applyAdditionalDisks and
+// applyOpticalDrives. Drives are removed from the highest index down so earlier removals don't
+// shift the indexes of the ones still to go.
+func detachDrives(
+	ankaClient client.Client,
+	vmName string,
+	hardDriveIndexes []int,
+	opticalDrivePaths []string,
+	ui packer.Ui,
+) error {
+	if len(hardDriveIndexes) == 0 && len(opticalDrivePaths) == 0 {
+		return nil
+	}
+
+	describeResponse, err := ankaClient.Describe(vmName)
+	if err != nil {
+		return err
+	}
+
+	opticalDriveIndexes := []int{}
+	for _, opticalDrivePath := range opticalDrivePaths {
+		found := false
+		for index, opticalDrive := range describeResponse.OpticalDrives {
+			if opticalDrive.File == opticalDrivePath {
+				opticalDriveIndexes = append(opticalDriveIndexes, index)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("could not find optical drive %s attached to %s", opticalDrivePath, vmName)
+		}
+	}
+
+	err = ankaClient.Stop(client.StopParams{VMName: vmName})
+	if err != nil {
+		return err
+	}
+
+	hardDriveIndexes = append([]int{}, hardDriveIndexes...)
+	sort.Sort(sort.Reverse(sort.IntSlice(hardDriveIndexes)))
+	for _, index := range hardDriveIndexes {
+		ui.Say(fmt.Sprintf("Detaching %s hard drive %d", vmName, index))
+
+		err := ankaClient.Modify(vmName, "delete", "hard-drive", strconv.Itoa(index))
+		if err != nil {
+			return err
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(opticalDriveIndexes)))
+	for _, index := range opticalDriveIndexes {
+		ui.Say(fmt.Sprintf("Detaching %s optical drive %s", vmName, describeResponse.OpticalDrives[index].File))
+
+		err := ankaClient.Modify(vmName, "delete", "optical-drive", strconv.Itoa(index))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package anka
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+	mocks "github.com/veertuinc/packer-plugin-veertu-anka/mocks"
+	"gotest.tools/v3/assert"
+)
+
+func TestBuildAdditionalDiskFlags(t *testing.T) {
+	t.Run("size only", func(t *testing.T) {
+		flags := buildAdditionalDiskFlags(AdditionalDisk{Size: "20G"})
+
+		assert.DeepEqual(t, []string{"-s", "20G"}, flags)
+	})
+
+	t.Run("size and controller", func(t *testing.T) {
+		flags := buildAdditionalDiskFlags(AdditionalDisk{Size: "20G", Controller: "sata"})
+
+		assert.DeepEqual(t, []string{"-s", "20G", "-c", "sata"}, flags)
+	})
+}
+
+func TestApplyAdditionalDisks(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	ankaClient := mocks.NewMockClient(mockCtrl)
+	ui := packer.TestUi(t)
+	stopParams := client.StopParams{VMName: "foo"}
+
+	describeResponse := client.DescribeResponse{
+		HardDrives: []client.DescribeHardDrive{{File: "foo.ank"}},
+	}
+
+	gomock.InOrder(
+		ankaClient.EXPECT().Describe("foo").Return(describeResponse, nil).Times(1),
+		ankaClient.EXPECT().Stop(stopParams).Return(nil).Times(1),
+		ankaClient.EXPECT().Modify("foo", "add", "hard-drive", "-s", "20G").Return(nil).Times(1),
+		ankaClient.EXPECT().Stop(stopParams).Return(nil).Times(1),
+		ankaClient.EXPECT().Modify("foo", "add", "hard-drive", "-s", "10G", "-c", "sata").Return(nil).Times(1),
+	)
+
+	detachIndexes, err := applyAdditionalDisks(ankaClient, stopParams, "foo", []AdditionalDisk{
+		{Size: "20G"},
+		{Size: "10G", Controller: "sata", DetachAfterBuild: true},
+	}, ui)
+
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []int{2}, detachIndexes)
+}
+
+func TestDetachDrives(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	ankaClient := mocks.NewMockClient(mockCtrl)
+	ui := packer.TestUi(t)
+
+	describeResponse := client.DescribeResponse{
+		OpticalDrives: []client.DescribeOpticalDrive{
+			{File: "/tmp/tools.iso"},
+			{File: "/tmp/installer.dmg"},
+		},
+	}
+
+	t.Run("removes highest indexes first", func(t *testing.T) {
+		gomock.InOrder(
+			ankaClient.EXPECT().Describe("foo").Return(describeResponse, nil).Times(1),
+			ankaClient.EXPECT().Stop(client.StopParams{VMName: "foo"}).Return(nil).Times(1),
+			ankaClient.EXPECT().Modify("foo", "delete", "hard-drive", "3").Return(nil).Times(1),
+			ankaClient.EXPECT().Modify("foo", "delete", "hard-drive", "1").Return(nil).Times(1),
+			ankaClient.EXPECT().Modify("foo", "delete", "optical-drive", "1").Return(nil).Times(1),
+		)
+
+		err := detachDrives(ankaClient, "foo", []int{1, 3}, []string{"/tmp/installer.dmg"}, ui)
+
+		assert.NilError(t, err)
+	})
+
+	t.Run("errors when the optical drive is no longer attached", func(t *testing.T) {
+		ankaClient.EXPECT().Describe("foo").Return(describeResponse, nil).Times(1)
+
+		err := detachDrives(ankaClient, "foo", nil, []string{"/tmp/missing.iso"}, ui)
+
+		assert.Error(t, err, "could not find optical drive /tmp/missing.iso attached to foo")
+	})
+
+	t.Run("does nothing without drives to detach", func(t *testing.T) {
+		err := detachDrives(ankaClient, "foo", nil, nil, ui)
+
+		assert.NilError(t, err)
+	})
+}
@@ -0,0 +1,117 @@
+package anka
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+)
+
+// portForwardGeneratedDataName is the generated data name a rule's host port is exposed under
+func portForwardGeneratedDataName(ruleName string) string {
+	return "PortForward_" + ruleName
+}
+
+// describedHostPorts returns hostPorts with the host port anka describes for each of its rules.
+// Anka picks the host port of a rule added with port 0 when the VM starts, and the VM keeps 0 in
+// its configuration so every clone gets its own.
+func describedHostPorts(ankaClient client.Client, vmName string, hostPorts map[string]int) (map[string]int, error) {
+	describeResponse, err := ankaClient.Describe(vmName)
+	if err != nil {
+		return nil, err
+	}
+
+	described := make(map[string]int)
+	for ruleName, hostPort := range hostPorts {
+		described[ruleName] = hostPort
+	}
+	for _, networkCard := range describeResponse.NetworkCards {
+		for _, portForwardingRule := range networkCard.PortForwardingRules {
+			if _, ok := hostPorts[portForwardingRule.RuleName]; ok && portForwardingRule.HostPort > 0 {
+				described[portForwardingRule.RuleName] = portForwardingRule.HostPort
+			}
+		}
+	}
+
+	return described, nil
+}
+
+// applyPortForwardingRules adds the rules to the VM and returns the host port of each rule by
+// rule name as anka describes it. Rules without a host port are added with 0 for anka to pick
+// one when the VM starts. A rule the VM already has under the same name, for example from the template it was cloned
+// from, is kept when it forwards the same ports and replaced otherwise.
+func applyPortForwardingRules(
+	ankaClient client.Client,
+	stopParams client.StopParams,
+	vmName string,
+	rules []PortForwardingRule,
+	packerForce bool,
+	ui packer.Ui,
+) (map[string]int, error) {
+	describeResponse, err := ankaClient.Describe(vmName)
+	if err != nil {
+		return nil, err
+	}
+
+	existingForwardedPorts := make(map[int]struct{})
+	existingRules := make(map[string]client.DescribePortForwardingRule)
+	for _, existingNetworkCard := range describeResponse.NetworkCards {
+		for _, existingPortForwardingRule := range existingNetworkCard.PortForwardingRules {
+			existingForwardedPorts[existingPortForwardingRule.HostPort] = struct{}{}
+			existingRules[existingPortForwardingRule.RuleName] = existingPortForwardingRule
+		}
+	}
+
+	requestedHostPorts := make(map[string]int)
+	for _, rule := range rules {
+		hostPort := rule.PortForwardingHostPort
+
+		ui.Say(fmt.Sprintf("Ensuring %s port-forwarding (Guest Port: %s, Host Port: %s, Rule Name: %s)", vmName, strconv.Itoa(rule.PortForwardingGuestPort), strconv.Itoa(hostPort), rule.PortForwardingRuleName))
+
+		if existingRule, ok := existingRules[rule.PortForwardingRuleName]; ok {
+			if existingRule.GuestPort == rule.PortForwardingGuestPort && (hostPort == 0 || existingRule.HostPort == hostPort) {
+				ui.Say(fmt.Sprintf("Keeping the existing port-forwarding rule %s", rule.PortForwardingRuleName))
+				requestedHostPorts[rule.PortForwardingRuleName] = existingRule.HostPort
+				continue
+			}
+
+			ui.Say(fmt.Sprintf("Replacing the existing port-forwarding rule %s (Guest Port: %d, Host Port: %d)", rule.PortForwardingRuleName, existingRule.GuestPort, existingRule.HostPort))
+
+			err = ankaClient.Stop(stopParams)
+			if err != nil {
+				return nil, err
+			}
+
+			err = ankaClient.Modify(vmName, "delete", "port-forwarding", rule.PortForwardingRuleName)
+			if !packerForce && err != nil {
+				return nil, err
+			}
+			delete(existingForwardedPorts, existingRule.HostPort)
+		}
+
+		if hostPort > 0 {
+			if _, ok := existingForwardedPorts[hostPort]; ok {
+				ui.Error(fmt.Sprintf("Found an existing host port rule (%s)! Skipping without setting...", strconv.Itoa(hostPort)))
+				requestedHostPorts[rule.PortForwardingRuleName] = hostPort
+				continue
+			}
+			existingForwardedPorts[hostPort] = struct{}{}
+		}
+
+		requestedHostPorts[rule.PortForwardingRuleName] = hostPort
+
+		err = ankaClient.Stop(stopParams)
+		if err != nil {
+			return nil, err
+		}
+
+		err = ankaClient.Modify(vmName, "add", "port-forwarding", "--host-port", strconv.Itoa(hostPort), "--guest-port", strconv.Itoa(rule.PortForwardingGuestPort), rule.PortForwardingRuleName)
+		if !packerForce && err != nil {
+			return nil, err
+		}
+	}
+
+	// Prefer what anka reports, falling back to the requested port for rules that were skipped
+	return describedHostPorts(ankaClient, vmName, requestedHostPorts)
+}
@@ -0,0 +1,82 @@
+package anka
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+	mocks "github.com/veertuinc/packer-plugin-veertu-anka/mocks"
+	"gotest.tools/v3/assert"
+)
+
+func TestApplyPortForwardingRules(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	ankaClient := mocks.NewMockClient(mockCtrl)
+	stopParams := client.StopParams{VMName: "foo"}
+
+	t.Run("leaves the host port of rules without one to anka", func(t *testing.T) {
+		rules := []PortForwardingRule{
+			{PortForwardingGuestPort: 22, PortForwardingRuleName: "ssh"},
+			{PortForwardingGuestPort: 80, PortForwardingHostPort: 8080, PortForwardingRuleName: "http"},
+		}
+		described := client.DescribeResponse{
+			NetworkCards: []client.DescribeNetworkCard{
+				{PortForwardingRules: []client.DescribePortForwardingRule{
+					{GuestPort: 22, HostPort: 0, RuleName: "ssh"},
+					{GuestPort: 80, HostPort: 8080, RuleName: "http"},
+				}},
+			},
+		}
+
+		gomock.InOrder(
+			ankaClient.EXPECT().Describe("foo").Return(client.DescribeResponse{}, nil).Times(1),
+			ankaClient.EXPECT().Stop(stopParams).Return(nil).Times(1),
+			ankaClient.EXPECT().Modify("foo", "add", "port-forwarding", "--host-port", "0", "--guest-port", "22", "ssh").Return(nil).Times(1),
+			ankaClient.EXPECT().Stop(stopParams).Return(nil).Times(1),
+			ankaClient.EXPECT().Modify("foo", "add", "port-forwarding", "--host-port", "8080", "--guest-port", "80", "http").Return(nil).Times(1),
+			ankaClient.EXPECT().Describe("foo").Return(described, nil).Times(1),
+		)
+
+		hostPorts, err := applyPortForwardingRules(ankaClient, stopParams, "foo", rules, false, packer.TestUi(t))
+		assert.NilError(t, err)
+		assert.DeepEqual(t, map[string]int{"ssh": 0, "http": 8080}, hostPorts)
+	})
+
+	t.Run("keeps or replaces rules the VM already has under the same name", func(t *testing.T) {
+		rules := []PortForwardingRule{
+			{PortForwardingGuestPort: 22, PortForwardingRuleName: "22-tcp"},
+			{PortForwardingGuestPort: 8080, PortForwardingHostPort: 8080, PortForwardingRuleName: "http"},
+		}
+		existing := client.DescribeResponse{
+			NetworkCards: []client.DescribeNetworkCard{
+				{PortForwardingRules: []client.DescribePortForwardingRule{
+					{GuestPort: 22, HostPort: 0, RuleName: "22-tcp"},
+					{GuestPort: 80, HostPort: 8080, RuleName: "http"},
+				}},
+			},
+		}
+		described := client.DescribeResponse{
+			NetworkCards: []client.DescribeNetworkCard{
+				{PortForwardingRules: []client.DescribePortForwardingRule{
+					{GuestPort: 22, HostPort: 0, RuleName: "22-tcp"},
+					{GuestPort: 8080, HostPort: 8080, RuleName: "http"},
+				}},
+			},
+		}
+
+		gomock.InOrder(
+			ankaClient.EXPECT().Describe("foo").Return(existing, nil).Times(1),
+			ankaClient.EXPECT().Stop(stopParams).Return(nil).Times(1),
+			ankaClient.EXPECT().Modify("foo", "delete", "port-forwarding", "http").Return(nil).Times(1),
+			ankaClient.EXPECT().Stop(stopParams).Return(nil).Times(1),
+			ankaClient.EXPECT().Modify("foo", "add", "port-forwarding", "--host-port", "8080", "--guest-port", "8080", "http").Return(nil).Times(1),
+			ankaClient.EXPECT().Describe("foo").Return(described, nil).Times(1),
+		)
+
+		hostPorts, err := applyPortForwardingRules(ankaClient, stopParams, "foo", rules, false, packer.TestUi(t))
+		assert.NilError(t, err)
+		assert.DeepEqual(t, map[string]int{"22-tcp": 0, "http": 8080}, hostPorts)
+	})
+}
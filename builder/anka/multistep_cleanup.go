@@ -6,10 +6,15 @@ import "github.com/hashicorp/packer-plugin-sdk/multistep"
 // `anka delete` from Cleanup. It returns false when Packer's -on-error=ask flow chose
 // "abort without cleanup" (state key "aborted" from packer-plugin-sdk commonsteps).
 // See https://github.com/veertuinc/packer-plugin-veertu-anka/issues/94
+// It also returns false once the VM is built (state key "vm_built"), so failing to reach
+// final_state doesn't throw away a provisioned template.
 func shouldDeleteAnkaTemplateAfterFailedBuild(state multistep.StateBag) bool {
 	if _, aborted := state.GetOk("aborted"); aborted {
 		return false
 	}
+	if _, built := state.GetOk("vm_built"); built {
+		return false
+	}
 	_, halted := state.GetOk(multistep.StateHalted)
 	_, canceled := state.GetOk(multistep.StateCancelled)
 	return halted || canceled
@@ -34,6 +34,13 @@ func TestShouldDeleteAnkaTemplateAfterFailedBuild(t *testing.T) {
 		assert.Assert(t, !shouldDeleteAnkaTemplateAfterFailedBuild(sb))
 	})
 
+	t.Run("built VM is kept when a later step halts", func(t *testing.T) {
+		sb := new(multistep.BasicStateBag)
+		sb.Put(multistep.StateHalted, true)
+		sb.Put("vm_built", true)
+		assert.Assert(t, !shouldDeleteAnkaTemplateAfterFailedBuild(sb))
+	})
+
 	t.Run("success path has no halt cancel so no delete from this predicate", func(t *testing.T) {
 		sb := new(multistep.BasicStateBag)
 		assert.Assert(t, !shouldDeleteAnkaTemplateAfterFailedBuild(sb))
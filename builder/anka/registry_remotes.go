@@ -0,0 +1,183 @@
+package anka
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+)
+
+const defaultRemoteTimeout = "10s"
+
+// RegistryRemote is one of the registries remotes tries in order, with its own certificates
+type RegistryRemote struct {
+	Remote       string `mapstructure:"remote"`
+	NodeCertPath string `mapstructure:"cert"`
+	NodeKeyPath  string `mapstructure:"key"`
+	CaRootPath   string `mapstructure:"cacert"`
+	IsInsecure   bool   `mapstructure:"insecure"`
+}
+
+// isRegistryURL reports whether a remote is a URL rather than the name of a remote added
+// with anka registry add
+func isRegistryURL(remote string) bool {
+	return strings.HasPrefix(remote, "http://") || strings.HasPrefix(remote, "https://")
+}
+
+// validateRegistryRemotes requires every remote to be named, and the top level registry
+// options to be left unset in favour of the ones in each remote
+func validateRegistryRemotes(c *Config) []error {
+	var errs []error
+
+	if len(c.Remotes) == 0 {
+		if c.RemoteTimeout != "" {
+			errs = append(errs, fieldError("remote_timeout", "only applies with remotes"))
+		}
+		return errs
+	}
+
+	if c.Remote != "" || c.NodeCertPath != "" || c.NodeKeyPath != "" || c.CaRootPath != "" || c.IsInsecure {
+		errs = append(errs, fieldError("remotes", "conflicts with remote, cert, key, cacert and insecure, set them in each remote instead"))
+	}
+
+	seen := map[string]bool{}
+	for index, remote := range c.Remotes {
+		field := fmt.Sprintf("remotes[%d]", index)
+		switch {
+		case remote.Remote == "":
+			errs = append(errs, fieldError(field+".remote", "is required"))
+		case strings.Contains(remote.Remote, "://") && !isRegistryURL(remote.Remote):
+			errs = append(errs, fieldError(field+".remote", "%q must be an http or https URL, or the name of a registry remote", remote.Remote))
+		case seen[remote.Remote]:
+			errs = append(errs, fieldError(field+".remote", "%q is listed more than once", remote.Remote))
+		}
+		seen[remote.Remote] = true
+
+		if remote.NodeKeyPath != "" && remote.NodeCertPath == "" {
+			errs = append(errs, fieldError(field+".key", "requires cert"))
+		}
+	}
+
+	if timeout, err := time.ParseDuration(c.RemoteTimeout); err != nil {
+		errs = append(errs, fieldError("remote_timeout", "%s", err))
+	} else if timeout <= 0 {
+		errs = append(errs, fieldError("remote_timeout", "%q must be positive", c.RemoteTimeout))
+	}
+
+	return errs
+}
+
+// registryRemotes runs registry commands against remote, or against each of remotes in
+// turn until one succeeds. Each of remotes is health checked first, and one that fails the
+// check is skipped for the rest of the build.
+type registryRemotes struct {
+	client  client.Client
+	params  []client.RegistryParams
+	checked bool
+	timeout time.Duration
+
+	urls   map[string]string
+	health map[string]error
+}
+
+func newRegistryRemotes(ankaClient client.Client, config *Config) *registryRemotes {
+	if len(config.Remotes) == 0 {
+		return &registryRemotes{
+			client: ankaClient,
+			params: []client.RegistryParams{{
+				Remote:       config.Remote,
+				NodeCertPath: config.NodeCertPath,
+				NodeKeyPath:  config.NodeKeyPath,
+				CaRootPath:   config.CaRootPath,
+				IsInsecure:   config.IsInsecure,
+				HostArch:     config.HostArch,
+			}},
+		}
+	}
+
+	timeout, _ := time.ParseDuration(config.RemoteTimeout)
+
+	remotes := &registryRemotes{
+		client:  ankaClient,
+		checked: true,
+		timeout: timeout,
+		health:  map[string]error{},
+	}
+	for _, remote := range config.Remotes {
+		remotes.params = append(remotes.params, client.RegistryParams{
+			Remote:       remote.Remote,
+			NodeCertPath: remote.NodeCertPath,
+			NodeKeyPath:  remote.NodeKeyPath,
+			CaRootPath:   remote.CaRootPath,
+			IsInsecure:   remote.IsInsecure,
+			HostArch:     config.HostArch,
+		})
+	}
+	return remotes
+}
+
+// Try runs command against the remotes in order and returns the one it succeeded on. what
+// describes the command in messages, such as "pull source_foo".
+func (r *registryRemotes) Try(ui packer.Ui, what string, command func(client.RegistryParams) error) (client.RegistryParams, error) {
+	if !r.checked {
+		return r.params[0], command(r.params[0])
+	}
+
+	var failures []string
+	for _, params := range r.params {
+		if err := r.check(params); err != nil {
+			ui.Message(fmt.Sprintf("Skipping registry remote %s: %s", params.Remote, err))
+			failures = append(failures, fmt.Sprintf("%s: %s", params.Remote, err))
+			continue
+		}
+
+		log.Printf("Trying to %s from registry remote %s", what, params.Remote)
+
+		err := command(params)
+		if err == nil {
+			return params, nil
+		}
+
+		ui.Message(fmt.Sprintf("Failed to %s from registry remote %s: %s", what, params.Remote, err))
+		failures = append(failures, fmt.Sprintf("%s: %s", params.Remote, err))
+	}
+
+	return client.RegistryParams{}, fmt.Errorf("no registry remote could %s (%s)", what, strings.Join(failures, "; "))
+}
+
+// check health checks a remote once, looking up the URL of a remote added by name
+func (r *registryRemotes) check(params client.RegistryParams) error {
+	if err, ok := r.health[params.Remote]; ok {
+		return err
+	}
+
+	err := r.checkURL(params)
+	r.health[params.Remote] = err
+	return err
+}
+
+func (r *registryRemotes) checkURL(params client.RegistryParams) error {
+	if !isRegistryURL(params.Remote) {
+		if r.urls == nil {
+			repos, err := r.client.RegistryListRepos()
+			if err != nil {
+				return fmt.Errorf("failed to list registry remotes: %w", err)
+			}
+			r.urls = map[string]string{}
+			for _, repo := range repos {
+				r.urls[repo.Name] = repo.Url
+			}
+		}
+
+		url, ok := r.urls[params.Remote]
+		if !ok {
+			return fmt.Errorf("not a configured registry remote (add it with anka registry add)")
+		}
+		params.Remote = url
+	}
+
+	return r.client.RegistryStatus(params, r.timeout)
+}
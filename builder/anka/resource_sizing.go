@@ -0,0 +1,163 @@
+package anka
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/veertuinc/packer-plugin-veertu-anka/util"
+)
+
+const (
+	bytesPerMiB = uint64(1024 * 1024)
+	bytesPerGiB = 1024 * bytesPerMiB
+)
+
+// vmResources holds ram_size, vcpu_count and disk_size once any host or source relative
+// expressions have been resolved to the absolute values anka expects.
+type vmResources struct {
+	RAMSize   string
+	VCPUCount string
+	DiskSize  string
+}
+
+// isRelativeRAMSize reports whether ram_size is a percentage of host memory ("50%").
+func isRelativeRAMSize(ramSize string) bool {
+	return strings.HasSuffix(strings.TrimSpace(ramSize), "%")
+}
+
+// isRelativeVCPUCount reports whether vcpu_count is relative to the host ("host", "host-2", "50%").
+func isRelativeVCPUCount(vcpuCount string) bool {
+	vcpuCount = strings.TrimSpace(vcpuCount)
+	return strings.HasPrefix(vcpuCount, "host") || strings.HasSuffix(vcpuCount, "%")
+}
+
+// isRelativeDiskSize reports whether disk_size grows the source disk ("+40G").
+func isRelativeDiskSize(diskSize string) bool {
+	return strings.HasPrefix(strings.TrimSpace(diskSize), "+")
+}
+
+// formatSizeBytes renders bytes in the "[0-9]+G" format anka expects, falling back to
+// megabytes when the value isn't a whole number of gigabytes.
+func formatSizeBytes(bytes uint64) string {
+	if bytes%bytesPerGiB == 0 {
+		return fmt.Sprintf("%dG", bytes/bytesPerGiB)
+	}
+	return fmt.Sprintf("%dM", bytes/bytesPerMiB)
+}
+
+func parsePercentage(expression string) (uint64, error) {
+	percentage, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(expression), "%"), 10, 64)
+	if err != nil || percentage == 0 || percentage > 100 {
+		return 0, fmt.Errorf("%q is not a percentage between 1%% and 100%%", expression)
+	}
+	return percentage, nil
+}
+
+func resolveRAMSize(ramSize string, hostMemoryBytes uint64) (string, error) {
+	percentage, err := parsePercentage(ramSize)
+	if err != nil {
+		return "", fmt.Errorf("ram_size: %w", err)
+	}
+
+	ramBytes := hostMemoryBytes * percentage / 100
+	ramBytes -= ramBytes % bytesPerMiB
+	if ramBytes == 0 {
+		return "", fmt.Errorf("ram_size: %q of host memory (%d bytes) is less than 1M", ramSize, hostMemoryBytes)
+	}
+
+	return formatSizeBytes(ramBytes), nil
+}
+
+func resolveVCPUCount(vcpuCount string, hostCPUCount int) (string, error) {
+	expression := strings.TrimSpace(vcpuCount)
+	resolved := 0
+
+	switch {
+	case strings.HasSuffix(expression, "%"):
+		percentage, err := parsePercentage(expression)
+		if err != nil {
+			return "", fmt.Errorf("vcpu_count: %w", err)
+		}
+		resolved = hostCPUCount * int(percentage) / 100
+	case expression == "host":
+		resolved = hostCPUCount
+	case strings.HasPrefix(expression, "host-"):
+		reserved, err := strconv.Atoi(strings.TrimPrefix(expression, "host-"))
+		if err != nil || reserved < 0 {
+			return "", fmt.Errorf("vcpu_count: %q must be in host-N format", vcpuCount)
+		}
+		resolved = hostCPUCount - reserved
+	default:
+		return "", fmt.Errorf("vcpu_count: %q must be a number, host, host-N or a percentage", vcpuCount)
+	}
+
+	if resolved < 1 {
+		return "", fmt.Errorf("vcpu_count: %q leaves no vCPUs on a host with %d CPUs", vcpuCount, hostCPUCount)
+	}
+
+	return strconv.Itoa(resolved), nil
+}
+
+func resolveDiskSize(diskSize string, sourceDiskBytes uint64, ankaUtil util.Util) (string, error) {
+	growthBytes, err := ankaUtil.ConvertDiskSizeToBytes(strings.TrimPrefix(strings.TrimSpace(diskSize), "+"))
+	if err != nil {
+		return "", fmt.Errorf("disk_size: %w", err)
+	}
+	if sourceDiskBytes == 0 {
+		return "", fmt.Errorf("disk_size: %q is relative to the source VM, which has no disk size to grow", diskSize)
+	}
+
+	return formatSizeBytes(sourceDiskBytes + growthBytes), nil
+}
+
+// resolveVMResources turns relative ram_size, vcpu_count and disk_size expressions into
+// absolute values. Host facts are only looked up when an expression needs them and
+// sourceDiskBytes is the source VM's disk size (0 when creating from an installer).
+func resolveVMResources(config *Config, ankaUtil util.Util, sourceDiskBytes uint64) (vmResources, error) {
+	resources := vmResources{
+		RAMSize:   config.RAMSize,
+		VCPUCount: config.VCPUCount,
+		DiskSize:  config.DiskSize,
+	}
+
+	if isRelativeRAMSize(config.RAMSize) || isRelativeVCPUCount(config.VCPUCount) {
+		hostResources, err := ankaUtil.HostResources()
+		if err != nil {
+			return resources, err
+		}
+
+		if isRelativeRAMSize(config.RAMSize) {
+			resources.RAMSize, err = resolveRAMSize(config.RAMSize, hostResources.MemoryBytes)
+			if err != nil {
+				return resources, err
+			}
+		}
+
+		if isRelativeVCPUCount(config.VCPUCount) {
+			resources.VCPUCount, err = resolveVCPUCount(config.VCPUCount, hostResources.CPUCount)
+			if err != nil {
+				return resources, err
+			}
+		}
+	}
+
+	if isRelativeDiskSize(config.DiskSize) {
+		var err error
+		resources.DiskSize, err = resolveDiskSize(config.DiskSize, sourceDiskBytes, ankaUtil)
+		if err != nil {
+			return resources, err
+		}
+	}
+
+	log.Printf("Resolved VM resources: ram_size %q -> %q, vcpu_count %q -> %q, disk_size %q -> %q",
+		config.RAMSize, resources.RAMSize, config.VCPUCount, resources.VCPUCount, config.DiskSize, resources.DiskSize)
+
+	return resources, nil
+}
+
+// differsFrom reports whether any of the resource settings needed resolving.
+func (r vmResources) differsFrom(config *Config) bool {
+	return r.RAMSize != config.RAMSize || r.VCPUCount != config.VCPUCount || r.DiskSize != config.DiskSize
+}
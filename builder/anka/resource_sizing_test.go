@@ -0,0 +1,103 @@
+package anka
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	mocks "github.com/veertuinc/packer-plugin-veertu-anka/mocks"
+	"github.com/veertuinc/packer-plugin-veertu-anka/util"
+	"gotest.tools/v3/assert"
+)
+
+func TestResolveRAMSize(t *testing.T) {
+	t.Run("percentage of host memory", func(t *testing.T) {
+		ramSize, err := resolveRAMSize("50%", 16*bytesPerGiB)
+
+		assert.NilError(t, err)
+		assert.Equal(t, "8G", ramSize)
+	})
+
+	t.Run("falls back to megabytes", func(t *testing.T) {
+		ramSize, err := resolveRAMSize("33%", 16*bytesPerGiB)
+
+		assert.NilError(t, err)
+		assert.Equal(t, "5406M", ramSize)
+	})
+
+	t.Run("rejects percentages over 100", func(t *testing.T) {
+		_, err := resolveRAMSize("150%", 16*bytesPerGiB)
+
+		assert.ErrorContains(t, err, "ram_size")
+	})
+}
+
+func TestResolveVCPUCount(t *testing.T) {
+	for _, tc := range []struct {
+		expression string
+		expected   string
+	}{
+		{"host", "12"},
+		{"host-2", "10"},
+		{"50%", "6"},
+	} {
+		t.Run(tc.expression, func(t *testing.T) {
+			vcpuCount, err := resolveVCPUCount(tc.expression, 12)
+
+			assert.NilError(t, err)
+			assert.Equal(t, tc.expected, vcpuCount)
+		})
+	}
+
+	t.Run("errors when nothing is left", func(t *testing.T) {
+		_, err := resolveVCPUCount("host-12", 12)
+
+		assert.ErrorContains(t, err, "leaves no vCPUs")
+	})
+
+	t.Run("errors on unknown expressions", func(t *testing.T) {
+		_, err := resolveVCPUCount("hostess", 12)
+
+		assert.ErrorContains(t, err, "must be a number, host, host-N or a percentage")
+	})
+}
+
+func TestResolveVMResources(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	ankaUtil := mocks.NewMockUtil(mockCtrl)
+
+	t.Run("absolute values are left alone", func(t *testing.T) {
+		config := &Config{RAMSize: "8G", VCPUCount: "4", DiskSize: "80G"}
+
+		resources, err := resolveVMResources(config, ankaUtil, 40*bytesPerGiB)
+
+		assert.NilError(t, err)
+		assert.Equal(t, vmResources{RAMSize: "8G", VCPUCount: "4", DiskSize: "80G"}, resources)
+		assert.Assert(t, !resources.differsFrom(config))
+	})
+
+	t.Run("relative values are resolved from host and source", func(t *testing.T) {
+		config := &Config{RAMSize: "50%", VCPUCount: "host-2", DiskSize: "+40G"}
+
+		gomock.InOrder(
+			ankaUtil.EXPECT().HostResources().Return(util.HostResources{MemoryBytes: 32 * bytesPerGiB, CPUCount: 10}, nil).Times(1),
+			ankaUtil.EXPECT().ConvertDiskSizeToBytes("40G").Return(40*bytesPerGiB, nil).Times(1),
+		)
+
+		resources, err := resolveVMResources(config, ankaUtil, 80*bytesPerGiB)
+
+		assert.NilError(t, err)
+		assert.Equal(t, vmResources{RAMSize: "16G", VCPUCount: "8", DiskSize: "120G"}, resources)
+		assert.Assert(t, resources.differsFrom(config))
+	})
+
+	t.Run("relative disk size needs a source disk", func(t *testing.T) {
+		config := &Config{DiskSize: "+40G"}
+
+		ankaUtil.EXPECT().ConvertDiskSizeToBytes("40G").Return(40*bytesPerGiB, nil).Times(1)
+
+		_, err := resolveVMResources(config, ankaUtil, 0)
+
+		assert.ErrorContains(t, err, "relative to the source VM")
+	})
+}
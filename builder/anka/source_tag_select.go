@@ -0,0 +1,140 @@
+package anka
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+)
+
+// Ways source_vm_tag_sort orders the tags matching source_vm_tag_filter, best first
+const (
+	sourceTagSortNewest = "newest"
+	sourceTagSortSemver = "semver"
+	sourceTagSortDate   = "date"
+)
+
+var validSourceTagSorts = []string{sourceTagSortNewest, sourceTagSortSemver, sourceTagSortDate}
+
+var (
+	sourceTagNumberPattern = regexp.MustCompile(`[0-9]+`)
+	sourceTagDatePattern   = regexp.MustCompile(`(?:^|[^0-9])([0-9]{4})-?([0-9]{2})-?([0-9]{2})(?:[^0-9]|$)`)
+)
+
+// sourceTagMatcher matches tags against source_vm_tag_filter: a regular expression between
+// slashes, such as /^14\.[0-9]+-/, or a glob such as 14.*-15.*
+type sourceTagMatcher func(tag string) bool
+
+func newSourceTagMatcher(filter string) (sourceTagMatcher, error) {
+	if len(filter) > 1 && strings.HasPrefix(filter, "/") && strings.HasSuffix(filter, "/") {
+		pattern, err := regexp.Compile(filter[1 : len(filter)-1])
+		if err != nil {
+			return nil, err
+		}
+		return pattern.MatchString, nil
+	}
+
+	if _, err := path.Match(filter, ""); err != nil {
+		return nil, fmt.Errorf("%q is not a valid glob: %w", filter, err)
+	}
+	return func(tag string) bool {
+		matched, _ := path.Match(filter, tag)
+		return matched
+	}, nil
+}
+
+// sourceTagNumbers are the numbers in a tag in order, so 14.5-15.4-20240601 is [14 5 15 4 20240601]
+func sourceTagNumbers(tag string) []int {
+	var numbers []int
+	for _, match := range sourceTagNumberPattern.FindAllString(tag, -1) {
+		number, err := strconv.Atoi(match)
+		if err != nil {
+			continue
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers
+}
+
+// compareSourceTagNumbers orders tags by their numbers like versions, so 14.10 is after 14.9
+func compareSourceTagNumbers(a []int, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
+
+// sourceTagDate is the last date in a tag, as 20240601 or 2024-06-01
+func sourceTagDate(tag string) (time.Time, bool) {
+	matches := sourceTagDatePattern.FindAllStringSubmatch(tag, -1)
+	for i := len(matches) - 1; i >= 0; i-- {
+		date, err := time.Parse("20060102", matches[i][1]+matches[i][2]+matches[i][3])
+		if err == nil {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// selectSourceTag picks the best registry tag matching filter. Ties, and tags that sort the
+// same, go to the most recently pushed version so the choice is deterministic.
+func selectSourceTag(versions []client.RegistryDescribeVersion, filter string, sortBy string) (client.RegistryDescribeVersion, int, error) {
+	matches, err := newSourceTagMatcher(filter)
+	if err != nil {
+		return client.RegistryDescribeVersion{}, 0, err
+	}
+
+	var candidates []client.RegistryDescribeVersion
+	for _, version := range versions {
+		if version.Tag == "" || !matches(version.Tag) {
+			continue
+		}
+		if sortBy == sourceTagSortDate {
+			if _, ok := sourceTagDate(version.Tag); !ok {
+				continue
+			}
+		}
+		candidates = append(candidates, version)
+	}
+
+	if len(candidates) == 0 {
+		if sortBy == sourceTagSortDate {
+			return client.RegistryDescribeVersion{}, 0, fmt.Errorf("no tag matches %q and contains a date", filter)
+		}
+		return client.RegistryDescribeVersion{}, 0, fmt.Errorf("no tag matches %q", filter)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+
+		switch sortBy {
+		case sourceTagSortSemver:
+			if c := compareSourceTagNumbers(sourceTagNumbers(a.Tag), sourceTagNumbers(b.Tag)); c != 0 {
+				return c > 0
+			}
+		case sourceTagSortDate:
+			dateA, _ := sourceTagDate(a.Tag)
+			dateB, _ := sourceTagDate(b.Tag)
+			if !dateA.Equal(dateB) {
+				return dateA.After(dateB)
+			}
+		}
+
+		if a.Number != b.Number {
+			return a.Number > b.Number
+		}
+		return a.Tag > b.Tag
+	})
+
+	return candidates[0], len(candidates), nil
+}
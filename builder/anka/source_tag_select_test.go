@@ -0,0 +1,49 @@
+package anka
+
+import (
+	"testing"
+
+	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+	"gotest.tools/v3/assert"
+)
+
+func TestSelectSourceTag(t *testing.T) {
+	versions := []client.RegistryDescribeVersion{
+		{Tag: "14.9-15.4-20240801", Number: 0},
+		{Tag: "14.10-15.3-20240601", Number: 1},
+		{Tag: "15.0-16.0-2024-09-01", Number: 2},
+		{Tag: "14.10-15.3-20240602", Number: 3},
+		{Tag: "base", Number: 4},
+		{Tag: "", Number: 5},
+	}
+
+	for _, tc := range []struct {
+		filter     string
+		sortBy     string
+		expected   string
+		candidates int
+	}{
+		{"*", sourceTagSortNewest, "base", 5},
+		{"14.*", sourceTagSortNewest, "14.10-15.3-20240602", 3},
+		{"14.*", sourceTagSortSemver, "14.10-15.3-20240602", 3},
+		{"14.*", sourceTagSortDate, "14.9-15.4-20240801", 3},
+		{"*", sourceTagSortDate, "15.0-16.0-2024-09-01", 4},
+		{"/^14\\.(9|10)-15\\.3-/", sourceTagSortSemver, "14.10-15.3-20240602", 2},
+		{"/-16\\.0-/", sourceTagSortNewest, "15.0-16.0-2024-09-01", 1},
+	} {
+		selected, candidates, err := selectSourceTag(versions, tc.filter, tc.sortBy)
+
+		assert.NilError(t, err, tc.filter)
+		assert.Equal(t, tc.expected, selected.Tag, "%s sorted by %s", tc.filter, tc.sortBy)
+		assert.Equal(t, tc.candidates, candidates, "%s sorted by %s", tc.filter, tc.sortBy)
+	}
+
+	_, _, err := selectSourceTag(versions, "16.*", sourceTagSortNewest)
+	assert.Error(t, err, `no tag matches "16.*"`)
+
+	_, _, err = selectSourceTag(versions, "base", sourceTagSortDate)
+	assert.Error(t, err, `no tag matches "base" and contains a date`)
+
+	_, _, err = selectSourceTag(versions, "/(/", sourceTagSortNewest)
+	assert.ErrorContains(t, err, "missing closing )")
+}
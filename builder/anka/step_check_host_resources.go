@@ -0,0 +1,282 @@
+package anka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+	"github.com/veertuinc/packer-plugin-veertu-anka/util"
+)
+
+// defaultCreateDiskSize is the disk size anka creates VMs with when disk_size isn't set
+const defaultCreateDiskSize = "40G"
+
+// ankaLibraryPath is where anka keeps VM images: img_lib_dir from anka config, or anka's default
+// library, which is system wide when anka runs as root
+func ankaLibraryPath(ankaClient client.Client) string {
+	ankaConfig, err := ankaClient.Config()
+	if err != nil {
+		log.Printf("Failed to read anka config, checking the default library: %s", err)
+	}
+	if ankaConfig.ImgLibDir != "" {
+		return ankaConfig.ImgLibDir
+	}
+	if ankaConfig.VMLibDir != "" {
+		return ankaConfig.VMLibDir
+	}
+
+	if os.Geteuid() == 0 {
+		return filepath.Join("/Library", "Application Support", "Veertu", "Anka")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "~"
+	}
+	return filepath.Join(home, "Library", "Application Support", "Veertu", "Anka")
+}
+
+// formatGiB renders bytes as gigabytes with one decimal for messages
+func formatGiB(bytes uint64) string {
+	return fmt.Sprintf("%.1fG", float64(bytes)/float64(bytesPerGiB))
+}
+
+// diskEstimate breaks down the space a build is expected to need on the anka library volume
+type diskEstimate struct {
+	Template        uint64
+	FullCopy        uint64
+	Growth          uint64
+	AdditionalDisks uint64
+	Margin          uint64
+}
+
+func (e diskEstimate) total() uint64 {
+	return e.Template + e.FullCopy + e.Growth + e.AdditionalDisks + e.Margin
+}
+
+func (e diskEstimate) String() string {
+	fullCopy := ""
+	if e.FullCopy > 0 {
+		fullCopy = fmt.Sprintf(" + full copy %s", formatGiB(e.FullCopy))
+	}
+	return fmt.Sprintf("template %s%s + disk growth %s + additional disks %s + min_free_disk %s",
+		formatGiB(e.Template), fullCopy, formatGiB(e.Growth), formatGiB(e.AdditionalDisks), formatGiB(e.Margin))
+}
+
+// estimateDiskUsage works out the space needed for a VM with a targetDiskBytes disk.
+// templateBytes is the space the source template's image takes, sourceDiskBytes the capacity
+// of its disk (0 when creating), pulling says whether the template has to be downloaded first
+// and fullCopy whether the clone copies it (clone_mode full) rather than sharing its image.
+func estimateDiskUsage(templateBytes uint64, sourceDiskBytes uint64, targetDiskBytes uint64, pulling bool, fullCopy bool, additionalDiskBytes uint64, marginBytes uint64) diskEstimate {
+	estimate := diskEstimate{
+		AdditionalDisks: additionalDiskBytes,
+		Margin:          marginBytes,
+	}
+
+	if pulling {
+		estimate.Template = templateBytes
+	}
+	if fullCopy {
+		estimate.FullCopy = templateBytes
+	}
+	if targetDiskBytes > sourceDiskBytes {
+		estimate.Growth = targetDiskBytes - sourceDiskBytes
+	}
+
+	return estimate
+}
+
+// registryTemplateSize is the size the registry lists for the version of the source that will be
+// pulled, or 0 when it can't be told. That's the stored image, not the capacity of its disk. Tags picked by source_vm_tag_filter or source_vm_tag_id
+// aren't resolved yet, so the largest version is assumed.
+func registryTemplateSize(ankaClient client.Client, config *Config, sourceRef string, ui packer.Ui) uint64 {
+	var describe client.RegistryDescribeResponse
+	_, err := newRegistryRemotes(ankaClient, config).Try(ui, fmt.Sprintf("describe %s", sourceRef), func(registryParams client.RegistryParams) error {
+		var err error
+		describe, err = ankaClient.RegistryDescribe(registryParams, sourceRef)
+		return err
+	})
+	if err != nil {
+		ui.Message(fmt.Sprintf("Failed to list the registry tags of %s, estimating its size from disk_size: %s", sourceRef, err))
+		return 0
+	}
+
+	if config.SourceVMTagFilter != "" || config.SourceVMTagID != "" {
+		largest := uint64(0)
+		for _, version := range describe.Versions {
+			if version.Size > largest {
+				largest = version.Size
+			}
+		}
+		return largest
+	}
+
+	version, ok := registrySourceVersion(describe, config.SourceVMTag)
+	if !ok {
+		return 0
+	}
+	return version.Size
+}
+
+// StepCheckHostResources makes sure the host has the disk space, memory and CPUs the VM
+// needs before anything is pulled, cloned or created.
+type StepCheckHostResources struct{}
+
+// Run compares the estimated VM footprint with what the host has available
+func (s *StepCheckHostResources) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+	ankaUtil := state.Get("util").(util.Util)
+	onError := func(err error) multistep.StepAction {
+		return ankaUtil.StepError(ui, state, err)
+	}
+	ankaClient := state.Get("client").(client.Client)
+
+	templateBytes := uint64(0)
+	sourceDiskBytes := uint64(0)
+	pulling := false
+	sourceSizeKnown := true
+
+	if config.SourceVMName != "" || config.SourceVMID != "" {
+		sourceRef := config.SourceVMName
+		if config.SourceVMID != "" {
+			sourceRef = config.SourceVMID
+		}
+
+		exists := false
+		if config.fetchPolicy() != fetchPolicyAlways {
+			var err error
+			exists, err = ankaClient.Exists(sourceRef)
+			if err != nil {
+				return onError(err)
+			}
+		}
+
+		if exists {
+			sourceShow, err := ankaClient.Show(sourceRef)
+			if err != nil {
+				return onError(err)
+			}
+			// The image of a local source takes at most its disk's capacity
+			templateBytes = sourceShow.HardDrive
+			sourceDiskBytes = sourceShow.HardDrive
+		} else {
+			pulling = true
+			templateBytes = registryTemplateSize(ankaClient, config, sourceRef, ui)
+			sourceSizeKnown = false
+		}
+	}
+
+	// The registry only has the image's size, the source disk's capacity isn't known until
+	// it's pulled, so growth can't be estimated yet
+	sizing := *config
+	if !sourceSizeKnown && isRelativeDiskSize(config.DiskSize) {
+		sizing.DiskSize = ""
+	}
+
+	resources, err := resolveVMResources(&sizing, ankaUtil, sourceDiskBytes)
+	if err != nil {
+		return onError(err)
+	}
+
+	targetDiskSize := resources.DiskSize
+	if targetDiskSize == "" && (config.Installer != "" || config.InstallerURL != "") {
+		targetDiskSize = defaultCreateDiskSize
+	}
+
+	targetDiskBytes := sourceDiskBytes
+	if targetDiskSize != "" {
+		targetDiskBytes, err = ankaUtil.ConvertDiskSizeToBytes(targetDiskSize)
+		if err != nil {
+			return onError(err)
+		}
+	}
+	if !sourceSizeKnown {
+		sourceDiskBytes = targetDiskBytes
+	}
+	// Without the registry's size the requested disk is the best guess for the download
+	if pulling && templateBytes == 0 {
+		templateBytes = targetDiskBytes
+	}
+
+	additionalDiskBytes := uint64(0)
+	for _, additionalDisk := range config.AdditionalDisks {
+		diskBytes, err := ankaUtil.ConvertDiskSizeToBytes(additionalDisk.Size)
+		if err != nil {
+			return onError(err)
+		}
+		additionalDiskBytes += diskBytes
+	}
+
+	marginBytes := uint64(0)
+	if config.MinFreeDisk != "" {
+		marginBytes, err = ankaUtil.ConvertDiskSizeToBytes(config.MinFreeDisk)
+		if err != nil {
+			return onError(err)
+		}
+	}
+
+	fullCopy := config.PackerBuilderType == "veertu-anka-vm-clone" && config.CloneMode == cloneModeFull
+	estimate := estimateDiskUsage(templateBytes, sourceDiskBytes, targetDiskBytes, pulling, fullCopy, additionalDiskBytes, marginBytes)
+
+	libraryPath := ankaLibraryPath(ankaClient)
+	freeBytes, err := ankaUtil.FreeDiskSpace(libraryPath)
+	if err != nil {
+		return onError(err)
+	}
+
+	hostResources, err := ankaUtil.HostResources()
+	if err != nil {
+		return onError(err)
+	}
+
+	var problems []string
+
+	if pulling && templateBytes == 0 {
+		ui.Message(fmt.Sprintf("The size of %s is unknown until it is pulled, only checking additional disks and min_free_disk", config.SourceVMName))
+	}
+	if estimate.total() > freeBytes {
+		problems = append(problems, fmt.Sprintf("not enough free disk space in %s: %s available, %s required (%s)",
+			libraryPath, formatGiB(freeBytes), formatGiB(estimate.total()), estimate))
+	}
+
+	if resources.RAMSize != "" {
+		ramBytes, err := ankaUtil.ConvertDiskSizeToBytes(strings.ToUpper(resources.RAMSize))
+		if err != nil {
+			return onError(err)
+		}
+		if ramBytes > hostResources.MemoryBytes {
+			problems = append(problems, fmt.Sprintf("ram_size %s is more than the host's %s of memory", resources.RAMSize, formatGiB(hostResources.MemoryBytes)))
+		}
+	}
+
+	if resources.VCPUCount != "" {
+		vcpuCount, err := strconv.Atoi(resources.VCPUCount)
+		if err != nil {
+			return onError(err)
+		}
+		if vcpuCount > hostResources.CPUCount {
+			problems = append(problems, fmt.Sprintf("vcpu_count %d is more than the host's %d CPUs", vcpuCount, hostResources.CPUCount))
+		}
+	}
+
+	if len(problems) > 0 {
+		return onError(errors.New("host resource checks failed:\n* " + strings.Join(problems, "\n* ")))
+	}
+
+	ui.Say(fmt.Sprintf("Host resources: %s free in %s, %s estimated for this build", formatGiB(freeBytes), libraryPath, formatGiB(estimate.total())))
+
+	return multistep.ActionContinue
+}
+
+// Cleanup will run when errors occur
+// Nothing to do here since this step only checks the host
+func (s *StepCheckHostResources) Cleanup(state multistep.StateBag) {
+}
@@ -0,0 +1,136 @@
+package anka
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+	mocks "github.com/veertuinc/packer-plugin-veertu-anka/mocks"
+	"github.com/veertuinc/packer-plugin-veertu-anka/util"
+	"gotest.tools/v3/assert"
+)
+
+func TestEstimateDiskUsage(t *testing.T) {
+	t.Run("pulling includes the template", func(t *testing.T) {
+		estimate := estimateDiskUsage(20*bytesPerGiB, 60*bytesPerGiB, 100*bytesPerGiB, true, false, 10*bytesPerGiB, 5*bytesPerGiB)
+
+		assert.Equal(t, 20*bytesPerGiB, estimate.Template)
+		assert.Equal(t, 40*bytesPerGiB, estimate.Growth)
+		assert.Equal(t, 75*bytesPerGiB, estimate.total())
+	})
+
+	t.Run("local source only needs the growth", func(t *testing.T) {
+		estimate := estimateDiskUsage(60*bytesPerGiB, 60*bytesPerGiB, 60*bytesPerGiB, false, false, 0, 0)
+
+		assert.Equal(t, uint64(0), estimate.total())
+	})
+
+	t.Run("full copy includes the template again", func(t *testing.T) {
+		estimate := estimateDiskUsage(60*bytesPerGiB, 60*bytesPerGiB, 60*bytesPerGiB, false, true, 0, 0)
+
+		assert.Equal(t, 60*bytesPerGiB, estimate.total())
+		assert.Equal(t, "template 0.0G + full copy 60.0G + disk growth 0.0G + additional disks 0.0G + min_free_disk 0.0G", estimate.String())
+	})
+}
+
+func TestCheckHostResourcesRun(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	ankaClient := mocks.NewMockClient(mockCtrl)
+	ankaUtil := mocks.NewMockUtil(mockCtrl)
+	realUtil := &util.AnkaUtil{}
+
+	step := StepCheckHostResources{}
+	ui := packer.TestUi(t)
+	ctx := context.Background()
+	state := new(multistep.BasicStateBag)
+
+	state.Put("ui", ui)
+	state.Put("client", ankaClient)
+	state.Put("util", ankaUtil)
+
+	ankaUtil.EXPECT().ConvertDiskSizeToBytes(gomock.Any()).DoAndReturn(realUtil.ConvertDiskSizeToBytes).AnyTimes()
+	ankaUtil.EXPECT().HostResources().Return(util.HostResources{MemoryBytes: 16 * bytesPerGiB, CPUCount: 8}, nil).AnyTimes()
+
+	t.Run("enough resources", func(t *testing.T) {
+		state.Put("config", &Config{SourceVMName: "source", DiskSize: "100G", RAMSize: "8G", VCPUCount: "4"})
+
+		ankaClient.EXPECT().Exists("source").Return(true, nil).Times(1)
+		ankaClient.EXPECT().Show("source").Return(client.ShowResponse{HardDrive: 80 * bytesPerGiB}, nil).Times(1)
+		ankaClient.EXPECT().Config().Return(client.ConfigResponse{ImgLibDir: "/Volumes/Anka/img_lib"}, nil).Times(1)
+		ankaUtil.EXPECT().FreeDiskSpace("/Volumes/Anka/img_lib").Return(25*bytesPerGiB, nil).Times(1)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+	})
+
+	ankaClient.EXPECT().Config().Return(client.ConfigResponse{}, nil).AnyTimes()
+
+	t.Run("fails early with the numbers", func(t *testing.T) {
+		state.Put("config", &Config{SourceVMName: "source", DiskSize: "100G", RAMSize: "32G", VCPUCount: "12", MinFreeDisk: "10G"})
+
+		ankaClient.EXPECT().Exists("source").Return(true, nil).Times(1)
+		ankaClient.EXPECT().Show("source").Return(client.ShowResponse{HardDrive: 80 * bytesPerGiB}, nil).Times(1)
+		ankaUtil.EXPECT().FreeDiskSpace(gomock.Any()).Return(25*bytesPerGiB, nil).Times(1)
+		ankaUtil.EXPECT().StepError(ui, state, gomock.Any()).DoAndReturn(func(_ packer.Ui, _ multistep.StateBag, err error) multistep.StepAction {
+			assert.ErrorContains(t, err, "25.0G available, 30.0G required (template 0.0G + disk growth 20.0G + additional disks 0.0G + min_free_disk 10.0G)")
+			assert.ErrorContains(t, err, "ram_size 32G is more than the host's 16.0G of memory")
+			assert.ErrorContains(t, err, "vcpu_count 12 is more than the host's 8 CPUs")
+			return multistep.ActionHalt
+		}).Times(1)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionHalt, stepAction)
+	})
+
+	t.Run("pulling uses the registry's size for the template but not for disk growth", func(t *testing.T) {
+		state.Put("config", &Config{SourceVMName: "source", SourceVMTag: "v2", DiskSize: "100G"})
+
+		ankaClient.EXPECT().Exists("source").Return(false, nil).Times(1)
+		ankaClient.EXPECT().RegistryDescribe(gomock.Any(), "source").Return(client.RegistryDescribeResponse{Versions: []client.RegistryDescribeVersion{
+			{Tag: "v1", Number: 1, Size: 40 * bytesPerGiB},
+			{Tag: "v2", Number: 2, Size: 60 * bytesPerGiB},
+		}}, nil).Times(1)
+		ankaUtil.EXPECT().FreeDiskSpace(gomock.Any()).Return(50*bytesPerGiB, nil).Times(1)
+		ankaUtil.EXPECT().StepError(ui, state, gomock.Any()).DoAndReturn(func(_ packer.Ui, _ multistep.StateBag, err error) multistep.StepAction {
+			assert.ErrorContains(t, err, "50.0G available, 60.0G required (template 60.0G + disk growth 0.0G")
+			return multistep.ActionHalt
+		}).Times(1)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionHalt, stepAction)
+	})
+
+	t.Run("pulling uses the requested disk size when the registry can't be listed", func(t *testing.T) {
+		state.Put("config", &Config{SourceVMName: "source", DiskSize: "100G"})
+
+		ankaClient.EXPECT().Exists("source").Return(false, nil).Times(1)
+		ankaClient.EXPECT().RegistryDescribe(gomock.Any(), "source").Return(client.RegistryDescribeResponse{}, fmt.Errorf("connection refused")).Times(1)
+		ankaUtil.EXPECT().FreeDiskSpace(gomock.Any()).Return(50*bytesPerGiB, nil).Times(1)
+		ankaUtil.EXPECT().StepError(ui, state, gomock.Any()).Return(multistep.ActionHalt).Times(1)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionHalt, stepAction)
+	})
+
+	t.Run("full clone_mode counts a copy of the template", func(t *testing.T) {
+		config := &Config{SourceVMName: "source", CloneMode: cloneModeFull}
+		config.PackerBuilderType = "veertu-anka-vm-clone"
+		state.Put("config", config)
+
+		ankaClient.EXPECT().Exists("source").Return(true, nil).Times(1)
+		ankaClient.EXPECT().Show("source").Return(client.ShowResponse{HardDrive: 80 * bytesPerGiB}, nil).Times(1)
+		ankaUtil.EXPECT().FreeDiskSpace(gomock.Any()).Return(50*bytesPerGiB, nil).Times(1)
+		ankaUtil.EXPECT().StepError(ui, state, gomock.Any()).DoAndReturn(func(_ packer.Ui, _ multistep.StateBag, err error) multistep.StepAction {
+			assert.ErrorContains(t, err, "50.0G available, 80.0G required (template 0.0G + full copy 80.0G")
+			return multistep.ActionHalt
+		}).Times(1)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionHalt, stepAction)
+	})
+}
@@ -0,0 +1,227 @@
+package anka
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+	"github.com/veertuinc/packer-plugin-veertu-anka/util"
+)
+
+const defaultOrphanedVMCleanupOlderThan = "24h"
+
+// OrphanedVMCleanup configures the removal of VMs left behind by earlier builds that
+// crashed before they could clean up after themselves.
+type OrphanedVMCleanup struct {
+	Patterns  []string `mapstructure:"patterns"`
+	OlderThan string   `mapstructure:"older_than"`
+	Force     bool     `mapstructure:"force"`
+	DryRun    bool     `mapstructure:"dry_run"`
+}
+
+// listCreationDateLayouts are the creation_date formats anka list has used
+var listCreationDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999",
+	"2006-01-02 15:04:05",
+}
+
+func parseListCreationDate(creationDate string) (time.Time, error) {
+	for _, layout := range listCreationDateLayouts {
+		created, err := time.Parse(layout, creationDate)
+		if err == nil {
+			return created, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognised creation date %q", creationDate)
+}
+
+// matchesOrphanedVMPattern reports whether name matches one of the glob patterns
+func matchesOrphanedVMPattern(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		matched, err := path.Match(pattern, name)
+		if err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// selectOrphanedVMs picks the VMs to remove: matching a pattern, created more than olderThan
+// before now, whose name or UUID isn't protected and not running unless force is set.
+func selectOrphanedVMs(vms []client.ListResponse, cleanup OrphanedVMCleanup, olderThan time.Duration, protected []string, now time.Time) []client.ListResponse {
+	var orphaned []client.ListResponse
+
+	for _, vm := range vms {
+		if containsString(protected, vm.Name) || containsString(protected, vm.UUID) || !matchesOrphanedVMPattern(vm.Name, cleanup.Patterns) {
+			continue
+		}
+
+		created, err := parseListCreationDate(vm.CreationDate)
+		if err != nil {
+			log.Printf("Skipping %s during orphaned VM cleanup: %s", vm.Name, err)
+			continue
+		}
+		if now.Sub(created) < olderThan {
+			continue
+		}
+
+		if vm.Status == "running" && !cleanup.Force {
+			log.Printf("Skipping running VM %s during orphaned VM cleanup (set force to remove it)", vm.Name)
+			continue
+		}
+
+		orphaned = append(orphaned, vm)
+	}
+
+	return orphaned
+}
+
+// orphanedVMsProtected lists the names and UUIDs orphaned VM cleanup never removes: the source,
+// however it's selected, this build's vm_name once it's a plain name or has been rendered, VMs
+// recorded in the build cache and sources with local tags that linked clones may share
+func orphanedVMsProtected(state multistep.StateBag, config *Config, ankaClient client.Client) []string {
+	var protected []string
+
+	sourceRef := config.SourceVMName
+	if config.SourceVMID != "" {
+		sourceRef = config.SourceVMID
+	}
+	if sourceRef != "" {
+		protected = append(protected, config.SourceVMName, config.SourceVMID)
+
+		// The source may only be in the registry, in which case there is nothing local to protect
+		show, err := ankaClient.Show(sourceRef)
+		if err == nil {
+			protected = append(protected, show.Name, show.UUID)
+		} else {
+			log.Printf("Not protecting local copy of source %s during orphaned VM cleanup: %s", sourceRef, err)
+		}
+	}
+
+	if vmName, ok := state.GetOk("vm_name"); ok {
+		protected = append(protected, vmName.(string))
+	}
+	if config.VMName != "" && !isVMNameTemplate(config.VMName) {
+		protected = append(protected, config.VMName)
+	}
+
+	// Other builds on the host may use the build cache even when this one doesn't
+	dir, err := packer.CachePath(buildCacheDirName)
+	if err == nil {
+		var records []buildCacheRecord
+		records, err = (&buildCache{dir: dir}).Records()
+		for _, record := range records {
+			protected = append(protected, record.VMName, record.VMID)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to read the build cache during orphaned VM cleanup: %s", err)
+	}
+
+	sources, err := localTagSources()
+	if err != nil {
+		log.Printf("Failed to read the local tag records during orphaned VM cleanup: %s", err)
+	}
+	protected = append(protected, sources...)
+
+	var nonEmpty []string
+	for _, value := range protected {
+		if value != "" {
+			nonEmpty = append(nonEmpty, value)
+		}
+	}
+	return nonEmpty
+}
+
+// StepCleanupOrphanedVMs deletes VMs left behind by earlier builds that match orphaned_vm_cleanup
+type StepCleanupOrphanedVMs struct{}
+
+// Run lists the VMs on the host and removes the orphaned ones
+func (s *StepCleanupOrphanedVMs) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+	ankaUtil := state.Get("util").(util.Util)
+	onError := func(err error) multistep.StepAction {
+		return ankaUtil.StepError(ui, state, err)
+	}
+	ankaClient := state.Get("client").(client.Client)
+	cleanup := config.OrphanedVMCleanup
+
+	if len(cleanup.Patterns) == 0 {
+		return multistep.ActionContinue
+	}
+
+	olderThan, err := time.ParseDuration(cleanup.OlderThan)
+	if err != nil {
+		return onError(err)
+	}
+
+	vms, err := ankaClient.List()
+	if err != nil {
+		return onError(err)
+	}
+
+	protected := orphanedVMsProtected(state, config, ankaClient)
+	orphaned := selectOrphanedVMs(vms, cleanup, olderThan, protected, time.Now())
+
+	if len(orphaned) == 0 {
+		ui.Say(fmt.Sprintf("No orphaned VMs matching %s older than %s", strings.Join(cleanup.Patterns, ", "), olderThan))
+		return multistep.ActionContinue
+	}
+
+	locks := hostLocksFrom(state)
+	removed := 0
+	for _, vm := range orphaned {
+		if locks.HeldByOther(hostLockVMName, vm.Name) {
+			ui.Say(fmt.Sprintf("Skipping orphaned VM %s since another build on this host is using it", vm.Name))
+			continue
+		}
+
+		description := fmt.Sprintf("%s (%s, %s, created %s", vm.Name, vm.UUID, vm.Status, vm.CreationDate)
+		if vm.Size != "" {
+			description += fmt.Sprintf(", size %s", vm.Size)
+		}
+		description += ")"
+
+		if cleanup.DryRun {
+			ui.Say(fmt.Sprintf("Would delete orphaned VM %s", description))
+			continue
+		}
+
+		if vm.Status == "running" {
+			err = ankaClient.Stop(client.StopParams{VMName: vm.Name, Force: true})
+			if err != nil {
+				ui.Error(fmt.Sprintf("Failed to stop orphaned VM %s: %s", vm.Name, err))
+				continue
+			}
+		}
+
+		err = ankaClient.Delete(client.DeleteParams{VMName: vm.Name})
+		if err != nil {
+			ui.Error(fmt.Sprintf("Failed to delete orphaned VM %s: %s", vm.Name, err))
+			continue
+		}
+
+		ui.Say(fmt.Sprintf("Deleted orphaned VM %s", description))
+		removed++
+	}
+
+	if !cleanup.DryRun {
+		ui.Say(fmt.Sprintf("Removed %d of %d orphaned VMs", removed, len(orphaned)))
+	}
+
+	return multistep.ActionContinue
+}
+
+// Cleanup will run when errors occur
+// Nothing to do here since removed VMs can't be brought back
+func (s *StepCleanupOrphanedVMs) Cleanup(state multistep.StateBag) {
+}
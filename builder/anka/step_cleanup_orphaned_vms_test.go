@@ -0,0 +1,131 @@
+package anka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+	mocks "github.com/veertuinc/packer-plugin-veertu-anka/mocks"
+	"gotest.tools/v3/assert"
+)
+
+var orphanedVMList = []client.ListResponse{
+	{Name: "anka-packer-base-14.0-23A344", UUID: "1", Status: "stopped", CreationDate: "2026-10-01T10:00:00Z"},
+	{Name: "source-AbCdEfGhIj", UUID: "2", Status: "running", CreationDate: "2026-10-01T10:00:00.000000"},
+	{Name: "source-KlMnOpQrSt", UUID: "3", Status: "suspended", CreationDate: "2026-10-19T09:00:00Z"},
+	{Name: "source", UUID: "4", Status: "stopped", CreationDate: "2026-09-01T10:00:00Z"},
+	{Name: "ci-runner", UUID: "5", Status: "stopped", CreationDate: "2026-09-01T10:00:00Z"},
+}
+
+func TestSelectOrphanedVMs(t *testing.T) {
+	now := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	cleanup := OrphanedVMCleanup{Patterns: []string{"anka-packer-base-*", "source*"}}
+
+	t.Run("skips running, recent and protected VMs", func(t *testing.T) {
+		orphaned := selectOrphanedVMs(orphanedVMList, cleanup, 24*time.Hour, []string{"source"}, now)
+
+		assert.Equal(t, 1, len(orphaned))
+		assert.Equal(t, "anka-packer-base-14.0-23A344", orphaned[0].Name)
+	})
+
+	t.Run("force includes running VMs", func(t *testing.T) {
+		cleanup.Force = true
+
+		orphaned := selectOrphanedVMs(orphanedVMList, cleanup, 24*time.Hour, []string{"source"}, now)
+
+		assert.Equal(t, 2, len(orphaned))
+		assert.Equal(t, "source-AbCdEfGhIj", orphaned[1].Name)
+	})
+
+	t.Run("protects by UUID", func(t *testing.T) {
+		orphaned := selectOrphanedVMs(orphanedVMList, cleanup, 24*time.Hour, []string{"1", "2"}, now)
+
+		assert.Equal(t, 1, len(orphaned))
+		assert.Equal(t, "source", orphaned[0].Name)
+	})
+}
+
+func TestCleanupOrphanedVMsRun(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	ankaClient := mocks.NewMockClient(mockCtrl)
+	ankaUtil := mocks.NewMockUtil(mockCtrl)
+
+	step := StepCleanupOrphanedVMs{}
+	ui := packer.TestUi(t)
+	ctx := context.Background()
+	state := new(multistep.BasicStateBag)
+
+	state.Put("ui", ui)
+	state.Put("client", ankaClient)
+	state.Put("util", ankaUtil)
+
+	t.Run("disabled without patterns", func(t *testing.T) {
+		state.Put("config", &Config{})
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+	})
+
+	t.Run("dry run deletes nothing", func(t *testing.T) {
+		state.Put("config", &Config{OrphanedVMCleanup: OrphanedVMCleanup{Patterns: []string{"anka-packer-base-*"}, OlderThan: "24h", DryRun: true}})
+
+		ankaClient.EXPECT().List().Return(orphanedVMList, nil).Times(1)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+	})
+
+	t.Run("deletes and force stops orphaned VMs", func(t *testing.T) {
+		state.Put("config", &Config{
+			SourceVMName:      "source",
+			OrphanedVMCleanup: OrphanedVMCleanup{Patterns: []string{"anka-packer-base-*", "source-*"}, OlderThan: "24h", Force: true},
+		})
+
+		gomock.InOrder(
+			ankaClient.EXPECT().List().Return(orphanedVMList, nil).Times(1),
+			ankaClient.EXPECT().Show("source").Return(client.ShowResponse{Name: "source", UUID: "4"}, nil).Times(1),
+			ankaClient.EXPECT().Delete(client.DeleteParams{VMName: "anka-packer-base-14.0-23A344"}).Return(nil).Times(1),
+			ankaClient.EXPECT().Stop(client.StopParams{VMName: "source-AbCdEfGhIj", Force: true}).Return(nil).Times(1),
+			ankaClient.EXPECT().Delete(client.DeleteParams{VMName: "source-AbCdEfGhIj"}).Return(nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+	})
+
+	t.Run("protects the resolved source, rendered vm_name and recorded VMs", func(t *testing.T) {
+		t.Setenv("PACKER_CACHE_DIR", t.TempDir())
+
+		cache, err := newBuildCache()
+		assert.NilError(t, err)
+		assert.NilError(t, cache.Save(buildCacheRecord{Fingerprint: "abc", VMName: "anka-packer-base-14.0-23A344", VMID: "1"}))
+
+		record, err := newLocalTagRecord("3")
+		assert.NilError(t, err)
+		assert.NilError(t, record.Save([]localTag{{Tag: "local-tag-AbCdEfGhIj"}}))
+
+		state.Put("vm_name", "ci-runner")
+		defer state.Remove("vm_name")
+
+		state.Put("config", &Config{
+			SourceVMName:      "source",
+			SourceVMID:        "2",
+			VMName:            "{{ .SourceName }}-{{ .Random }}",
+			OrphanedVMCleanup: OrphanedVMCleanup{Patterns: []string{"*"}, OlderThan: "1s", Force: true},
+		})
+
+		gomock.InOrder(
+			ankaClient.EXPECT().List().Return(orphanedVMList, nil).Times(1),
+			ankaClient.EXPECT().Show("2").Return(client.ShowResponse{Name: "source-AbCdEfGhIj", UUID: "2"}, nil).Times(1),
+			ankaClient.EXPECT().Delete(gomock.Any()).Times(0),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+	})
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
@@ -15,8 +17,11 @@ import (
 
 // StepCloneVM will be used to run the clone step for any 'vm-clone' builder types
 type StepCloneVM struct {
-	client client.Client
-	vmName string
+	client              client.Client
+	vmName              string
+	detachHardDrives    []int
+	detachOpticalDrives []string
+	hostPorts           map[string]int
 }
 
 // Run clones a vm from a source vm either from an anka registry or locally
@@ -28,120 +33,277 @@ func (s *StepCloneVM) Run(ctx context.Context, state multistep.StateBag) multist
 		return ankaUtil.StepError(ui, state, err)
 	}
 
-	doPull := config.AlwaysFetch
+	fetchPolicy := config.fetchPolicy()
+	doPull := fetchPolicy == fetchPolicyAlways
 
-	sourceVMTag := fmt.Sprintf("%s tag", config.SourceVMTag)
-	if config.SourceVMTag == "" {
+	s.client = state.Get("client").(client.Client)
+	// Cleanup deletes s.vmName, so it's only set once this build has cloned it. Until then the
+	// name may be another build's, such as one holding the vm_name lock.
+	s.vmName = ""
+	vmName := config.VMName
+
+	remotes := newRegistryRemotes(s.client, config)
+
+	// A pinned source_vm_id is looked up locally and in the registry by ID, so a local VM
+	// with the same name can't stand in for it
+	sourceRef := config.SourceVMName
+	if config.SourceVMID != "" {
+		sourceRef = config.SourceVMID
+	}
+
+	// The registry's tags of the source are listed at most once
+	var sourceDescribe *client.RegistryDescribeResponse
+	describeSource := func() (client.RegistryDescribeResponse, error) {
+		if sourceDescribe != nil {
+			return *sourceDescribe, nil
+		}
+
+		var describe client.RegistryDescribeResponse
+		_, err := remotes.Try(ui, fmt.Sprintf("describe %s", sourceRef), func(registryParams client.RegistryParams) error {
+			var err error
+			describe, err = s.client.RegistryDescribe(registryParams, sourceRef)
+			return err
+		})
+		if err != nil {
+			return describe, fmt.Errorf("failed to list the registry tags of %s: %w", sourceRef, err)
+		}
+
+		sourceDescribe = &describe
+		return describe, nil
+	}
+
+	sourceTag := config.SourceVMTag
+	if config.SourceVMTagFilter != "" || config.SourceVMTagID != "" {
+		describe, err := describeSource()
+		if err != nil {
+			return onError(err)
+		}
+		sourceTag, err = resolveSourceTag(config, sourceRef, describe, ui)
+		if err != nil {
+			return onError(err)
+		}
+	}
+
+	sourceVMTag := fmt.Sprintf("%s tag", sourceTag)
+	if sourceTag == "" {
 		sourceVMTag = "latest tag"
 	}
 
-	s.client = state.Get("client").(client.Client)
-	s.vmName = config.VMName
+	if vmName == "" {
+		vmName = fmt.Sprintf("%s-%s", config.SourceVMName, ankaUtil.RandSeq(10))
+	} else if isVMNameTemplate(vmName) {
+		data := newVMNameData(config.HostArch, ankaUtil.RandSeq(10), time.Now())
+		data.SourceName = config.SourceVMName
+		data.SourceTag = sourceTag
+		if data.SourceTag == "" {
+			data.SourceTag = "latest"
+		}
 
-	if s.vmName == "" {
-		s.vmName = fmt.Sprintf("%s-%s", config.SourceVMName, ankaUtil.RandSeq(10))
+		rendered, err := renderVMName(config, data)
+		if err != nil {
+			return onError(err)
+		}
+		vmName = rendered
+		ui.Say(fmt.Sprintf("Rendered vm_name %q to %s", config.VMName, vmName))
 	}
 
-	state.Put("vm_name", s.vmName)
+	state.Put("vm_name", vmName)
+
+	err := hostLocksFrom(state).Acquire(ctx, hostLockVMName, vmName)
+	if err != nil {
+		return onError(err)
+	}
 
 	if config.PackerForce {
-		exists, err := s.client.Exists(s.vmName)
+		exists, err := s.client.Exists(vmName)
 		if err != nil {
 			return onError(err)
 		}
 		if exists {
-			ui.Say(fmt.Sprintf("Deleting existing virtual machine %s", s.vmName))
+			ui.Say(fmt.Sprintf("Deleting existing virtual machine %s", vmName))
 
-			err = s.client.Delete(client.DeleteParams{VMName: s.vmName})
+			err = s.client.Delete(client.DeleteParams{VMName: vmName})
 			if err != nil {
 				return onError(err)
 			}
 		}
 	}
 
-	if !config.AlwaysFetch {
-		log.Printf("Searching for %s locally...", config.SourceVMName)
+	if fetchPolicy != fetchPolicyAlways {
+		log.Printf("Searching for %s locally...", sourceRef)
 
-		sourceExists, err := s.client.Exists(config.SourceVMName)
+		sourceExists, err := s.client.Exists(sourceRef)
 		if err != nil {
 			return onError(err)
 		}
 		if !sourceExists {
-			log.Printf("Could not find %s locally, looking in anka registry...", config.SourceVMName)
+			if fetchPolicy == fetchPolicyNever {
+				return onError(fmt.Errorf("source VM %s does not exist locally and fetch_policy is %s", sourceRef, fetchPolicyNever))
+			}
+
+			log.Printf("Could not find %s locally, looking in anka registry...", sourceRef)
 
 			doPull = true
+		} else if config.SourceVMTagFilter != "" || config.SourceVMID != "" || config.SourceVMTagID != "" || fetchPolicy == fetchPolicyIfNewer {
+			localShow, err := s.client.Show(sourceRef)
+			if err != nil {
+				return onError(err)
+			}
+
+			if mismatch := sourceVMMismatch(localShow, config, sourceTag); mismatch != "" {
+				if fetchPolicy == fetchPolicyNever {
+					return onError(fmt.Errorf("local source VM %s differs from the one requested (%s) and fetch_policy is %s", sourceRef, mismatch, fetchPolicyNever))
+				}
+
+				ui.Say(fmt.Sprintf("Local source VM %s differs from the one requested (%s), pulling it again", sourceRef, mismatch))
+
+				doPull = true
+			} else if fetchPolicy == fetchPolicyIfNewer {
+				describe, err := describeSource()
+				if err != nil {
+					return onError(err)
+				}
+
+				version, ok := registrySourceVersion(describe, sourceTag)
+				if !ok {
+					return onError(fmt.Errorf("the registry has no %s of %s", sourceVMTag, sourceRef))
+				}
+
+				if reason := staleSourceReason(localShow, version); reason != "" {
+					ui.Say(fmt.Sprintf("Local source VM %s is out of date (%s), pulling it", sourceRef, reason))
+
+					doPull = true
+				} else {
+					ui.Say(fmt.Sprintf("Local source VM %s is up to date with the registry (tag %s), not pulling it", sourceRef, version.Tag))
+				}
+			}
 		}
 	}
 
-	if doPull {
-		ui.Say(fmt.Sprintf("Pulling source VM %s with %s from Anka Registry", config.SourceVMName, sourceVMTag))
+	// The build cache is checked before pulling, from the registry's description of the source
+	if config.BuildCache {
+		var source string
+		if doPull {
+			describe, err := describeSource()
+			if err != nil {
+				return onError(err)
+			}
 
-		registryParams := client.RegistryParams{
-			Remote:       config.Remote,
-			NodeCertPath: config.NodeCertPath,
-			NodeKeyPath:  config.NodeKeyPath,
-			CaRootPath:   config.CaRootPath,
-			IsInsecure:   config.IsInsecure,
-			HostArch:     config.HostArch,
+			version, ok := registrySourceVersion(describe, sourceTag)
+			if !ok {
+				return onError(fmt.Errorf("the registry has no %s of %s", sourceVMTag, sourceRef))
+			}
+			source = buildCacheCloneSource(describe.ID, version.Tag, version.ImageID)
+		} else {
+			localShow, err := s.client.Show(sourceRef)
+			if err != nil {
+				return onError(err)
+			}
+			source = buildCacheCloneSource(localShow.UUID, localShow.Version, localShow.ImageID)
+		}
+
+		hit, err := checkBuildCache(state, config, source)
+		if err != nil {
+			return onError(err)
 		}
+		if hit {
+			return multistep.ActionContinue
+		}
+	}
 
-		registryPullParams := client.RegistryPullParams{
-			VMID:   config.SourceVMName,
-			Tag:    config.SourceVMTag,
-			Local:  false,
-			Shrink: false,
+	if doPull {
+		ui.Say(fmt.Sprintf("Pulling source VM %s with %s from Anka Registry", sourceRef, sourceVMTag))
+
+		pullLock := fmt.Sprintf("%s@%s", sourceRef, sourceTag)
+		err := hostLocksFrom(state).Acquire(ctx, hostLockPull, pullLock)
+		if err != nil {
+			return onError(err)
 		}
 
-		err := s.client.RegistryPull(registryParams, registryPullParams)
+		remote, err := s.pullSource(ui, config, remotes, sourceRef, sourceTag)
+		hostLocksFrom(state).Release(hostLockPull, pullLock)
 		if err != nil {
-			return onError(fmt.Errorf("failed to pull vm %s with %s from registry (make sure to add it as the default: https://docs.veertu.com/anka/intel/command-line-reference/#registry-add)", config.SourceVMName, sourceVMTag))
+			return onError(err)
+		}
+
+		if len(config.Remotes) > 0 {
+			ui.Say(fmt.Sprintf("Pulled source VM %s from registry remote %s", sourceRef, remote.Remote))
 		}
+		state.Put("source_remote", remote.Remote)
 	}
 
-	sourceShow, err := s.client.Show(config.SourceVMName)
+	sourceShow, err := s.client.Show(sourceRef)
 	if err != nil {
 		return onError(err)
 	}
 
-	sourceVMTagLog := config.SourceVMTag
+	if mismatch := sourceVMMismatch(sourceShow, config, sourceTag); doPull && mismatch != "" {
+		return onError(fmt.Errorf("source VM %s still differs from the one requested after pulling it (%s)", sourceRef, mismatch))
+	}
+
+	sourceVMTagLog := sourceTag
 	if sourceVMTagLog == "" {
 		sourceVMTagLog = "latest"
 	}
 	ui.Say(fmt.Sprintf("Source TEMPLATE_NAME: %s, TEMPLATE_ID: %s, TAG_NAME: %s", sourceShow.Name, sourceShow.UUID, sourceVMTagLog))
 
-	// Check arch of host
-	// // If arm64, ensure the source has a local tag
-	if !doPull {
-		if sourceShow.Version == "" {
-			if config.HostArch == "arm64" {
-				ui.Say("Preparing source VM by creating a local tag (necessary in Anka 3 to optimize disk usage of clones)")
-				pushParams := client.RegistryPushParams{
-					Tag:      fmt.Sprintf("local-tag-%s", ankaUtil.RandSeq(10)),
-					RemoteVM: "",
-					Local:    true,
-					Force:    false,
-					VMID:     config.SourceVMName,
-				}
-				s.client.RegistryPush(client.RegistryParams{HostArch: config.HostArch}, pushParams)
+	state.Put("source_vm_id", sourceShow.UUID)
+	if sourceShow.Version != "" {
+		state.Put("source_vm_tag", sourceShow.Version)
+	} else {
+		state.Put("source_vm_tag", sourceTag)
+	}
+
+	// Linked clones share the image of a tagged source, so make sure the source has a local tag
+	linkedTag := sourceShow.Version
+	if !doPull && sourceShow.Version == "" && config.shouldCreateLocalTag() {
+		capabilities, err := s.client.Capabilities()
+		if err != nil {
+			return onError(err)
+		}
+		if capabilities.LocalTags {
+			linkedTag, err = s.createLocalTag(ctx, state, config, sourceRef, sourceShow)
+			if err != nil {
+				return onError(err)
 			}
 		}
 	}
 
-	ui.Say(fmt.Sprintf("Cloning source VM %s into a new virtual machine: %s", sourceShow.Name, s.vmName))
+	resources, err := resolveVMResources(config, ankaUtil, sourceShow.HardDrive)
+	if err != nil {
+		return onError(err)
+	}
+	if resources.differsFrom(config) {
+		ui.Say(fmt.Sprintf("Resolved VM resources: RAM %s, vCPUs %s, disk %s", resources.RAMSize, resources.VCPUCount, resources.DiskSize))
+	}
+	state.Put("vm_resources", resources)
+
+	cloneParams := client.CloneParams{VMName: vmName, SourceUUID: sourceShow.UUID}
+	if config.CloneMode == cloneModeFull {
+		cloneParams.Copy = true
+		ui.Say(fmt.Sprintf("Copying source VM %s into a new virtual machine: %s", sourceShow.Name, vmName))
+	} else {
+		ui.Say(fmt.Sprintf("Cloning source VM %s into a new virtual machine: %s", sourceShow.Name, vmName))
+	}
 
-	err = s.client.Clone(client.CloneParams{VMName: s.vmName, SourceUUID: sourceShow.UUID})
+	err = s.client.Clone(cloneParams)
 	if err != nil {
 		return onError(err)
 	}
+	s.vmName = vmName
 
-	clonedShow, err := s.client.Show(s.vmName)
+	clonedShow, err := s.client.Show(vmName)
 	if err != nil {
 		return onError(err)
 	}
 
 	ui.Say(fmt.Sprintf("Cloned VM TEMPLATE_NAME: %s, TEMPLATE_ID: %s", clonedShow.Name, clonedShow.UUID))
 
-	err = s.modifyVMResources(clonedShow, config, ui, ankaUtil)
+	if config.CloneMode != cloneModeFull && linkedTag != "" {
+		recordLocalTagClone(ctx, state, sourceShow.UUID, linkedTag, clonedShow.UUID)
+	}
+
+	err = s.modifyVMResources(clonedShow, resources, config, ui, ankaUtil)
 	if err != nil {
 		return onError(err)
 	}
@@ -151,10 +313,14 @@ func (s *StepCloneVM) Run(ctx context.Context, state multistep.StateBag) multist
 		return onError(err)
 	}
 
+	state.Put("detach_hard_drives", s.detachHardDrives)
+	state.Put("detach_optical_drives", s.detachOpticalDrives)
+	state.Put("host_ports", s.hostPorts)
+
 	if config.UpdateAddons {
-		ui.Say(fmt.Sprintf("Updating guest addons for %s", s.vmName))
+		ui.Say(fmt.Sprintf("Updating guest addons for %s", vmName))
 
-		err := s.client.UpdateAddons(s.vmName)
+		err := s.client.UpdateAddons(vmName)
 		if err != nil {
 			return onError(err)
 		}
@@ -163,6 +329,134 @@ func (s *StepCloneVM) Run(ctx context.Context, state multistep.StateBag) multist
 	return multistep.ActionContinue
 }
 
+// resolveSourceTag finds the registry tag of the source VM with source_vm_tag_id, or picks the
+// one matching source_vm_tag_filter
+func resolveSourceTag(config *Config, sourceRef string, describe client.RegistryDescribeResponse, ui packer.Ui) (string, error) {
+	if config.SourceVMTagID != "" {
+		for _, version := range describe.Versions {
+			if version.ImageID != config.SourceVMTagID {
+				continue
+			}
+			if config.SourceVMTag != "" && version.Tag != config.SourceVMTag {
+				return "", fmt.Errorf("source_vm_tag_id %s is tag %s of %s, not source_vm_tag %s", config.SourceVMTagID, version.Tag, sourceRef, config.SourceVMTag)
+			}
+
+			ui.Say(fmt.Sprintf("Selected tag %s of %s with ID %s", version.Tag, sourceRef, config.SourceVMTagID))
+			return version.Tag, nil
+		}
+		return "", fmt.Errorf("no registry tag of %s has ID %s", sourceRef, config.SourceVMTagID)
+	}
+
+	selected, candidates, err := selectSourceTag(describe.Versions, config.SourceVMTagFilter, config.SourceVMTagSort)
+	if err != nil {
+		return "", fmt.Errorf("failed to pick a registry tag of %s: %w", sourceRef, err)
+	}
+
+	ui.Say(fmt.Sprintf("Selected tag %s of %s from %d tags matching %q (sorted by %s)", selected.Tag, sourceRef, candidates, config.SourceVMTagFilter, config.SourceVMTagSort))
+
+	return selected.Tag, nil
+}
+
+// pullSource pulls the source from the first remote that has it. With pull_verify the copy is
+// compared with the registry, and deleted and pulled again when it doesn't match.
+func (s *StepCloneVM) pullSource(ui packer.Ui, config *Config, remotes *registryRemotes, sourceRef string, sourceTag string) (client.RegistryParams, error) {
+	sourceVMTag := fmt.Sprintf("%s tag", sourceTag)
+	if sourceTag == "" {
+		sourceVMTag = "latest tag"
+	}
+
+	registryPullParams := client.RegistryPullParams{
+		VMID:   sourceRef,
+		Tag:    sourceTag,
+		Local:  config.PullLocal,
+		Shrink: config.PullShrink,
+	}
+
+	for attempt := 1; ; attempt++ {
+		remote, err := remotes.Try(ui, fmt.Sprintf("pull %s", sourceRef), func(registryParams client.RegistryParams) error {
+			return s.client.RegistryPull(registryParams, registryPullParams)
+		})
+		if err != nil {
+			if len(config.Remotes) > 0 {
+				return remote, fmt.Errorf("failed to pull vm %s with %s: %w", sourceRef, sourceVMTag, err)
+			}
+			return remote, fmt.Errorf("failed to pull vm %s with %s from registry (make sure to add it as the default: https://docs.veertu.com/anka/intel/command-line-reference/#registry-add)", sourceRef, sourceVMTag)
+		}
+
+		if !config.PullVerify {
+			return remote, nil
+		}
+
+		describe, err := s.client.RegistryDescribe(remote, sourceRef)
+		if err != nil {
+			return remote, fmt.Errorf("failed to describe %s in the registry to verify the pull: %w", sourceRef, err)
+		}
+		show, err := s.client.Show(sourceRef)
+		if err != nil {
+			return remote, err
+		}
+
+		mismatch := pulledSourceMismatch(show, describe, sourceTag)
+		if mismatch == "" {
+			log.Printf("Pulled source VM %s matches the registry", sourceRef)
+			return remote, nil
+		}
+		if attempt >= config.PullAttempts {
+			return remote, fmt.Errorf("pulled source VM %s still doesn't match the registry after pull_attempts = %d (%s)", sourceRef, attempt, mismatch)
+		}
+
+		ui.Say(fmt.Sprintf("Pulled source VM %s doesn't match the registry (%s), deleting it and pulling again", sourceRef, mismatch))
+
+		err = s.client.Delete(client.DeleteParams{VMName: sourceRef})
+		if err != nil {
+			return remote, fmt.Errorf("failed to delete the corrupt copy of %s: %w", sourceRef, err)
+		}
+	}
+}
+
+// pulledSourceMismatch describes how a pulled source VM differs from the template, the tag and
+// the tag's image in the registry, or returns "" when it matches. Without sourceTag the latest
+// tag was pulled. Sizes aren't compared: anka show reports the virtual disk's capacity, the
+// registry the size of the stored image.
+func pulledSourceMismatch(show client.ShowResponse, describe client.RegistryDescribeResponse, sourceTag string) string {
+	expected, found := registrySourceVersion(describe, sourceTag)
+
+	var differences []string
+	if describe.ID != "" && show.UUID != describe.ID {
+		differences = append(differences, fmt.Sprintf("UUID %s, registry has %s", show.UUID, describe.ID))
+	}
+	switch {
+	case !found && sourceTag == "":
+		differences = append(differences, "the registry lists no tags")
+	case !found:
+		differences = append(differences, fmt.Sprintf("tag %s is not in the registry", sourceTag))
+	default:
+		if show.Version != expected.Tag {
+			differences = append(differences, fmt.Sprintf("tag %q, registry has %s", show.Version, expected.Tag))
+		}
+		if expected.ImageID != "" && show.ImageID != expected.ImageID {
+			differences = append(differences, fmt.Sprintf("image %s, registry has %s", show.ImageID, expected.ImageID))
+		}
+	}
+	return strings.Join(differences, ", ")
+}
+
+// sourceVMMismatch describes how a local source VM differs from the pinned template, tag and
+// tag ID, or returns "" when it's the one requested
+func sourceVMMismatch(show client.ShowResponse, config *Config, sourceTag string) string {
+	var differences []string
+	if config.SourceVMID != "" && show.UUID != config.SourceVMID {
+		differences = append(differences, fmt.Sprintf("template ID %s, not %s", show.UUID, config.SourceVMID))
+	}
+	if config.SourceVMTagID != "" && show.ImageID != config.SourceVMTagID {
+		differences = append(differences, fmt.Sprintf("tag ID %s, not %s", show.ImageID, config.SourceVMTagID))
+	}
+	if sourceTag != "" && (config.SourceVMTagFilter != "" || config.SourceVMTagID != "") && show.Version != sourceTag {
+		differences = append(differences, fmt.Sprintf("tag %q, not %s", show.Version, sourceTag))
+	}
+	return strings.Join(differences, ", ")
+}
+
 // Cleanup will delete the vm if there happens to be an error and handle anything failed states
 func (s *StepCloneVM) Cleanup(state multistep.StateBag) {
 	ui := state.Get("ui").(packer.Ui)
@@ -191,13 +485,13 @@ func (s *StepCloneVM) Cleanup(state multistep.StateBag) {
 	}
 }
 
-func (s *StepCloneVM) modifyVMResources(showResponse client.ShowResponse, config *Config, ui packer.Ui, util util.Util) error {
+func (s *StepCloneVM) modifyVMResources(showResponse client.ShowResponse, resources vmResources, config *Config, ui packer.Ui, util util.Util) error {
 	stopParams := client.StopParams{
 		VMName: showResponse.Name,
 	}
 
-	if config.DiskSize != "" {
-		diskSizeBytes, err := util.ConvertDiskSizeToBytes(config.DiskSize)
+	if resources.DiskSize != "" {
+		diskSizeBytes, err := util.ConvertDiskSizeToBytes(resources.DiskSize)
 		if err != nil {
 			return err
 		}
@@ -208,9 +502,9 @@ func (s *StepCloneVM) modifyVMResources(showResponse client.ShowResponse, config
 				return err
 			}
 
-			ui.Say(fmt.Sprintf("Modifying VM %s disk size to %s", showResponse.Name, config.DiskSize))
+			ui.Say(fmt.Sprintf("Modifying VM %s disk size to %s", showResponse.Name, resources.DiskSize))
 
-			err = s.client.Modify(showResponse.Name, "set", "hard-drive", "-s", config.DiskSize)
+			err = s.client.Modify(showResponse.Name, "set", "hard-drive", "-s", resources.DiskSize)
 			if err != nil {
 				return err
 			}
@@ -232,26 +526,33 @@ func (s *StepCloneVM) modifyVMResources(showResponse client.ShowResponse, config
 		}
 
 		if diskSizeBytes < showResponse.HardDrive {
-			return fmt.Errorf("Shrinking VM disks is not allowed! Source VM Disk Size (bytes): %v", showResponse.HardDrive)
+			if !config.AllowDiskShrink {
+				return fmt.Errorf("Shrinking VM disks is not allowed! Source VM Disk Size (bytes): %v (set allow_disk_shrink to shrink it)", showResponse.HardDrive)
+			}
+
+			err := shrinkVMDisk(s.client, showResponse.Name, resources.DiskSize, diskSizeBytes, showResponse.HardDrive, ui)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
-	if config.RAMSize != "" && config.RAMSize != showResponse.RAM {
+	if resources.RAMSize != "" && resources.RAMSize != showResponse.RAM {
 		err := s.client.Stop(stopParams)
 		if err != nil {
 			return err
 		}
 
-		ui.Say(fmt.Sprintf("Modifying VM %s RAM to %s", showResponse.Name, config.RAMSize))
+		ui.Say(fmt.Sprintf("Modifying VM %s RAM to %s", showResponse.Name, resources.RAMSize))
 
-		err = s.client.Modify(showResponse.Name, "set", "ram", config.RAMSize)
+		err = s.client.Modify(showResponse.Name, "set", "ram", resources.RAMSize)
 		if err != nil {
 			return err
 		}
 	}
 
-	if config.VCPUCount != "" {
-		stringVCPUCount, err := strconv.ParseInt(config.VCPUCount, 10, 32)
+	if resources.VCPUCount != "" {
+		stringVCPUCount, err := strconv.ParseInt(resources.VCPUCount, 10, 32)
 		if err != nil {
 			return err
 		}
@@ -280,35 +581,18 @@ func (s *StepCloneVM) modifyVMProperties(showResponse client.ShowResponse, confi
 	}
 
 	if len(config.PortForwardingRules) > 0 {
-		describeResponse, err := s.client.Describe(showResponse.Name)
+		hostPorts, err := applyPortForwardingRules(
+			s.client,
+			stopParams,
+			showResponse.Name,
+			config.PortForwardingRules,
+			config.PackerConfig.PackerForce,
+			ui,
+		)
 		if err != nil {
 			return err
 		}
-		existingForwardedPorts := make(map[int]struct{})
-		for _, existingNetworkCard := range describeResponse.NetworkCards {
-			for _, existingPortForwardingRule := range existingNetworkCard.PortForwardingRules {
-				existingForwardedPorts[existingPortForwardingRule.HostPort] = struct{}{}
-			}
-		}
-		for _, wantedPortForwardingRule := range config.PortForwardingRules {
-			ui.Say(fmt.Sprintf("Ensuring %s port-forwarding (Guest Port: %s, Host Port: %s, Rule Name: %s)", showResponse.Name, strconv.Itoa(wantedPortForwardingRule.PortForwardingGuestPort), strconv.Itoa(wantedPortForwardingRule.PortForwardingHostPort), wantedPortForwardingRule.PortForwardingRuleName))
-			if _, ok := existingForwardedPorts[wantedPortForwardingRule.PortForwardingHostPort]; ok {
-				if wantedPortForwardingRule.PortForwardingHostPort > 0 {
-					ui.Error(fmt.Sprintf("Found an existing host port rule (%s)! Skipping without setting...", strconv.Itoa(wantedPortForwardingRule.PortForwardingHostPort)))
-					continue
-				}
-			}
-			err := s.client.Stop(stopParams)
-			if err != nil {
-				return err
-			}
-			err = s.client.Modify(showResponse.Name, "add", "port-forwarding", "--host-port", strconv.Itoa(wantedPortForwardingRule.PortForwardingHostPort), "--guest-port", strconv.Itoa(wantedPortForwardingRule.PortForwardingGuestPort), wantedPortForwardingRule.PortForwardingRuleName)
-			if !config.PackerConfig.PackerForce {
-				if err != nil {
-					return err
-				}
-			}
-		}
+		s.hostPorts = hostPorts
 	}
 
 	if config.HWUUID != "" {
@@ -349,5 +633,21 @@ func (s *StepCloneVM) modifyVMProperties(showResponse client.ShowResponse, confi
 		}
 	}
 
+	if len(config.AdditionalDisks) > 0 {
+		detachHardDrives, err := applyAdditionalDisks(s.client, stopParams, showResponse.Name, config.AdditionalDisks, ui)
+		if err != nil {
+			return err
+		}
+		s.detachHardDrives = detachHardDrives
+	}
+
+	if len(config.OpticalDrives) > 0 {
+		detachOpticalDrives, err := applyOpticalDrives(s.client, stopParams, showResponse.Name, config.OpticalDrives, ui)
+		if err != nil {
+			return err
+		}
+		s.detachOpticalDrives = detachOpticalDrives
+	}
+
 	return nil
 }
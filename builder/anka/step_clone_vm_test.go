@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/hashicorp/packer-plugin-sdk/common"
@@ -23,6 +24,8 @@ var (
 )
 
 func TestCloneVMRun(t *testing.T) {
+	t.Setenv("PACKER_CACHE_DIR", t.TempDir())
+
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 	ankaClient := mocks.NewMockClient(mockCtrl)
@@ -47,6 +50,14 @@ func TestCloneVMRun(t *testing.T) {
 		t.Fail()
 	}
 
+	capabilities, err := client.NewCapabilities("2.5.7")
+	if err != nil {
+		t.Fail()
+	}
+	ankaClient.EXPECT().Capabilities().DoAndReturn(func() (client.Capabilities, error) {
+		return capabilities, nil
+	}).AnyTimes()
+
 	t.Run("clone vm", func(t *testing.T) {
 		config := &Config{
 			VMName:       "foo",
@@ -107,6 +118,53 @@ func TestCloneVMRun(t *testing.T) {
 		assert.Equal(t, multistep.ActionContinue, stepAction)
 	})
 
+	t.Run("clone vm with a vm_name template", func(t *testing.T) {
+		config := &Config{
+			VMName:       "{{ .SourceName }}-{{ .SourceTag }}-{{ .Arch }}-{{ .Random }}",
+			SourceVMName: "source_foo",
+			SourceVMTag:  "v2",
+			HostArch:     "arm64",
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		state.Put("config", config)
+
+		gomock.InOrder(
+			ankaUtil.EXPECT().RandSeq(10).Return("ABCDEabcde").Times(1),
+			ankaClient.EXPECT().Exists(config.SourceVMName).Return(true, nil).Times(1),
+			ankaClient.EXPECT().Show(config.SourceVMName).Return(sourceShowResponse, nil).Times(1),
+			ankaClient.EXPECT().Clone(client.CloneParams{VMName: "source_foo-v2-arm64-ABCDEabcde", SourceUUID: sourceShowResponse.UUID}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo-v2-arm64-ABCDEabcde").Return(clonedShowResponse, nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+		assert.Equal(t, "source_foo-v2-arm64-ABCDEabcde", state.Get("vm_name"))
+	})
+
+	t.Run("clone vm with a vm_name template rendering an invalid name", func(t *testing.T) {
+		config := &Config{
+			VMName:       "{{ .SourceTag }}",
+			SourceVMName: "source_foo",
+			SourceVMTag:  "release candidate",
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		state.Put("config", config)
+
+		ankaUtil.EXPECT().RandSeq(10).Return("ABCDEabcde").Times(1)
+		ankaUtil.EXPECT().StepError(ui, state, gomock.Any()).Return(multistep.ActionHalt).Times(1)
+
+		stepAction := step.Run(ctx, state)
+
+		assert.Equal(t, multistep.ActionHalt, stepAction)
+	})
+
 	t.Run("clone vm with packer force", func(t *testing.T) {
 		config := &Config{
 			VMName:       "foo",
@@ -224,6 +282,34 @@ func TestCloneVMRun(t *testing.T) {
 		assert.Equal(t, multistep.ActionHalt, stepAction)
 	})
 
+	t.Run("clone vm waiting on another build's vm_name lock leaves its VM alone", func(t *testing.T) {
+		config := &Config{
+			VMName:       "foo",
+			SourceVMName: "source_foo",
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		locker := testHostLocker(t, 50*time.Millisecond)
+		other := newHostLocker(locker.dir, time.Second)
+		assert.NilError(t, other.Acquire(ctx, hostLockVMName, config.VMName))
+
+		state.Put("host_locks", locker)
+		defer state.Remove("host_locks")
+		state.Put("config", config)
+
+		ankaUtil.EXPECT().StepError(ui, state, gomock.Any()).Return(multistep.ActionHalt).Times(1)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionHalt, stepAction)
+
+		// No Delete is expected, the VM belongs to the build holding the lock
+		state.Put(multistep.StateHalted, true)
+		defer state.Remove(multistep.StateHalted)
+		step.Cleanup(state)
+	})
+
 	t.Run("clone vm with always fetch flag should only pull from anka registry", func(t *testing.T) {
 		config := &Config{
 			AlwaysFetch:  true,
@@ -459,6 +545,12 @@ func TestCloneVMRun(t *testing.T) {
 		state.Put("vm_name", step.vmName)
 		state.Put("config", &config)
 
+		forwardedDescribeResponse := client.DescribeResponse{
+			NetworkCards: []client.DescribeNetworkCard{
+				{PortForwardingRules: []client.DescribePortForwardingRule{{GuestPort: 8080, HostPort: 80, RuleName: "rule1"}}},
+			},
+		}
+
 		gomock.InOrder(
 			ankaClient.EXPECT().Exists(config.SourceVMName).Return(true, nil).Times(1),
 			ankaClient.EXPECT().Show(config.SourceVMName).Return(sourceShowResponse, nil).Times(1),
@@ -474,6 +566,7 @@ func TestCloneVMRun(t *testing.T) {
 				Modify(clonedShowResponse.Name, "add", "port-forwarding", "--host-port", strconv.Itoa(config.PortForwardingRules[0].PortForwardingHostPort), "--guest-port", strconv.Itoa(config.PortForwardingRules[0].PortForwardingGuestPort), "rule1").
 				Return(nil).
 				Times(1),
+			ankaClient.EXPECT().Describe(config.VMName).Return(forwardedDescribeResponse, nil).Times(1),
 		)
 
 		// hwuuid
@@ -560,7 +653,7 @@ func TestCloneVMRun(t *testing.T) {
 			ankaClient.EXPECT().Show(config.SourceVMName).Return(sourceShowResponse, nil).Times(1),
 			ankaClient.EXPECT().Clone(client.CloneParams{VMName: step.vmName, SourceUUID: sourceShowResponse.UUID}).Return(nil).Times(1),
 			ankaClient.EXPECT().Show(step.vmName).Return(clonedShowResponse, nil).Times(1),
-			ankaClient.EXPECT().Describe(config.VMName).Return(clonedDescribeResponse, nil).Times(1),
+			ankaClient.EXPECT().Describe(config.VMName).Return(clonedDescribeResponse, nil).Times(2),
 		)
 
 		mockui := packer.MockUi{}
@@ -588,6 +681,8 @@ func TestCloneVMRun(t *testing.T) {
 			HostArch: "arm64",
 		}
 
+		capabilities, _ = client.NewCapabilities("3.0.0")
+
 		registryParams := client.RegistryParams{
 			HostArch: config.HostArch,
 		}
@@ -623,4 +718,864 @@ func TestCloneVMRun(t *testing.T) {
 		assert.Equal(t, mockui.SayMessages[1].Message, "Cloning source VM source_foo into a new virtual machine: foo")
 		assert.Equal(t, multistep.ActionContinue, stepAction)
 	})
+
+	t.Run("clone vm with a source_vm_tag_filter pulls the selected tag", func(t *testing.T) {
+		config := &Config{
+			VMName:            "foo-{{ .SourceTag }}",
+			SourceVMName:      "source_foo",
+			SourceVMTagFilter: "14.*-15.*",
+			SourceVMTagSort:   sourceTagSortDate,
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		state.Put("config", config)
+
+		describe := client.RegistryDescribeResponse{
+			Name: "source_foo",
+			Versions: []client.RegistryDescribeVersion{
+				{Tag: "14.5-15.4-20240601", Number: 0},
+				{Tag: "14.6-15.4-20240715", Number: 1},
+				{Tag: "15.0-16.0-20240901", Number: 2},
+				{Tag: "14.6-15.4-20240710", Number: 3},
+			},
+		}
+		sourceShow := client.ShowResponse{UUID: "1234-abcdef-hijk-5678", Name: "source_foo", Version: "14.5-15.4-20240601"}
+		pulledShow := client.ShowResponse{UUID: "1234-abcdef-hijk-5678", Name: "source_foo", Version: "14.6-15.4-20240715"}
+
+		gomock.InOrder(
+			ankaClient.EXPECT().RegistryDescribe(client.RegistryParams{}, "source_foo").Return(describe, nil).Times(1),
+			ankaUtil.EXPECT().RandSeq(10).Return("ABCDEabcde").Times(1),
+			ankaClient.EXPECT().Exists("source_foo").Return(true, nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(sourceShow, nil).Times(1),
+			ankaClient.EXPECT().RegistryPull(client.RegistryParams{}, client.RegistryPullParams{VMID: "source_foo", Tag: "14.6-15.4-20240715"}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(pulledShow, nil).Times(1),
+			ankaClient.EXPECT().Clone(client.CloneParams{VMName: "foo-14.6-15.4-20240715", SourceUUID: pulledShow.UUID}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("foo-14.6-15.4-20240715").Return(clonedShowResponse, nil).Times(1),
+		)
+
+		mockui := &packer.MockUi{}
+		state.Put("ui", mockui)
+		defer state.Put("ui", ui)
+
+		stepAction := step.Run(ctx, state)
+
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+		assert.Equal(t, `Selected tag 14.6-15.4-20240715 of source_foo from 3 tags matching "14.*-15.*" (sorted by date)`, mockui.SayMessages[0].Message)
+		assert.Equal(t, "14.6-15.4-20240715", state.Get("source_vm_tag"))
+		assert.Equal(t, pulledShow.UUID, state.Get("source_vm_id"))
+	})
+
+	t.Run("clone vm with a source_vm_tag_filter uses a local source at the selected tag", func(t *testing.T) {
+		config := &Config{
+			VMName:            "foo",
+			SourceVMName:      "source_foo",
+			SourceVMTagFilter: "/^14\\./",
+			SourceVMTagSort:   sourceTagSortNewest,
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		state.Put("config", config)
+
+		describe := client.RegistryDescribeResponse{
+			Versions: []client.RegistryDescribeVersion{
+				{Tag: "14.5-15.4-20240601", Number: 0},
+				{Tag: "15.0-16.0-20240901", Number: 1},
+			},
+		}
+		sourceShow := client.ShowResponse{UUID: "1234-abcdef-hijk-5678", Name: "source_foo", Version: "14.5-15.4-20240601"}
+
+		gomock.InOrder(
+			ankaClient.EXPECT().RegistryDescribe(client.RegistryParams{}, "source_foo").Return(describe, nil).Times(1),
+			ankaClient.EXPECT().Exists("source_foo").Return(true, nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(sourceShow, nil).Times(2),
+			ankaClient.EXPECT().Clone(client.CloneParams{VMName: "foo", SourceUUID: sourceShow.UUID}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("foo").Return(clonedShowResponse, nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+		assert.Equal(t, "14.5-15.4-20240601", state.Get("source_vm_tag"))
+	})
+
+	t.Run("clone vm with a source_vm_tag_filter matching nothing", func(t *testing.T) {
+		config := &Config{
+			VMName:            "foo",
+			SourceVMName:      "source_foo",
+			SourceVMTagFilter: "16.*",
+			SourceVMTagSort:   sourceTagSortSemver,
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		state.Put("config", config)
+
+		describe := client.RegistryDescribeResponse{
+			Versions: []client.RegistryDescribeVersion{{Tag: "14.5-15.4-20240601"}},
+		}
+		expectedErr := fmt.Errorf(`failed to pick a registry tag of source_foo: no tag matches "16.*"`)
+
+		gomock.InOrder(
+			ankaClient.EXPECT().RegistryDescribe(client.RegistryParams{}, "source_foo").Return(describe, nil).Times(1),
+			ankaUtil.EXPECT().StepError(ui, state, gomock.Any()).DoAndReturn(func(_ packer.Ui, _ multistep.StateBag, err error) multistep.StepAction {
+				assert.Error(t, err, expectedErr.Error())
+				return multistep.ActionHalt
+			}).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionHalt, stepAction)
+	})
+
+	t.Run("clone vm with a source_vm_tag_id pulls over a local source at another tag", func(t *testing.T) {
+		config := &Config{
+			VMName:        "foo",
+			SourceVMName:  "source_foo",
+			SourceVMID:    "1234-abcdef-hijk-5678",
+			SourceVMTagID: "img-2",
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		state.Put("config", config)
+
+		describe := client.RegistryDescribeResponse{
+			ID: "1234-abcdef-hijk-5678",
+			Versions: []client.RegistryDescribeVersion{
+				{Tag: "v1", Number: 0, ImageID: "img-1"},
+				{Tag: "v2", Number: 1, ImageID: "img-2"},
+			},
+		}
+		localShow := client.ShowResponse{UUID: "1234-abcdef-hijk-5678", Name: "source_foo", ImageID: "img-1", Version: "v1"}
+		pulledShow := client.ShowResponse{UUID: "1234-abcdef-hijk-5678", Name: "source_foo", ImageID: "img-2", Version: "v2"}
+
+		gomock.InOrder(
+			ankaClient.EXPECT().RegistryDescribe(client.RegistryParams{}, "1234-abcdef-hijk-5678").Return(describe, nil).Times(1),
+			ankaClient.EXPECT().Exists("1234-abcdef-hijk-5678").Return(true, nil).Times(1),
+			ankaClient.EXPECT().Show("1234-abcdef-hijk-5678").Return(localShow, nil).Times(1),
+			ankaClient.EXPECT().RegistryPull(client.RegistryParams{}, client.RegistryPullParams{VMID: "1234-abcdef-hijk-5678", Tag: "v2"}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("1234-abcdef-hijk-5678").Return(pulledShow, nil).Times(1),
+			ankaClient.EXPECT().Clone(client.CloneParams{VMName: "foo", SourceUUID: pulledShow.UUID}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("foo").Return(clonedShowResponse, nil).Times(1),
+		)
+
+		mockui := &packer.MockUi{}
+		state.Put("ui", mockui)
+		defer state.Put("ui", ui)
+
+		stepAction := step.Run(ctx, state)
+
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+		assert.Equal(t, "Selected tag v2 of 1234-abcdef-hijk-5678 with ID img-2", mockui.SayMessages[0].Message)
+		assert.Equal(t, `Local source VM 1234-abcdef-hijk-5678 differs from the one requested (tag ID img-1, not img-2, tag "v1", not v2), pulling it again`, mockui.SayMessages[1].Message)
+		assert.Equal(t, "v2", state.Get("source_vm_tag"))
+	})
+
+	t.Run("clone vm with a source_vm_id uses a matching local source", func(t *testing.T) {
+		config := &Config{
+			VMName:       "foo",
+			SourceVMName: "source_foo",
+			SourceVMID:   "1234-abcdef-hijk-5678",
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		state.Put("config", config)
+
+		localShow := client.ShowResponse{UUID: "1234-abcdef-hijk-5678", Name: "source_foo", ImageID: "img-1", Version: "v1"}
+
+		gomock.InOrder(
+			ankaClient.EXPECT().Exists("1234-abcdef-hijk-5678").Return(true, nil).Times(1),
+			ankaClient.EXPECT().Show("1234-abcdef-hijk-5678").Return(localShow, nil).Times(2),
+			ankaClient.EXPECT().Clone(client.CloneParams{VMName: "foo", SourceUUID: localShow.UUID}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("foo").Return(clonedShowResponse, nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+		assert.Equal(t, localShow.UUID, state.Get("source_vm_id"))
+	})
+
+	t.Run("clone vm with a source_vm_tag_id the pull doesn't match", func(t *testing.T) {
+		config := &Config{
+			VMName:        "foo",
+			SourceVMName:  "source_foo",
+			SourceVMTagID: "img-2",
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		state.Put("config", config)
+
+		describe := client.RegistryDescribeResponse{
+			Versions: []client.RegistryDescribeVersion{{Tag: "v2", ImageID: "img-2"}},
+		}
+		pulledShow := client.ShowResponse{UUID: "1234-abcdef-hijk-5678", Name: "source_foo", ImageID: "img-3", Version: "v2"}
+		expectedErr := fmt.Errorf("source VM source_foo still differs from the one requested after pulling it (tag ID img-3, not img-2)")
+
+		gomock.InOrder(
+			ankaClient.EXPECT().RegistryDescribe(client.RegistryParams{}, "source_foo").Return(describe, nil).Times(1),
+			ankaClient.EXPECT().Exists("source_foo").Return(false, nil).Times(1),
+			ankaClient.EXPECT().RegistryPull(client.RegistryParams{}, client.RegistryPullParams{VMID: "source_foo", Tag: "v2"}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(pulledShow, nil).Times(1),
+			ankaUtil.EXPECT().StepError(ui, state, gomock.Any()).DoAndReturn(func(_ packer.Ui, _ multistep.StateBag, err error) multistep.StepAction {
+				assert.Error(t, err, expectedErr.Error())
+				return multistep.ActionHalt
+			}).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionHalt, stepAction)
+	})
+
+	t.Run("clone vm with a source_vm_tag_id of another source_vm_tag", func(t *testing.T) {
+		config := &Config{
+			VMName:        "foo",
+			SourceVMName:  "source_foo",
+			SourceVMTag:   "v1",
+			SourceVMTagID: "img-2",
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		state.Put("config", config)
+
+		describe := client.RegistryDescribeResponse{
+			Versions: []client.RegistryDescribeVersion{{Tag: "v1", ImageID: "img-1"}, {Tag: "v2", ImageID: "img-2"}},
+		}
+		expectedErr := fmt.Errorf("source_vm_tag_id img-2 is tag v2 of source_foo, not source_vm_tag v1")
+
+		gomock.InOrder(
+			ankaClient.EXPECT().RegistryDescribe(client.RegistryParams{}, "source_foo").Return(describe, nil).Times(1),
+			ankaUtil.EXPECT().StepError(ui, state, gomock.Any()).DoAndReturn(func(_ packer.Ui, _ multistep.StateBag, err error) multistep.StepAction {
+				assert.Error(t, err, expectedErr.Error())
+				return multistep.ActionHalt
+			}).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionHalt, stepAction)
+	})
+
+	t.Run("clone vm with remotes falls back to the next healthy remote", func(t *testing.T) {
+		config := &Config{
+			VMName:        "foo",
+			SourceVMName:  "source_foo",
+			SourceVMTag:   "v1",
+			Remotes:       []RegistryRemote{{Remote: "primary"}, {Remote: "https://down.example.com"}, {Remote: "https://mirror.example.com", CaRootPath: "/certs/ca.pem"}},
+			RemoteTimeout: "5s",
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		state.Put("config", config)
+
+		pullParams := client.RegistryPullParams{VMID: "source_foo", Tag: "v1"}
+		sourceShow := client.ShowResponse{UUID: "1234-abcdef-hijk-5678", Name: "source_foo", Version: "v1"}
+		mirror := client.RegistryParams{Remote: "https://mirror.example.com", CaRootPath: "/certs/ca.pem"}
+
+		gomock.InOrder(
+			ankaClient.EXPECT().Exists("source_foo").Return(false, nil).Times(1),
+			ankaClient.EXPECT().RegistryListRepos().Return([]client.RegistryRemote{{Name: "primary", Url: "http://anka.registry:8089"}}, nil).Times(1),
+			ankaClient.EXPECT().RegistryStatus(client.RegistryParams{Remote: "http://anka.registry:8089"}, 5*time.Second).Return(nil).Times(1),
+			ankaClient.EXPECT().RegistryPull(client.RegistryParams{Remote: "primary"}, pullParams).Return(fmt.Errorf("connection reset")).Times(1),
+			ankaClient.EXPECT().RegistryStatus(client.RegistryParams{Remote: "https://down.example.com"}, 5*time.Second).Return(fmt.Errorf("timed out")).Times(1),
+			ankaClient.EXPECT().RegistryStatus(mirror, 5*time.Second).Return(nil).Times(1),
+			ankaClient.EXPECT().RegistryPull(mirror, pullParams).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(sourceShow, nil).Times(1),
+			ankaClient.EXPECT().Clone(client.CloneParams{VMName: "foo", SourceUUID: sourceShow.UUID}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("foo").Return(clonedShowResponse, nil).Times(1),
+		)
+
+		mockui := &packer.MockUi{}
+		state.Put("ui", mockui)
+		defer state.Put("ui", ui)
+
+		stepAction := step.Run(ctx, state)
+
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+		assert.Equal(t, "Failed to pull source_foo from registry remote primary: connection reset", mockui.SayMessages[1].Message)
+		assert.Equal(t, "Skipping registry remote https://down.example.com: timed out", mockui.SayMessages[2].Message)
+		assert.Equal(t, "Pulled source VM source_foo from registry remote https://mirror.example.com", mockui.SayMessages[3].Message)
+		assert.Equal(t, "https://mirror.example.com", state.Get("source_remote"))
+	})
+
+	t.Run("clone vm with remotes that all fail", func(t *testing.T) {
+		config := &Config{
+			VMName:        "foo",
+			SourceVMName:  "source_foo",
+			AlwaysFetch:   true,
+			Remotes:       []RegistryRemote{{Remote: "unknown"}, {Remote: "https://down.example.com"}},
+			RemoteTimeout: "5s",
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		state.Put("config", config)
+
+		expectedErr := fmt.Errorf("failed to pull vm source_foo with latest tag: no registry remote could pull source_foo (unknown: not a configured registry remote (add it with anka registry add); https://down.example.com: timed out)")
+
+		gomock.InOrder(
+			ankaClient.EXPECT().RegistryListRepos().Return([]client.RegistryRemote{}, nil).Times(1),
+			ankaClient.EXPECT().RegistryStatus(client.RegistryParams{Remote: "https://down.example.com"}, 5*time.Second).Return(fmt.Errorf("timed out")).Times(1),
+			ankaUtil.EXPECT().StepError(ui, state, gomock.Any()).DoAndReturn(func(_ packer.Ui, _ multistep.StateBag, err error) multistep.StepAction {
+				assert.Error(t, err, expectedErr.Error())
+				return multistep.ActionHalt
+			}).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionHalt, stepAction)
+	})
+
+	t.Run("clone vm with pull_verify deletes and pulls a corrupt source again", func(t *testing.T) {
+		config := &Config{
+			VMName:       "foo",
+			SourceVMName: "source_foo",
+			SourceVMTag:  "v1",
+			AlwaysFetch:  true,
+			PullLocal:    true,
+			PullShrink:   true,
+			PullVerify:   true,
+			PullAttempts: 2,
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		state.Put("config", config)
+
+		pullParams := client.RegistryPullParams{VMID: "source_foo", Tag: "v1", Local: true, Shrink: true}
+		describe := client.RegistryDescribeResponse{
+			ID:       "1234-abcdef-hijk-5678",
+			Versions: []client.RegistryDescribeVersion{{Tag: "v1", Number: 0, ImageID: "image-v1"}, {Tag: "v2", Number: 1}},
+		}
+		corruptShow := client.ShowResponse{UUID: "1234-abcdef-hijk-5678", Name: "source_foo", Version: "v1", ImageID: "image-partial"}
+		pulledShow := client.ShowResponse{UUID: "1234-abcdef-hijk-5678", Name: "source_foo", Version: "v1", ImageID: "image-v1"}
+
+		gomock.InOrder(
+			ankaClient.EXPECT().RegistryPull(client.RegistryParams{}, pullParams).Return(nil).Times(1),
+			ankaClient.EXPECT().RegistryDescribe(client.RegistryParams{}, "source_foo").Return(describe, nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(corruptShow, nil).Times(1),
+			ankaClient.EXPECT().Delete(client.DeleteParams{VMName: "source_foo"}).Return(nil).Times(1),
+			ankaClient.EXPECT().RegistryPull(client.RegistryParams{}, pullParams).Return(nil).Times(1),
+			ankaClient.EXPECT().RegistryDescribe(client.RegistryParams{}, "source_foo").Return(describe, nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(pulledShow, nil).Times(2),
+			ankaClient.EXPECT().Clone(client.CloneParams{VMName: "foo", SourceUUID: pulledShow.UUID}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("foo").Return(clonedShowResponse, nil).Times(1),
+		)
+
+		mockui := &packer.MockUi{}
+		state.Put("ui", mockui)
+		defer state.Put("ui", ui)
+
+		stepAction := step.Run(ctx, state)
+
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+		assert.Equal(t, "Pulled source VM source_foo doesn't match the registry (image image-partial, registry has image-v1), deleting it and pulling again", mockui.SayMessages[1].Message)
+	})
+
+	t.Run("clone vm with pull_verify gives up after pull_attempts", func(t *testing.T) {
+		config := &Config{
+			VMName:       "foo",
+			SourceVMName: "source_foo",
+			AlwaysFetch:  true,
+			PullVerify:   true,
+			PullAttempts: 1,
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		state.Put("config", config)
+
+		describe := client.RegistryDescribeResponse{
+			ID:       "1234-abcdef-hijk-5678",
+			Versions: []client.RegistryDescribeVersion{{Tag: "v1", Number: 0}, {Tag: "v2", Number: 1}},
+		}
+		pulledShow := client.ShowResponse{UUID: "9999-abcdef-hijk-5678", Name: "source_foo", Version: "v1"}
+		expectedErr := fmt.Errorf(`pulled source VM source_foo still doesn't match the registry after pull_attempts = 1 (UUID 9999-abcdef-hijk-5678, registry has 1234-abcdef-hijk-5678, tag "v1", registry has v2)`)
+
+		gomock.InOrder(
+			ankaClient.EXPECT().RegistryPull(client.RegistryParams{}, client.RegistryPullParams{VMID: "source_foo"}).Return(nil).Times(1),
+			ankaClient.EXPECT().RegistryDescribe(client.RegistryParams{}, "source_foo").Return(describe, nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(pulledShow, nil).Times(1),
+			ankaUtil.EXPECT().StepError(ui, state, gomock.Any()).DoAndReturn(func(_ packer.Ui, _ multistep.StateBag, err error) multistep.StepAction {
+				assert.Error(t, err, expectedErr.Error())
+				return multistep.ActionHalt
+			}).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionHalt, stepAction)
+	})
+
+	t.Run("clone vm with fetch_policy if_newer pulls a stale local source", func(t *testing.T) {
+		config := &Config{
+			VMName:       "foo",
+			SourceVMName: "source_foo",
+			FetchPolicy:  fetchPolicyIfNewer,
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		state.Put("config", config)
+
+		describe := client.RegistryDescribeResponse{
+			Versions: []client.RegistryDescribeVersion{{Tag: "v1", Number: 0}, {Tag: "v2", Number: 1}},
+		}
+		localShow := client.ShowResponse{UUID: "1234-abcdef-hijk-5678", Name: "source_foo", Version: "v1"}
+		pulledShow := client.ShowResponse{UUID: "1234-abcdef-hijk-5678", Name: "source_foo", Version: "v2"}
+
+		gomock.InOrder(
+			ankaClient.EXPECT().Exists("source_foo").Return(true, nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(localShow, nil).Times(1),
+			ankaClient.EXPECT().RegistryDescribe(client.RegistryParams{}, "source_foo").Return(describe, nil).Times(1),
+			ankaClient.EXPECT().RegistryPull(client.RegistryParams{}, client.RegistryPullParams{VMID: "source_foo"}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(pulledShow, nil).Times(1),
+			ankaClient.EXPECT().Clone(client.CloneParams{VMName: "foo", SourceUUID: pulledShow.UUID}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("foo").Return(clonedShowResponse, nil).Times(1),
+		)
+
+		mockui := &packer.MockUi{}
+		state.Put("ui", mockui)
+		defer state.Put("ui", ui)
+
+		stepAction := step.Run(ctx, state)
+
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+		assert.Equal(t, `Local source VM source_foo is out of date (local tag "v1", registry has v2), pulling it`, mockui.SayMessages[0].Message)
+	})
+
+	t.Run("clone vm with fetch_policy if_newer keeps an up to date local source", func(t *testing.T) {
+		config := &Config{
+			VMName:       "foo",
+			SourceVMName: "source_foo",
+			SourceVMTag:  "v1",
+			FetchPolicy:  fetchPolicyIfNewer,
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		state.Put("config", config)
+
+		describe := client.RegistryDescribeResponse{
+			Versions: []client.RegistryDescribeVersion{{Tag: "v1", Number: 0, ImageID: "img-1"}, {Tag: "v2", Number: 1, ImageID: "img-2"}},
+		}
+		localShow := client.ShowResponse{UUID: "1234-abcdef-hijk-5678", Name: "source_foo", Version: "v1", ImageID: "img-1"}
+
+		gomock.InOrder(
+			ankaClient.EXPECT().Exists("source_foo").Return(true, nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(localShow, nil).Times(1),
+			ankaClient.EXPECT().RegistryDescribe(client.RegistryParams{}, "source_foo").Return(describe, nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(localShow, nil).Times(1),
+			ankaClient.EXPECT().Clone(client.CloneParams{VMName: "foo", SourceUUID: localShow.UUID}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("foo").Return(clonedShowResponse, nil).Times(1),
+		)
+
+		mockui := &packer.MockUi{}
+		state.Put("ui", mockui)
+		defer state.Put("ui", ui)
+
+		stepAction := step.Run(ctx, state)
+
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+		assert.Equal(t, "Local source VM source_foo is up to date with the registry (tag v1), not pulling it", mockui.SayMessages[0].Message)
+	})
+
+	t.Run("clone vm with fetch_policy never and no local source", func(t *testing.T) {
+		config := &Config{
+			VMName:       "foo",
+			SourceVMName: "source_foo",
+			FetchPolicy:  fetchPolicyNever,
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		state.Put("config", config)
+
+		expectedErr := fmt.Errorf("source VM source_foo does not exist locally and fetch_policy is never")
+
+		gomock.InOrder(
+			ankaClient.EXPECT().Exists("source_foo").Return(false, nil).Times(1),
+			ankaUtil.EXPECT().StepError(ui, state, gomock.Any()).DoAndReturn(func(_ packer.Ui, _ multistep.StateBag, err error) multistep.StepAction {
+				assert.Error(t, err, expectedErr.Error())
+				return multistep.ActionHalt
+			}).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionHalt, stepAction)
+	})
+
+	t.Run("[ARM] clone vm fails when the local tag can't be created", func(t *testing.T) {
+		config := &Config{
+			VMName:       "foo",
+			SourceVMName: "source_foo",
+			HostArch:     "arm64",
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		capabilities, _ = client.NewCapabilities("3.0.0")
+		state.Put("config", config)
+
+		expectedErr := fmt.Errorf("failed to create local tag local-tag-123 on source VM source_foo: tag already exists")
+
+		gomock.InOrder(
+			ankaClient.EXPECT().Exists("source_foo").Return(true, nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(sourceShowResponse, nil).Times(1),
+			ankaUtil.EXPECT().RandSeq(10).Return("123").Times(1),
+			ankaClient.EXPECT().RegistryPush(client.RegistryParams{HostArch: "arm64"}, gomock.Any()).Return(fmt.Errorf("tag already exists")).Times(1),
+			ankaUtil.EXPECT().StepError(ui, state, gomock.Any()).DoAndReturn(func(_ packer.Ui, _ multistep.StateBag, err error) multistep.StepAction {
+				assert.Error(t, err, expectedErr.Error())
+				return multistep.ActionHalt
+			}).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionHalt, stepAction)
+	})
+
+	t.Run("[ARM] clone vm with local_tag prunes the oldest local tags", func(t *testing.T) {
+		config := &Config{
+			VMName:       "foo",
+			SourceVMName: "source_foo",
+			HostArch:     "arm64",
+			LocalTag:     "packer-{{ .SourceName }}-{{ .Random }}",
+			LocalTagKeep: 2,
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		capabilities, _ = client.NewCapabilities("3.0.0")
+		state.Put("config", config)
+
+		record, err := newLocalTagRecord(sourceShowResponse.UUID)
+		assert.NilError(t, err)
+		assert.NilError(t, record.Save([]localTag{
+			{Tag: "packer-source_foo-1", Clones: []string{"deleted-clone"}},
+			{Tag: "packer-source_foo-2"},
+		}))
+
+		gomock.InOrder(
+			ankaClient.EXPECT().Exists("source_foo").Return(true, nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(sourceShowResponse, nil).Times(1),
+			ankaUtil.EXPECT().RandSeq(10).Return("3").Times(1),
+			ankaClient.EXPECT().RegistryPush(client.RegistryParams{HostArch: "arm64"}, client.RegistryPushParams{Tag: "packer-source_foo-3", Local: true, VMID: "source_foo"}).Return(nil).Times(1),
+			ankaClient.EXPECT().List().Return([]client.ListResponse{{Name: "source_foo", UUID: sourceShowResponse.UUID}}, nil).Times(1),
+			ankaClient.EXPECT().Delete(client.DeleteParams{VMName: "source_foo", Tag: "packer-source_foo-1"}).Return(nil).Times(1),
+			ankaClient.EXPECT().Clone(client.CloneParams{VMName: "foo", SourceUUID: sourceShowResponse.UUID}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("foo").Return(clonedShowResponse, nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+
+		tags, err := record.Load()
+		assert.NilError(t, err)
+		assert.DeepEqual(t, []localTag{
+			{Tag: "packer-source_foo-2"},
+			{Tag: "packer-source_foo-3", Clones: []string{clonedShowResponse.UUID}},
+		}, tags)
+	})
+
+	t.Run("[ARM] clone vm with local_tag keeps local tags linked clones still use", func(t *testing.T) {
+		config := &Config{
+			VMName:       "foo",
+			SourceVMName: "source_foo",
+			HostArch:     "arm64",
+			LocalTag:     "packer-{{ .SourceName }}-{{ .Random }}",
+			LocalTagKeep: 1,
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		capabilities, _ = client.NewCapabilities("3.0.0")
+		state.Put("config", config)
+
+		record, err := newLocalTagRecord(sourceShowResponse.UUID)
+		assert.NilError(t, err)
+		assert.NilError(t, record.Save([]localTag{
+			{Tag: "packer-source_foo-1", Clones: []string{"clone-1", "deleted-clone"}},
+			{Tag: "packer-source_foo-2"},
+		}))
+
+		gomock.InOrder(
+			ankaClient.EXPECT().Exists("source_foo").Return(true, nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(sourceShowResponse, nil).Times(1),
+			ankaUtil.EXPECT().RandSeq(10).Return("3").Times(1),
+			ankaClient.EXPECT().RegistryPush(client.RegistryParams{HostArch: "arm64"}, client.RegistryPushParams{Tag: "packer-source_foo-3", Local: true, VMID: "source_foo"}).Return(nil).Times(1),
+			ankaClient.EXPECT().List().Return([]client.ListResponse{{Name: "template-1", UUID: "clone-1"}}, nil).Times(1),
+			ankaClient.EXPECT().Delete(client.DeleteParams{VMName: "source_foo", Tag: "packer-source_foo-2"}).Return(nil).Times(1),
+			ankaClient.EXPECT().Clone(client.CloneParams{VMName: "foo", SourceUUID: sourceShowResponse.UUID}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("foo").Return(clonedShowResponse, nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+
+		tags, err := record.Load()
+		assert.NilError(t, err)
+		assert.DeepEqual(t, []localTag{
+			{Tag: "packer-source_foo-1", Clones: []string{"clone-1"}},
+			{Tag: "packer-source_foo-3", Clones: []string{clonedShowResponse.UUID}},
+		}, tags)
+	})
+
+	t.Run("[ARM] clone vm with clone_mode full copies an untagged source", func(t *testing.T) {
+		config := &Config{
+			VMName:       "foo",
+			SourceVMName: "source_foo",
+			HostArch:     "arm64",
+			CloneMode:    cloneModeFull,
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		capabilities, _ = client.NewCapabilities("3.0.0")
+		state.Put("config", config)
+
+		gomock.InOrder(
+			ankaClient.EXPECT().Exists("source_foo").Return(true, nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(sourceShowResponse, nil).Times(1),
+			ankaClient.EXPECT().Clone(client.CloneParams{VMName: "foo", SourceUUID: sourceShowResponse.UUID, Copy: true}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("foo").Return(clonedShowResponse, nil).Times(1),
+		)
+
+		mockui := &packer.MockUi{}
+		state.Put("ui", mockui)
+		defer state.Put("ui", ui)
+
+		stepAction := step.Run(ctx, state)
+
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+		assert.Equal(t, "Copying source VM source_foo into a new virtual machine: foo", mockui.SayMessages[1].Message)
+	})
+
+	t.Run("[ARM] clone vm with create_local_tag disabled", func(t *testing.T) {
+		createLocalTag := false
+		config := &Config{
+			VMName:         "foo",
+			SourceVMName:   "source_foo",
+			HostArch:       "arm64",
+			CreateLocalTag: &createLocalTag,
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		capabilities, _ = client.NewCapabilities("3.0.0")
+		state.Put("config", config)
+
+		gomock.InOrder(
+			ankaClient.EXPECT().Exists("source_foo").Return(true, nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(sourceShowResponse, nil).Times(1),
+			ankaClient.EXPECT().Clone(client.CloneParams{VMName: "foo", SourceUUID: sourceShowResponse.UUID}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("foo").Return(clonedShowResponse, nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+	})
+
+	t.Run("clone vm with build_cache and no earlier build", func(t *testing.T) {
+		createLocalTag := false
+		config := &Config{
+			VMName:         "foo",
+			SourceVMName:   "source_foo",
+			CreateLocalTag: &createLocalTag,
+			BuildCache:     true,
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		state.Put("config", config)
+
+		gomock.InOrder(
+			ankaClient.EXPECT().Exists("source_foo").Return(true, nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(sourceShowResponse, nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(sourceShowResponse, nil).Times(1),
+			ankaClient.EXPECT().Clone(client.CloneParams{VMName: "foo", SourceUUID: sourceShowResponse.UUID}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("foo").Return(clonedShowResponse, nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+
+		_, hit := state.GetOk("build_cache_hit")
+		assert.Equal(t, hit, false)
+		_, ok := state.GetOk("build_cache_fingerprint")
+		assert.Equal(t, ok, true)
+	})
+
+	t.Run("clone vm with build_cache skips an unchanged build", func(t *testing.T) {
+		createLocalTag := false
+		config := &Config{
+			VMName:         "foo",
+			SourceVMName:   "source_foo",
+			CreateLocalTag: &createLocalTag,
+			BuildCache:     true,
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		state.Put("config", config)
+		defer state.Remove("build_cache_hit")
+
+		fingerprint, err := buildFingerprint(config, buildCacheCloneSource(sourceShowResponse.UUID, sourceShowResponse.Version, sourceShowResponse.ImageID), "")
+		assert.NilError(t, err)
+
+		cache, err := newBuildCache()
+		assert.NilError(t, err)
+		assert.NilError(t, cache.Save(buildCacheRecord{Fingerprint: fingerprint, VMName: "foo-cached", VMID: "cached-uuid"}))
+
+		gomock.InOrder(
+			ankaClient.EXPECT().Exists("source_foo").Return(true, nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(sourceShowResponse, nil).Times(1),
+			ankaClient.EXPECT().Show("foo-cached").Return(client.ShowResponse{Name: "foo-cached", UUID: "cached-uuid", Status: "stopped"}, nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+		assert.Equal(t, step.vmName, "")
+		assert.Equal(t, state.Get("vm_name"), "foo-cached")
+		assert.Equal(t, state.Get("build_cache_hit").(buildCacheRecord).VMID, "cached-uuid")
+	})
+
+	t.Run("clone vm with build_cache builds again when the cached VM is gone", func(t *testing.T) {
+		createLocalTag := false
+		config := &Config{
+			VMName:         "foo",
+			SourceVMName:   "source_foo",
+			CreateLocalTag: &createLocalTag,
+			BuildCache:     true,
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		state.Put("config", config)
+
+		fingerprint, err := buildFingerprint(config, buildCacheCloneSource(sourceShowResponse.UUID, sourceShowResponse.Version, sourceShowResponse.ImageID), "")
+		assert.NilError(t, err)
+
+		cache, err := newBuildCache()
+		assert.NilError(t, err)
+		assert.NilError(t, cache.Save(buildCacheRecord{Fingerprint: fingerprint, VMName: "foo-cached", VMID: "cached-uuid"}))
+
+		gomock.InOrder(
+			ankaClient.EXPECT().Exists("source_foo").Return(true, nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(sourceShowResponse, nil).Times(1),
+			ankaClient.EXPECT().Show("foo-cached").Return(client.ShowResponse{}, fmt.Errorf("vm foo-cached not found")).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(sourceShowResponse, nil).Times(1),
+			ankaClient.EXPECT().Clone(client.CloneParams{VMName: "foo", SourceUUID: sourceShowResponse.UUID}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("foo").Return(clonedShowResponse, nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+
+		_, found, err := cache.Load(fingerprint)
+		assert.NilError(t, err)
+		assert.Equal(t, found, false)
+	})
+
+	t.Run("clone vm with build_cache builds again when the cached VM left its final_state", func(t *testing.T) {
+		createLocalTag := false
+		config := &Config{
+			VMName:         "foo",
+			SourceVMName:   "source_foo",
+			CreateLocalTag: &createLocalTag,
+			BuildCache:     true,
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		state.Put("config", config)
+
+		fingerprint, err := buildFingerprint(config, buildCacheCloneSource(sourceShowResponse.UUID, sourceShowResponse.Version, sourceShowResponse.ImageID), "")
+		assert.NilError(t, err)
+
+		cache, err := newBuildCache()
+		assert.NilError(t, err)
+		assert.NilError(t, cache.Save(buildCacheRecord{Fingerprint: fingerprint, VMName: "foo-cached", VMID: "cached-uuid", FinalState: finalStateSuspend}))
+
+		gomock.InOrder(
+			ankaClient.EXPECT().Exists("source_foo").Return(true, nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(sourceShowResponse, nil).Times(1),
+			ankaClient.EXPECT().Show("foo-cached").Return(client.ShowResponse{Name: "foo-cached", UUID: "cached-uuid", Status: "stopped"}, nil).Times(1),
+			ankaClient.EXPECT().Show("source_foo").Return(sourceShowResponse, nil).Times(1),
+			ankaClient.EXPECT().Clone(client.CloneParams{VMName: "foo", SourceUUID: sourceShowResponse.UUID}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("foo").Return(clonedShowResponse, nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+
+		_, found, err := cache.Load(fingerprint)
+		assert.NilError(t, err)
+		assert.Equal(t, found, false)
+	})
+
+	t.Run("clone vm with build_cache checks the cache before pulling", func(t *testing.T) {
+		createLocalTag := false
+		config := &Config{
+			VMName:         "foo",
+			SourceVMName:   "source_foo",
+			CreateLocalTag: &createLocalTag,
+			BuildCache:     true,
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-clone",
+			},
+		}
+
+		state.Put("config", config)
+		defer state.Remove("build_cache_hit")
+
+		describe := client.RegistryDescribeResponse{
+			ID:       sourceShowResponse.UUID,
+			Name:     "source_foo",
+			Versions: []client.RegistryDescribeVersion{{Tag: "v1", Number: 1, ImageID: "image-1"}},
+		}
+
+		fingerprint, err := buildFingerprint(config, buildCacheCloneSource(sourceShowResponse.UUID, "v1", "image-1"), "")
+		assert.NilError(t, err)
+
+		cache, err := newBuildCache()
+		assert.NilError(t, err)
+		assert.NilError(t, cache.Save(buildCacheRecord{Fingerprint: fingerprint, VMName: "foo-cached", VMID: "cached-uuid"}))
+
+		gomock.InOrder(
+			ankaClient.EXPECT().Exists("source_foo").Return(false, nil).Times(1),
+			ankaClient.EXPECT().RegistryDescribe(client.RegistryParams{}, "source_foo").Return(describe, nil).Times(1),
+			ankaClient.EXPECT().Show("foo-cached").Return(client.ShowResponse{Name: "foo-cached", UUID: "cached-uuid", Status: "stopped"}, nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+		assert.Equal(t, state.Get("vm_name"), "foo-cached")
+	})
 }
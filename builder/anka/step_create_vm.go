@@ -5,8 +5,7 @@ import (
 	"fmt"
 	"log"
 	"regexp"
-	"strconv"
-	"strings"
+	"time"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
@@ -17,8 +16,11 @@ import (
 
 // StepCreateVM will be used to run the create step for an 'vm-create' builder types
 type StepCreateVM struct {
-	client client.Client
-	vmName string
+	client              client.Client
+	vmName              string
+	detachHardDrives    []int
+	detachOpticalDrives []string
+	hostPorts           map[string]int
 }
 
 // Run creates a new vm from a local installer app
@@ -31,57 +33,112 @@ func (s *StepCreateVM) Run(ctx context.Context, state multistep.StateBag) multis
 	}
 
 	s.client = state.Get("client").(client.Client)
-	s.vmName = config.VMName
+	// Cleanup deletes s.vmName, so it's only set once this build has created it. Until then the
+	// name may be another build's, such as one holding the vm_name lock.
+	s.vmName = ""
+	vmName := config.VMName
 
-	if s.vmName == "" {
-		matchInstaller, err := regexp.Match(".app(/?)$|.ipsw(/?)$", []byte(config.Installer))
+	installer, downloadURL, err := s.resolveCreateInstaller(config, ui)
+	if err != nil {
+		return onError(err)
+	}
+
+	// The build cache is checked before the installer is downloaded
+	if config.BuildCache {
+		var source string
+		installer, source, err = buildCacheCreateSource(config, installer, ankaUtil)
 		if err != nil {
 			return onError(err)
 		}
-		if matchInstaller {
-			if config.HostArch == "arm64" {
-				installerData := util.InstallerIPSWPlist{}
-				installerData, err = ankaUtil.ObtainMacOSVersionFromInstallerIPSW(config.Installer)
-				if err != nil {
-					return onError(err)
-				}
-				s.vmName = fmt.Sprintf("anka-packer-base-%s-%s", installerData.ProductVersion, installerData.ProductBuildVersion)
-			} else {
-				installerData := util.InstallerAppPlist{}
-				installerData, err = ankaUtil.ObtainMacOSVersionFromInstallerApp(config.Installer)
-				if err != nil {
-					return onError(err)
-				}
-				s.vmName = fmt.Sprintf("anka-packer-base-%s-%s", installerData.OSVersion, installerData.BundlerVersion)
+
+		if source == "" {
+			ui.Say(fmt.Sprintf("Not using the build cache, installer %s can't be identified before it's downloaded", describeInstallerSelection(config)))
+		} else {
+			hit, err := checkBuildCache(state, config, source)
+			if err != nil {
+				return onError(err)
 			}
+			if hit {
+				return multistep.ActionContinue
+			}
+		}
+	}
+
+	if downloadURL != "" {
+		installer.Path, err = fetchInstaller(ctx, ui, hostLocksFrom(state), downloadURL, config.InstallerChecksum)
+		if err != nil {
+			return onError(err)
+		}
+	}
+
+	if vmName == "" {
+		if config.InstallerURL == "" && !isInstallerPath(config.Installer) {
+			vmName = fmt.Sprintf("anka-packer-base-%s", config.Installer)
 		} else {
-			s.vmName = fmt.Sprintf("anka-packer-base-%s", config.Installer)
+			installer.OSVersion, installer.Build, err = installerVersion(installer, ankaUtil)
+			if err != nil {
+				return onError(err)
+			}
+			vmName = fmt.Sprintf("anka-packer-base-%s-%s", installer.OSVersion, installer.Build)
 		}
+	} else if isVMNameTemplate(vmName) {
+		data := newVMNameData(config.HostArch, ankaUtil.RandSeq(10), time.Now())
+
+		installer.OSVersion, installer.Build, err = installerVersion(installer, ankaUtil)
+		if err != nil {
+			return onError(err)
+		}
+		data.OSVersion, data.Build = installer.OSVersion, installer.Build
+
+		vmName, err = renderVMName(config, data)
+		if err != nil {
+			return onError(err)
+		}
+		ui.Say(fmt.Sprintf("Rendered vm_name %q to %s", config.VMName, vmName))
 	}
 
-	state.Put("vm_name", s.vmName)
+	state.Put("vm_name", vmName)
+	if installer.OSVersion != "" {
+		state.Put("installer_version", installer.OSVersion)
+		state.Put("installer_build", installer.Build)
+	}
+
+	err = hostLocksFrom(state).Acquire(ctx, hostLockVMName, vmName)
+	if err != nil {
+		return onError(err)
+	}
 
 	if config.PackerForce {
-		exists, err := s.client.Exists(s.vmName)
+		exists, err := s.client.Exists(vmName)
 		if err != nil {
 			return onError(err)
 		}
 		if exists {
-			ui.Say(fmt.Sprintf("Deleting existing virtual machine %s", s.vmName))
+			ui.Say(fmt.Sprintf("Deleting existing virtual machine %s", vmName))
 
-			err = s.client.Delete(client.DeleteParams{VMName: s.vmName})
+			err = s.client.Delete(client.DeleteParams{VMName: vmName})
 			if err != nil {
 				return onError(err)
 			}
 		}
 	}
 
-	err = s.createFromInstaller(ui, config)
+	resources, err := resolveVMResources(config, ankaUtil, 0)
+	if err != nil {
+		return onError(err)
+	}
+	if resources.differsFrom(config) {
+		ui.Say(fmt.Sprintf("Resolved VM resources: RAM %s, vCPUs %s, disk %s", resources.RAMSize, resources.VCPUCount, resources.DiskSize))
+	}
+	state.Put("vm_resources", resources)
+
+	err = s.createFromInstaller(ui, vmName, installer, resources)
 	if err != nil {
 		return onError(err)
 	}
+	s.vmName = vmName
 
-	createdShow, err := s.client.Show(s.vmName)
+	createdShow, err := s.client.Show(vmName)
 	if err != nil {
 		return onError(err)
 	}
@@ -93,21 +150,134 @@ func (s *StepCreateVM) Run(ctx context.Context, state multistep.StateBag) multis
 		return onError(err)
 	}
 
+	state.Put("detach_hard_drives", s.detachHardDrives)
+	state.Put("detach_optical_drives", s.detachOpticalDrives)
+	state.Put("host_ports", s.hostPorts)
+
 	return multistep.ActionContinue
 }
 
-func (s *StepCreateVM) createFromInstaller(ui packer.Ui, config *Config) error {
-	installerPathPattern := regexp.MustCompile(".app(/?)$|.ipsw(/?)$")
-	if !installerPathPattern.MatchString(config.Installer) {
-		resolvedInstallerVersion, resolvedInstallerBuild, foundResolvedInstaller, err := s.resolveInstaller(config.Installer)
+// createInstaller is what anka create installs from
+type createInstaller struct {
+	// Path is passed to anka create --app: an installer app or IPSW, or a macOS version
+	Path      string
+	OSVersion string
+	Build     string
+}
+
+var installerPathPattern = regexp.MustCompile(".app(/?)$|.ipsw(/?)$")
+
+// isInstallerPath reports whether installer is an installer app or IPSW rather than a macOS version
+func isInstallerPath(installer string) bool {
+	return installerPathPattern.MatchString(installer)
+}
+
+// resolveCreateInstaller works out what anka create installs from without downloading anything:
+// an installer app or IPSW, or an installer version pinned to the version and build anka lists
+// for it. It also returns the URL to download into the installer cache first, if any: installer_url,
+// or the IPSW of a version installer with an installer_checksum so anka creates the VM from exactly
+// that IPSW.
+func (s *StepCreateVM) resolveCreateInstaller(config *Config, ui packer.Ui) (createInstaller, string, error) {
+	if config.InstallerURL != "" {
+		return createInstaller{}, config.InstallerURL, nil
+	}
+
+	if isInstallerPath(config.Installer) {
+		return createInstaller{Path: config.Installer}, "", nil
+	}
+
+	available, found, err := s.resolveInstaller(config.Installer, config.InstallerBuild)
+	if err == nil && !found {
+		err = fmt.Errorf("installer %q is not one of the versions anka can download (see anka create --list)", describeInstallerSelection(config))
+	}
+	if err != nil {
+		// Only an exact version can be handed to anka create without knowing what it resolves to
+		if config.InstallerStrict || config.InstallerBuild != "" || config.InstallerChecksum != "" || isInstallerConstraint(config.Installer) {
+			return createInstaller{}, "", err
+		}
+		ui.Error(fmt.Sprintf("Warning: %s, passing it to anka create as is", err))
+		return createInstaller{Path: config.Installer}, "", nil
+	}
+	ui.Say(fmt.Sprintf("Resolved installer %q to macOS %s (%s)", describeInstallerSelection(config), available.Version, available.Build))
+
+	installer := createInstaller{
+		Path:      available.Version,
+		OSVersion: available.Version,
+		Build:     available.Build,
+	}
+
+	if config.InstallerChecksum != "" {
+		if available.URL == "" {
+			return installer, "", fmt.Errorf("anka has no download URL for macOS %s to verify installer_checksum against", available.Version)
+		}
+		return installer, available.URL, nil
+	}
+
+	return installer, "", nil
+}
+
+func fetchInstaller(ctx context.Context, ui packer.Ui, locker *hostLocker, installerURL string, checksum string) (string, error) {
+	parsedChecksum, err := parseInstallerChecksum(checksum)
+	if err != nil {
+		return "", err
+	}
+
+	cache, err := newInstallerCache(locker)
+	if err != nil {
+		return "", err
+	}
+
+	return cache.Fetch(ctx, ui, installerURL, parsedChecksum)
+}
+
+// buildCacheCreateSource identifies the installer for the build cache before it's downloaded: an
+// installer_url by its installer_checksum, anything else by its macOS version and build. Installer
+// apps and IPSWs on disk are read for their version, which is kept on the returned installer. An
+// empty source means the installer can't be identified yet, such as a bare macOS version anka
+// only resolves to a build once it downloads it.
+func buildCacheCreateSource(config *Config, installer createInstaller, ankaUtil util.Util) (createInstaller, string, error) {
+	if config.InstallerURL != "" {
+		checksum, err := parseInstallerChecksum(config.InstallerChecksum)
+		if err != nil || checksum.Value == "" {
+			return installer, "", err
+		}
+		return installer, fmt.Sprintf("create %s", checksum), nil
+	}
+
+	if installer.Build == "" && isInstallerPath(installer.Path) {
+		var err error
+		installer.OSVersion, installer.Build, err = installerVersion(installer, ankaUtil)
 		if err != nil {
-			ui.Error(fmt.Sprintf("Failed to resolve installer %q to a concrete macOS version: %s", config.Installer, err))
-		} else if foundResolvedInstaller {
-			ui.Say(fmt.Sprintf("Resolved installer %q to macOS %s (%s)", config.Installer, resolvedInstallerVersion, resolvedInstallerBuild))
+			return installer, "", err
 		}
 	}
+	if installer.Build == "" {
+		return installer, "", nil
+	}
+
+	return installer, fmt.Sprintf("create %s %s %s", installer.Path, installer.OSVersion, installer.Build), nil
+}
+
+// installerVersion is the macOS version and build of the installer, read from the installer app
+// or IPSW when anka didn't list them. Installer apps use their own version as the build.
+func installerVersion(installer createInstaller, ankaUtil util.Util) (string, string, error) {
+	if installer.OSVersion != "" {
+		return installer.OSVersion, installer.Build, nil
+	}
+
+	installerInfo, err := ankaUtil.ReadInstallerInfo(installer.Path)
+	if err != nil {
+		return "", "", err
+	}
+
+	if installerInfo.Kind == util.InstallerKindIPSW {
+		return installerInfo.OSVersion, installerInfo.Build, nil
+	}
+	return installerInfo.OSVersion, installerInfo.AppVersion, nil
+}
 
-	ui.Say(fmt.Sprintf("Creating a new VM Template (%s) from installer, this will take a while", s.vmName))
+func (s *StepCreateVM) createFromInstaller(ui packer.Ui, vmName string, installer createInstaller, resources vmResources) error {
+	ui.Say(fmt.Sprintf("Creating a new VM Template (%s) from installer, this will take a while", vmName))
 
 	outputStream := make(chan string)
 
@@ -118,11 +288,11 @@ func (s *StepCreateVM) createFromInstaller(ui packer.Ui, config *Config) error {
 	}()
 
 	createParams := client.CreateParams{
-		Installer: config.Installer,
-		Name:      s.vmName,
-		DiskSize:  config.DiskSize,
-		VCPUCount: config.VCPUCount,
-		RAMSize:   config.RAMSize,
+		Installer: installer.Path,
+		Name:      vmName,
+		DiskSize:  resources.DiskSize,
+		VCPUCount: resources.VCPUCount,
+		RAMSize:   resources.RAMSize,
 	}
 
 	createdVMUUID, err := s.client.Create(createParams, outputStream)
@@ -130,31 +300,29 @@ func (s *StepCreateVM) createFromInstaller(ui packer.Ui, config *Config) error {
 		return err
 	}
 
-	ui.Say(fmt.Sprintf("VM %s was created (%s)", s.vmName, createdVMUUID))
+	ui.Say(fmt.Sprintf("VM %s was created (%s)", vmName, createdVMUUID))
 
 	close(outputStream)
 
 	return nil
 }
 
-func (s *StepCreateVM) resolveInstaller(installer string) (string, string, bool, error) {
+// resolveInstaller finds latest, an installer version or a version constraint in anka's list of installers
+func (s *StepCreateVM) resolveInstaller(installer string, build string) (client.CreateInstallerListResponse, bool, error) {
 	availableInstallers, err := s.client.CreateInstallerList()
 	if err != nil {
-		return "", "", false, err
+		return client.CreateInstallerListResponse{}, false, fmt.Errorf("failed to list installers anka can download: %w", err)
 	}
 
-	resolvedInstallerSelection := strings.TrimSpace(strings.ToLower(installer))
-	for _, availableInstaller := range availableInstallers {
-		if resolvedInstallerSelection == "latest" && availableInstaller.Latest {
-			return availableInstaller.Version, availableInstaller.Build, true, nil
-		}
+	return selectInstaller(availableInstallers, installer, build)
+}
 
-		if strings.ToLower(strings.TrimSpace(availableInstaller.Version)) == resolvedInstallerSelection {
-			return availableInstaller.Version, availableInstaller.Build, true, nil
-		}
+// describeInstallerSelection is installer with the installer_build it's pinned to, for messages
+func describeInstallerSelection(config *Config) string {
+	if config.InstallerBuild == "" {
+		return config.Installer
 	}
-
-	return "", "", false, nil
+	return fmt.Sprintf("%s (%s)", config.Installer, config.InstallerBuild)
 }
 
 func (s *StepCreateVM) modifyVMProperties(showResponse client.ShowResponse, config *Config, ui packer.Ui) error {
@@ -163,35 +331,18 @@ func (s *StepCreateVM) modifyVMProperties(showResponse client.ShowResponse, conf
 	}
 
 	if len(config.PortForwardingRules) > 0 {
-		describeResponse, err := s.client.Describe(showResponse.Name)
+		hostPorts, err := applyPortForwardingRules(
+			s.client,
+			stopParams,
+			showResponse.Name,
+			config.PortForwardingRules,
+			config.PackerConfig.PackerForce,
+			ui,
+		)
 		if err != nil {
 			return err
 		}
-		existingForwardedPorts := make(map[int]struct{})
-		for _, existingNetworkCard := range describeResponse.NetworkCards {
-			for _, existingPortForwardingRule := range existingNetworkCard.PortForwardingRules {
-				existingForwardedPorts[existingPortForwardingRule.HostPort] = struct{}{}
-			}
-		}
-		for _, wantedPortForwardingRule := range config.PortForwardingRules {
-			ui.Say(fmt.Sprintf("Ensuring %s port-forwarding (Guest Port: %s, Host Port: %s, Rule Name: %s)", showResponse.Name, strconv.Itoa(wantedPortForwardingRule.PortForwardingGuestPort), strconv.Itoa(wantedPortForwardingRule.PortForwardingHostPort), wantedPortForwardingRule.PortForwardingRuleName))
-			if _, ok := existingForwardedPorts[wantedPortForwardingRule.PortForwardingHostPort]; ok {
-				if wantedPortForwardingRule.PortForwardingHostPort > 0 {
-					ui.Error(fmt.Sprintf("Found an existing host port rule (%s)! Skipping without setting...", strconv.Itoa(wantedPortForwardingRule.PortForwardingHostPort)))
-					continue
-				}
-			}
-			err := s.client.Stop(stopParams)
-			if err != nil {
-				return err
-			}
-			err = s.client.Modify(showResponse.Name, "add", "port-forwarding", "--host-port", strconv.Itoa(wantedPortForwardingRule.PortForwardingHostPort), "--guest-port", strconv.Itoa(wantedPortForwardingRule.PortForwardingGuestPort), wantedPortForwardingRule.PortForwardingRuleName)
-			if !config.PackerConfig.PackerForce {
-				if err != nil {
-					return err
-				}
-			}
-		}
+		s.hostPorts = hostPorts
 	}
 
 	if config.HWUUID != "" {
@@ -232,6 +383,22 @@ func (s *StepCreateVM) modifyVMProperties(showResponse client.ShowResponse, conf
 		}
 	}
 
+	if len(config.AdditionalDisks) > 0 {
+		detachHardDrives, err := applyAdditionalDisks(s.client, stopParams, showResponse.Name, config.AdditionalDisks, ui)
+		if err != nil {
+			return err
+		}
+		s.detachHardDrives = detachHardDrives
+	}
+
+	if len(config.OpticalDrives) > 0 {
+		detachOpticalDrives, err := applyOpticalDrives(s.client, stopParams, showResponse.Name, config.OpticalDrives, ui)
+		if err != nil {
+			return err
+		}
+		s.detachOpticalDrives = detachOpticalDrives
+	}
+
 	return nil
 }
 
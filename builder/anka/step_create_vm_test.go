@@ -4,7 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/golang/mock/gomock"
@@ -48,9 +52,10 @@ func TestCreateVMRun(t *testing.T) {
 	ui := packer.TestUi(t)
 	ctx := context.Background()
 	state := new(multistep.BasicStateBag)
-	InstallerInfo := util.InstallerAppPlist{
-		OSVersion:      "11.2",
-		BundlerVersion: "16.4.06",
+	InstallerInfo := util.InstallerInfo{
+		Kind:       util.InstallerKindApp,
+		OSVersion:  "11.2",
+		AppVersion: "16.4.06",
 	}
 
 	state.Put("ui", ui)
@@ -247,7 +252,7 @@ func TestCreateVMRun(t *testing.T) {
 
 		state.Put("config", config)
 
-		step.vmName = fmt.Sprintf("anka-packer-base-%s-%s", InstallerInfo.OSVersion, InstallerInfo.BundlerVersion)
+		step.vmName = fmt.Sprintf("anka-packer-base-%s-%s", InstallerInfo.OSVersion, InstallerInfo.AppVersion)
 		state.Put("vm_name", step.vmName)
 
 		createParams := client.CreateParams{
@@ -259,7 +264,7 @@ func TestCreateVMRun(t *testing.T) {
 		}
 
 		gomock.InOrder(
-			ankaUtil.EXPECT().ObtainMacOSVersionFromInstallerApp(config.Installer).Return(InstallerInfo, nil).Times(1),
+			ankaUtil.EXPECT().ReadInstallerInfo(config.Installer).Return(InstallerInfo, nil).Times(1),
 			ankaClient.EXPECT().Create(createParams, gomock.Any()).Return(createdVMUUID, nil).Times(1),
 			ankaClient.EXPECT().Show(step.vmName).Return(createdShowResponse, nil).Times(1),
 		)
@@ -274,6 +279,75 @@ func TestCreateVMRun(t *testing.T) {
 		assert.Equal(t, multistep.ActionContinue, stepAction)
 	})
 
+	t.Run("create vm with a vm_name template", func(t *testing.T) {
+		config := &Config{
+			VMName:    "team-{{ .OSVersion }}-{{ .Build }}-{{ .Arch }}",
+			DiskSize:  "500G",
+			VCPUCount: "32G",
+			RAMSize:   "16G",
+			Installer: "/fake/InstallApp.app/",
+			HostArch:  "arm64",
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-create",
+			},
+		}
+
+		state.Put("config", config)
+
+		createParams := client.CreateParams{
+			Installer: config.Installer,
+			Name:      "team-11.2-16.4.06-arm64",
+			DiskSize:  config.DiskSize,
+			VCPUCount: config.VCPUCount,
+			RAMSize:   config.RAMSize,
+		}
+
+		gomock.InOrder(
+			ankaUtil.EXPECT().RandSeq(10).Return("ABCDEabcde").Times(1),
+			ankaUtil.EXPECT().ReadInstallerInfo(config.Installer).Return(InstallerInfo, nil).Times(1),
+			ankaClient.EXPECT().Create(createParams, gomock.Any()).Return(createdVMUUID, nil).Times(1),
+			ankaClient.EXPECT().Show("team-11.2-16.4.06-arm64").Return(createdShowResponse, nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+		assert.Equal(t, "team-11.2-16.4.06-arm64", state.Get("vm_name"))
+	})
+
+	t.Run("create vm with a vm_name template resolves installer versions", func(t *testing.T) {
+		config := &Config{
+			VMName:    "base-{{ .OSVersion }}-{{ .Build }}",
+			DiskSize:  "500G",
+			VCPUCount: "32G",
+			RAMSize:   "16G",
+			Installer: "13.5",
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-create",
+			},
+		}
+
+		state.Put("config", config)
+
+		createParams := client.CreateParams{
+			Installer: config.Installer,
+			Name:      "base-13.5-22G74",
+			DiskSize:  config.DiskSize,
+			VCPUCount: config.VCPUCount,
+			RAMSize:   config.RAMSize,
+		}
+
+		gomock.InOrder(
+			ankaClient.EXPECT().CreateInstallerList().Return(availableInstallers, nil).Times(1),
+			ankaUtil.EXPECT().RandSeq(10).Return("ABCDEabcde").Times(1),
+			ankaClient.EXPECT().Create(createParams, gomock.Any()).Return(createdVMUUID, nil).Times(1),
+			ankaClient.EXPECT().Show("base-13.5-22G74").Return(createdShowResponse, nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+		assert.Equal(t, "base-13.5-22G74", state.Get("vm_name"))
+	})
+
 	t.Run("create vm with modify vm properties", func(t *testing.T) {
 
 		err = json.Unmarshal(json.RawMessage(`{ "Name": "anka-packer-base-latest", "UUID": "1234-hijk-abcdef-5678" }`), &createdShowResponse)
@@ -318,8 +392,9 @@ func TestCreateVMRun(t *testing.T) {
 		step.vmName = fmt.Sprintf("anka-packer-base-%s", config.Installer)
 		state.Put("vm_name", step.vmName)
 
+		// latest is pinned to the version anka lists for it
 		createParams := client.CreateParams{
-			Installer: config.Installer,
+			Installer: "26.4",
 			Name:      step.vmName,
 			DiskSize:  config.DiskSize,
 			VCPUCount: config.VCPUCount,
@@ -332,6 +407,12 @@ func TestCreateVMRun(t *testing.T) {
 
 		state.Put("config", &config)
 
+		forwardedDescribeResponse := client.DescribeResponse{
+			NetworkCards: []client.DescribeNetworkCard{
+				{PortForwardingRules: []client.DescribePortForwardingRule{{GuestPort: 8080, HostPort: 80, RuleName: "rule1"}}},
+			},
+		}
+
 		gomock.InOrder(
 			ankaClient.EXPECT().CreateInstallerList().Return(availableInstallers, nil).Times(1),
 			ankaClient.EXPECT().Create(createParams, gomock.Any()).Return(createdVMUUID, nil).Times(1),
@@ -342,6 +423,7 @@ func TestCreateVMRun(t *testing.T) {
 				Modify(createdShowResponse.Name, "add", "port-forwarding", "--host-port", strconv.Itoa(config.PortForwardingRules[0].PortForwardingHostPort), "--guest-port", strconv.Itoa(config.PortForwardingRules[0].PortForwardingGuestPort), "rule1").
 				Return(nil).
 				Times(1),
+			ankaClient.EXPECT().Describe(step.vmName).Return(forwardedDescribeResponse, nil).Times(1),
 			ankaClient.EXPECT().Stop(stopParams).Return(nil).Times(1),
 			ankaClient.EXPECT().Modify(createdShowResponse.Name, "set", "custom-variable", "hw.uuid", config.HWUUID).Return(nil).Times(1),
 			ankaClient.EXPECT().Stop(stopParams).Return(nil).Times(1),
@@ -366,4 +448,216 @@ func TestCreateVMRun(t *testing.T) {
 		assert.Equal(t, multistep.ActionContinue, stepAction)
 
 	})
+
+	t.Run("create vm from installer_url", func(t *testing.T) {
+		t.Setenv("PACKER_CACHE_DIR", t.TempDir())
+		server, _ := serveTestInstaller(t, testInstallerContent)
+
+		config := &Config{
+			DiskSize:          "500G",
+			VCPUCount:         "32G",
+			RAMSize:           "16G",
+			InstallerURL:      server.URL + "/UniversalMac_14.0_23A344_Restore.ipsw",
+			InstallerChecksum: testInstallerChecksum(testInstallerContent),
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-create",
+			},
+		}
+
+		state.Put("config", config)
+
+		checksum, err := parseInstallerChecksum(config.InstallerChecksum)
+		assert.NilError(t, err)
+		cachePath := (&installerCache{dir: filepath.Join(os.Getenv("PACKER_CACHE_DIR"), installerCacheDirName)}).path(config.InstallerURL, checksum)
+
+		createParams := client.CreateParams{
+			Installer: cachePath,
+			Name:      "anka-packer-base-14.0-23A344",
+			DiskSize:  config.DiskSize,
+			VCPUCount: config.VCPUCount,
+			RAMSize:   config.RAMSize,
+		}
+
+		gomock.InOrder(
+			ankaUtil.EXPECT().ReadInstallerInfo(cachePath).Return(util.InstallerInfo{Kind: util.InstallerKindIPSW, OSVersion: "14.0", Build: "23A344"}, nil).Times(1),
+			ankaClient.EXPECT().Create(createParams, gomock.Any()).Return(createdVMUUID, nil).Times(1),
+			ankaClient.EXPECT().Show("anka-packer-base-14.0-23A344").Return(createdShowResponse, nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+		assert.Equal(t, "anka-packer-base-14.0-23A344", state.Get("vm_name"))
+	})
+
+	t.Run("create vm with an installer_url failing its checksum deletes nothing", func(t *testing.T) {
+		t.Setenv("PACKER_CACHE_DIR", t.TempDir())
+		server, _ := serveTestInstaller(t, testInstallerContent)
+
+		config := &Config{
+			VMName:            "foo",
+			InstallerURL:      server.URL + "/UniversalMac_14.0_23A344_Restore.ipsw",
+			InstallerChecksum: testInstallerChecksum([]byte("other installer")),
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-create",
+			},
+		}
+
+		state.Put("config", config)
+
+		ankaUtil.EXPECT().StepError(gomock.Any(), state, gomock.Any()).Return(multistep.ActionHalt).Times(1)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionHalt, stepAction)
+
+		// No Delete is expected, foo may be another build's VM
+		state.Put(multistep.StateHalted, true)
+		defer state.Remove(multistep.StateHalted)
+		step.Cleanup(state)
+	})
+
+	t.Run("create vm with build_cache skips an unchanged installer_url before downloading it", func(t *testing.T) {
+		t.Setenv("PACKER_CACHE_DIR", t.TempDir())
+		server, requests := serveTestInstaller(t, testInstallerContent)
+
+		config := &Config{
+			InstallerURL:      server.URL + "/UniversalMac_14.0_23A344_Restore.ipsw",
+			InstallerChecksum: testInstallerChecksum(testInstallerContent),
+			BuildCache:        true,
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-create",
+			},
+		}
+
+		state.Put("config", config)
+		defer state.Remove("build_cache_hit")
+
+		fingerprint, err := buildFingerprint(config, "create "+config.InstallerChecksum, "")
+		assert.NilError(t, err)
+
+		cache, err := newBuildCache()
+		assert.NilError(t, err)
+		assert.NilError(t, cache.Save(buildCacheRecord{Fingerprint: fingerprint, VMName: "anka-packer-base-14.0-23A344", VMID: createdVMUUID, FinalState: finalStateStop}))
+
+		ankaClient.EXPECT().Show("anka-packer-base-14.0-23A344").Return(client.ShowResponse{Name: "anka-packer-base-14.0-23A344", UUID: createdVMUUID, Status: "stopped"}, nil).Times(1)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+		assert.Equal(t, int32(0), atomic.LoadInt32(requests))
+		assert.Equal(t, "anka-packer-base-14.0-23A344", state.Get("vm_name"))
+	})
+
+	t.Run("create vm from a verified installer version", func(t *testing.T) {
+		t.Setenv("PACKER_CACHE_DIR", t.TempDir())
+		server, _ := serveTestInstaller(t, testInstallerContent)
+
+		config := &Config{
+			DiskSize:          "500G",
+			VCPUCount:         "32G",
+			RAMSize:           "16G",
+			Installer:         "13.5",
+			InstallerChecksum: testInstallerChecksum(testInstallerContent),
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-create",
+			},
+		}
+
+		state.Put("config", config)
+
+		installers := []client.CreateInstallerListResponse{
+			{Version: "13.5", Build: "22G74", URL: server.URL + "/UniversalMac_13.5_22G74_Restore.ipsw"},
+		}
+
+		gomock.InOrder(
+			ankaClient.EXPECT().CreateInstallerList().Return(installers, nil).Times(1),
+			ankaClient.EXPECT().
+				Create(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(params client.CreateParams, _ chan string) (string, error) {
+					assert.Assert(t, strings.HasPrefix(params.Installer, os.Getenv("PACKER_CACHE_DIR")))
+					content, err := os.ReadFile(params.Installer)
+					assert.NilError(t, err)
+					assert.DeepEqual(t, testInstallerContent, content)
+					return createdVMUUID, nil
+				}).
+				Times(1),
+			ankaClient.EXPECT().Show("anka-packer-base-13.5").Return(createdShowResponse, nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+	})
+
+	t.Run("create vm from an installer version anka doesn't list", func(t *testing.T) {
+		config := &Config{
+			Installer: "10.15",
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-create",
+			},
+		}
+
+		state.Put("config", config)
+
+		createParams := client.CreateParams{
+			Installer: "10.15",
+			Name:      "anka-packer-base-10.15",
+		}
+
+		gomock.InOrder(
+			ankaClient.EXPECT().CreateInstallerList().Return(availableInstallers, nil).Times(1),
+			ankaClient.EXPECT().Create(createParams, gomock.Any()).Return(createdVMUUID, nil).Times(1),
+			ankaClient.EXPECT().Show("anka-packer-base-10.15").Return(createdShowResponse, nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+	})
+
+	t.Run("create vm from an installer constraint", func(t *testing.T) {
+		config := &Config{
+			VMName:    "base-{{ .OSVersion }}-{{ .Build }}",
+			Installer: ">= 13.0, < 27",
+			PackerConfig: common.PackerConfig{
+				PackerBuilderType: "veertu-anka-vm-create",
+			},
+		}
+
+		state.Put("config", config)
+
+		createParams := client.CreateParams{
+			Installer: "26.4",
+			Name:      "base-26.4-25E243",
+		}
+
+		gomock.InOrder(
+			ankaClient.EXPECT().CreateInstallerList().Return(availableInstallers, nil).Times(1),
+			ankaUtil.EXPECT().RandSeq(10).Return("ABCDEabcde").Times(1),
+			ankaClient.EXPECT().Create(createParams, gomock.Any()).Return(createdVMUUID, nil).Times(1),
+			ankaClient.EXPECT().Show("base-26.4-25E243").Return(createdShowResponse, nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+		assert.Equal(t, "26.4", state.Get("installer_version"))
+		assert.Equal(t, "25E243", state.Get("installer_build"))
+	})
+
+	for name, config := range map[string]*Config{
+		"strict":     {Installer: "10.15", InstallerStrict: true},
+		"build":      {Installer: "13.5", InstallerBuild: "22G90"},
+		"constraint": {Installer: "~> 15.0"},
+	} {
+		t.Run("create vm fails when the installer isn't listed with "+name, func(t *testing.T) {
+			config.PackerConfig = common.PackerConfig{PackerBuilderType: "veertu-anka-vm-create"}
+			state.Put("config", config)
+
+			expectedErr := fmt.Errorf("installer %q is not one of the versions anka can download (see anka create --list)", describeInstallerSelection(config))
+
+			gomock.InOrder(
+				ankaClient.EXPECT().CreateInstallerList().Return(availableInstallers, nil).Times(1),
+				ankaUtil.EXPECT().StepError(ui, state, expectedErr).Return(multistep.ActionHalt).Times(1),
+			)
+
+			stepAction := step.Run(ctx, state)
+			assert.Equal(t, multistep.ActionHalt, stepAction)
+		})
+	}
 }
@@ -0,0 +1,52 @@
+package anka
+
+import (
+	"context"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+	"github.com/veertuinc/packer-plugin-veertu-anka/util"
+)
+
+// StepDetachDrives removes the additional disks and optical drives marked with
+// detach_after_build once provisioning has finished.
+type StepDetachDrives struct{}
+
+// Run detaches the drives recorded by the create/clone steps
+func (s *StepDetachDrives) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packer.Ui)
+	ankaUtil := state.Get("util").(util.Util)
+	onError := func(err error) multistep.StepAction {
+		return ankaUtil.StepError(ui, state, err)
+	}
+	ankaClient := state.Get("client").(client.Client)
+	vmName := state.Get("vm_name").(string)
+
+	hardDriveIndexes, _ := state.Get("detach_hard_drives").([]int)
+	opticalDrivePaths, _ := state.Get("detach_optical_drives").([]string)
+
+	if len(hardDriveIndexes) == 0 && len(opticalDrivePaths) == 0 {
+		return multistep.ActionContinue
+	}
+
+	err := detachDrives(ankaClient, vmName, hardDriveIndexes, opticalDrivePaths, ui)
+	if err != nil {
+		return onError(err)
+	}
+
+	// Detaching requires a stopped VM; bring it back up unless it's going to be stopped anyway
+	if resolvedFinalState(state) != finalStateStop {
+		err = ankaClient.Start(client.StartParams{VMName: vmName})
+		if err != nil {
+			return onError(err)
+		}
+	}
+
+	return multistep.ActionContinue
+}
+
+// Cleanup will run when errors occur
+// Nothing to do here since the drives are only detached after a successful build
+func (s *StepDetachDrives) Cleanup(state multistep.StateBag) {
+}
@@ -0,0 +1,55 @@
+package anka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/veertuinc/packer-plugin-veertu-anka/util"
+)
+
+// StepHostLocks sets up host-wide locking for the build and takes the locks on fixed
+// host ports straight away. Steps later take VM name and pull locks through the
+// "host_locks" state. Every lock is released in Cleanup, whether the build failed or not.
+type StepHostLocks struct {
+	locker *hostLocker
+}
+
+// Run creates the build's locker and locks the forwarded host ports
+func (s *StepHostLocks) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+	ankaUtil := state.Get("util").(util.Util)
+	onError := func(err error) multistep.StepAction {
+		return ankaUtil.StepError(ui, state, err)
+	}
+
+	timeout, err := time.ParseDuration(config.LockTimeout)
+	if err != nil {
+		return onError(err)
+	}
+
+	s.locker = newHostLocker(hostLockDir(), timeout)
+	state.Put("host_locks", s.locker)
+
+	for _, rule := range config.PortForwardingRules {
+		if rule.PortForwardingHostPort == 0 {
+			continue
+		}
+
+		err = s.locker.Acquire(ctx, hostLockHostPort, strconv.Itoa(rule.PortForwardingHostPort))
+		if err != nil {
+			return onError(fmt.Errorf("host port %d is in use by another build: %w", rule.PortForwardingHostPort, err))
+		}
+	}
+
+	return multistep.ActionContinue
+}
+
+// Cleanup releases every lock the build took
+func (s *StepHostLocks) Cleanup(state multistep.StateBag) {
+	s.locker.ReleaseAll()
+}
@@ -0,0 +1,279 @@
+package anka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+	"github.com/veertuinc/packer-plugin-veertu-anka/util"
+)
+
+const developLicenseType = "com.veertu.anka.develop"
+
+// licenseStatusesNotUsable are `anka license show` statuses that can't run any VM
+var licenseStatusesNotUsable = []string{"expired", "invalid", "inactive", "not_activated", "unlicensed"}
+
+// hostCapabilities combines what the installed anka version supports with the license
+// and the architecture this plugin was built for
+type hostCapabilities struct {
+	client.Capabilities
+	HostArch        string
+	LicenseType     string
+	LicenseStatus   string
+	Suspend         bool
+	CustomVariables bool
+	UpdateAddons    bool
+}
+
+func newHostCapabilities(ankaCapabilities client.Capabilities, license client.LicenseResponse, hostArch string) hostCapabilities {
+	return hostCapabilities{
+		Capabilities:    ankaCapabilities,
+		HostArch:        hostArch,
+		LicenseType:     license.LicenseType,
+		LicenseStatus:   license.Status,
+		Suspend:         license.LicenseType != developLicenseType,
+		CustomVariables: ankaCapabilities.Major < 3,
+		UpdateAddons:    ankaCapabilities.Major < 3,
+	}
+}
+
+// StepPreflight checks what the host's Anka installation supports before anything is
+// created, so unsupported settings fail the build straight away rather than at the end.
+type StepPreflight struct{}
+
+// Run checks the anka version, license and host against the features the config needs
+func (s *StepPreflight) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+	ankaUtil := state.Get("util").(util.Util)
+	onError := func(err error) multistep.StepAction {
+		return ankaUtil.StepError(ui, state, err)
+	}
+	ankaClient := state.Get("client").(client.Client)
+
+	ankaCapabilities, err := ankaClient.Capabilities()
+	if err != nil {
+		return onError(fmt.Errorf("failed to run anka version (is anka installed and in your PATH?): %w", err))
+	}
+
+	license, err := ankaClient.License()
+	if err != nil {
+		return onError(err)
+	}
+
+	capabilities := newHostCapabilities(ankaCapabilities, license, config.HostArch)
+
+	ui.Say(fmt.Sprintf("Preflight: anka %s (%s), license %s (%s)", capabilities.Version, capabilities.HostArch, capabilities.LicenseType, capabilities.LicenseStatus))
+
+	var remotes []client.RegistryRemote
+	if config.PackerBuilderType == "veertu-anka-vm-clone" && (needsRegistry(config) || config.Remote != "" || len(config.Remotes) > 0) {
+		remotes, err = ankaClient.RegistryListRepos()
+		if err != nil {
+			return onError(fmt.Errorf("failed to list registry remotes (add one with anka registry add): %w", err))
+		}
+	}
+
+	finalState, err := resolveFinalState(config.FinalState, license)
+	if err != nil {
+		return onError(err)
+	}
+
+	sourceArch := ""
+	if config.PackerBuilderType == "veertu-anka-vm-clone" {
+		sourceArch = sourceTemplateArch(ankaClient, config, ui)
+	}
+
+	err = checkCapabilities(config, capabilities, remotes, sourceArch)
+	if err != nil {
+		return onError(err)
+	}
+
+	if !config.UseAnkaCP && !capabilities.Fuse {
+		ui.Message("FUSE is not available with this version of anka, files will be transferred with anka cp")
+	}
+
+	if config.FinalState == "" && finalState == finalStateStop {
+		ui.Say("Developer license present, the VM will be stopped instead of suspended: https://docs.veertu.com/anka/licensing/#anka-license-feature-differences")
+	}
+
+	state.Put("host_capabilities", capabilities)
+	state.Put("final_state", finalState)
+
+	return multistep.ActionContinue
+}
+
+// Cleanup will run when errors occur
+// Nothing to do here since this step only checks the host
+func (s *StepPreflight) Cleanup(state multistep.StateBag) {
+}
+
+// sourceTemplateArch is the architecture of the template vm-clone will clone, from the local copy
+// or the registry, or "" when it can't be told. Failing to look it up is left to the clone step.
+func sourceTemplateArch(ankaClient client.Client, config *Config, ui packer.Ui) string {
+	sourceRef := config.SourceVMName
+	if config.SourceVMID != "" {
+		sourceRef = config.SourceVMID
+	}
+
+	if config.fetchPolicy() != fetchPolicyAlways {
+		exists, err := ankaClient.Exists(sourceRef)
+		if err != nil {
+			log.Printf("Not checking the architecture of %s: %s", sourceRef, err)
+			return ""
+		}
+		if exists {
+			show, err := ankaClient.Show(sourceRef)
+			if err != nil {
+				log.Printf("Not checking the architecture of %s: %s", sourceRef, err)
+				return ""
+			}
+			return show.Arch
+		}
+		if config.fetchPolicy() == fetchPolicyNever {
+			return ""
+		}
+	}
+
+	var describe client.RegistryDescribeResponse
+	_, err := newRegistryRemotes(ankaClient, config).Try(ui, fmt.Sprintf("describe %s", sourceRef), func(registryParams client.RegistryParams) error {
+		var err error
+		describe, err = ankaClient.RegistryDescribe(registryParams, sourceRef)
+		return err
+	})
+	if err != nil {
+		log.Printf("Not checking the architecture of %s: %s", sourceRef, err)
+		return ""
+	}
+	return describe.Arch
+}
+
+// normalizeArch maps the names anka uses for an architecture to GOARCH names
+func normalizeArch(arch string) string {
+	switch strings.ToLower(arch) {
+	case "x86_64", "intel":
+		return "amd64"
+	case "aarch64", "apple":
+		return "arm64"
+	}
+	return strings.ToLower(arch)
+}
+
+// checkCapabilities compares the features the config needs, and the architecture of the source
+// template when it's known, against what the host supports and returns every problem found as a
+// single error.
+func checkCapabilities(config *Config, capabilities hostCapabilities, remotes []client.RegistryRemote, sourceArch string) error {
+	var problems []string
+
+	if containsString(licenseStatusesNotUsable, strings.ToLower(capabilities.LicenseStatus)) {
+		problems = append(problems, fmt.Sprintf("the anka license is %s, run anka license show for details", capabilities.LicenseStatus))
+	}
+
+	switch {
+	case capabilities.Major >= 3 && capabilities.HostArch != "arm64":
+		problems = append(problems, fmt.Sprintf("anka %s requires the darwin_arm64 build of this plugin, but the %s build is running", capabilities.Version, capabilities.HostArch))
+	case capabilities.Major < 3 && capabilities.HostArch != "amd64":
+		problems = append(problems, fmt.Sprintf("anka %s requires the darwin_amd64 build of this plugin, but the %s build is running", capabilities.Version, capabilities.HostArch))
+	}
+
+	installerField, installerName := "installer", config.Installer
+	if config.InstallerURL != "" {
+		installerField, installerName = "installer_url", config.InstallerURL
+	}
+	installer := strings.TrimSuffix(strings.ToLower(installerURLPath(installerName)), "/")
+	if strings.HasSuffix(installer, ".ipsw") && !capabilities.IPSWInstallers {
+		problems = append(problems, fmt.Sprintf("%s: %s is an .ipsw, which anka %s can't install (it needs an installer .app)", installerField, installerName, capabilities.Version))
+	}
+
+	if config.HWUUID != "" && !capabilities.CustomVariables {
+		problems = append(problems, fmt.Sprintf("hw_uuid: custom variables are not supported by anka %s", capabilities.Version))
+	}
+
+	if config.UpdateAddons && !capabilities.UpdateAddons {
+		problems = append(problems, fmt.Sprintf("update_addons: not supported by anka %s", capabilities.Version))
+	}
+
+	if len(config.HostDirectoryMounts) > 0 && !capabilities.HostDirectoryMounts {
+		problems = append(problems, fmt.Sprintf("host_directory_mounts: requires anka 3.9.0 or later on Apple Silicon, found anka %s (%s)", capabilities.Version, capabilities.HostArch))
+	}
+
+	if config.PackerBuilderType == "veertu-anka-vm-clone" {
+		if sourceArch != "" && normalizeArch(sourceArch) != capabilities.HostArch {
+			problems = append(problems, fmt.Sprintf("source_vm_name: %s is an %s template, which can't run on this %s host", config.SourceVMName, normalizeArch(sourceArch), capabilities.HostArch))
+		}
+
+		// Local tags are created with anka registry push --local
+		explicitLocalTag := (config.CreateLocalTag != nil && *config.CreateLocalTag) || config.LocalTag != "" || config.LocalTagKeep > 0
+		if explicitLocalTag && !capabilities.LocalTags {
+			problems = append(problems, fmt.Sprintf("create_local_tag: local tags are pushed with anka registry push --local, which anka %s doesn't support (it needs anka 3)", capabilities.Version))
+		}
+
+		if len(config.Remotes) > 0 {
+			// URLs don't need to be added with anka registry add, and may just be down for now
+			for index, remote := range config.Remotes {
+				if !isRegistryURL(remote.Remote) && checkRegistryRemote(remote.Remote, "", remotes) != "" {
+					problems = append(problems, fmt.Sprintf("remotes[%d].remote: %q is not a configured registry remote (add it with anka registry add)", index, remote.Remote))
+				}
+			}
+		} else if needsRegistry(config) || config.Remote != "" {
+			field := "fetch_policy"
+			if config.AlwaysFetch {
+				field = "always_fetch"
+			}
+			if problem := checkRegistryRemote(config.Remote, field, remotes); problem != "" {
+				problems = append(problems, problem)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("preflight checks failed:\n* " + strings.Join(problems, "\n* "))
+	}
+
+	return nil
+}
+
+// needsRegistry reports whether vm-clone talks to the registry even when the source exists locally
+func needsRegistry(config *Config) bool {
+	fetchPolicy := config.fetchPolicy()
+	return fetchPolicy == fetchPolicyAlways || fetchPolicy == fetchPolicyIfNewer
+}
+
+// checkRegistryRemote reports a remote that isn't configured, or the field that needs the default
+// remote when remote is empty and there isn't one
+func checkRegistryRemote(remote string, defaultField string, remotes []client.RegistryRemote) string {
+	for _, r := range remotes {
+		if remote == "" && r.Default {
+			return ""
+		}
+		if remote != "" && (r.Name == remote || r.Url == remote) {
+			return ""
+		}
+	}
+
+	if remote == "" {
+		return fmt.Sprintf("%s: no default registry remote is configured (add one with anka registry add --default)", defaultField)
+	}
+	return fmt.Sprintf("remote: %q is not a configured registry remote (add it with anka registry add)", remote)
+}
+
+// resolveFinalState defaults an unset final_state to suspend, or to stop when the license
+// can't suspend VMs. Asking for suspend explicitly on such a license is an error.
+func resolveFinalState(finalState string, license client.LicenseResponse) (string, error) {
+	canSuspend := license.LicenseType != developLicenseType
+
+	switch {
+	case finalState == "" && canSuspend:
+		return finalStateSuspend, nil
+	case finalState == "":
+		return finalStateStop, nil
+	case finalState == finalStateSuspend && !canSuspend:
+		return "", fmt.Errorf("final_state: suspend is not supported by the %s license, use stop or shutdown instead", license.LicenseType)
+	}
+
+	return finalState, nil
+}
@@ -0,0 +1,225 @@
+package anka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+	mocks "github.com/veertuinc/packer-plugin-veertu-anka/mocks"
+	"gotest.tools/v3/assert"
+)
+
+func TestPreflightRun(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	ankaClient := mocks.NewMockClient(mockCtrl)
+	ankaUtil := mocks.NewMockUtil(mockCtrl)
+
+	step := StepPreflight{}
+	ui := packer.TestUi(t)
+	ctx := context.Background()
+	state := new(multistep.BasicStateBag)
+
+	state.Put("ui", ui)
+	state.Put("client", ankaClient)
+	state.Put("util", ankaUtil)
+
+	ankaCapabilities, err := client.NewCapabilities("3.9.0")
+	assert.NilError(t, err)
+
+	t.Run("develop license defaults to stop", func(t *testing.T) {
+		config := &Config{HostArch: "arm64", UseAnkaCP: true}
+		state.Put("config", config)
+
+		ankaClient.EXPECT().Capabilities().Return(ankaCapabilities, nil).Times(1)
+		ankaClient.EXPECT().License().Return(client.LicenseResponse{LicenseType: developLicenseType, Status: "valid"}, nil).Times(1)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+		assert.Equal(t, finalStateStop, state.Get("final_state"))
+		assert.Equal(t, "", config.FinalState)
+		assert.Equal(t, 9, state.Get("host_capabilities").(hostCapabilities).Minor)
+	})
+
+	t.Run("clone checks the local source template's architecture", func(t *testing.T) {
+		config := &Config{HostArch: "arm64", UseAnkaCP: true, SourceVMName: "source_foo"}
+		config.PackerBuilderType = "veertu-anka-vm-clone"
+		state.Put("config", config)
+
+		ankaClient.EXPECT().Capabilities().Return(ankaCapabilities, nil).Times(1)
+		ankaClient.EXPECT().License().Return(client.LicenseResponse{LicenseType: "com.veertu.anka.entplus", Status: "valid"}, nil).Times(1)
+		ankaClient.EXPECT().Exists("source_foo").Return(true, nil).Times(1)
+		ankaClient.EXPECT().Show("source_foo").Return(client.ShowResponse{Name: "source_foo", Arch: "x86_64"}, nil).Times(1)
+		ankaUtil.EXPECT().StepError(ui, state, gomock.Any()).DoAndReturn(func(_ packer.Ui, _ multistep.StateBag, err error) multistep.StepAction {
+			assert.ErrorContains(t, err, "source_foo is an amd64 template, which can't run on this arm64 host")
+			return multistep.ActionHalt
+		}).Times(1)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionHalt, stepAction)
+	})
+
+	t.Run("halts before anything is created", func(t *testing.T) {
+		config := &Config{HostArch: "arm64", UseAnkaCP: true, FinalState: finalStateSuspend}
+		state.Put("config", config)
+
+		ankaClient.EXPECT().Capabilities().Return(ankaCapabilities, nil).Times(1)
+		ankaClient.EXPECT().License().Return(client.LicenseResponse{LicenseType: developLicenseType, Status: "valid"}, nil).Times(1)
+		ankaUtil.EXPECT().StepError(ui, state, gomock.Any()).Return(multistep.ActionHalt).Times(1)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionHalt, stepAction)
+	})
+}
+
+func TestResolveFinalState(t *testing.T) {
+	proLicense := client.LicenseResponse{LicenseType: "com.veertu.anka.entplus"}
+	developLicense := client.LicenseResponse{LicenseType: developLicenseType}
+
+	t.Run("defaults to suspend", func(t *testing.T) {
+		finalState, err := resolveFinalState("", proLicense)
+
+		assert.NilError(t, err)
+		assert.Equal(t, finalStateSuspend, finalState)
+	})
+
+	t.Run("defaults to stop on a develop license", func(t *testing.T) {
+		finalState, err := resolveFinalState("", developLicense)
+
+		assert.NilError(t, err)
+		assert.Equal(t, finalStateStop, finalState)
+	})
+
+	t.Run("rejects suspend on a develop license", func(t *testing.T) {
+		_, err := resolveFinalState(finalStateSuspend, developLicense)
+
+		assert.ErrorContains(t, err, "final_state: suspend is not supported")
+	})
+
+	t.Run("keeps an explicit state", func(t *testing.T) {
+		finalState, err := resolveFinalState(finalStateShutdown, developLicense)
+
+		assert.NilError(t, err)
+		assert.Equal(t, finalStateShutdown, finalState)
+	})
+}
+
+func TestCheckCapabilities(t *testing.T) {
+	anka3Capabilities, _ := client.NewCapabilities("3.8.0")
+	anka2Capabilities, _ := client.NewCapabilities("2.5.7")
+	anka3 := newHostCapabilities(anka3Capabilities, client.LicenseResponse{LicenseType: developLicenseType, Status: "valid"}, "arm64")
+	anka2 := newHostCapabilities(anka2Capabilities, client.LicenseResponse{LicenseType: "com.veertu.anka.entplus", Status: "valid"}, "amd64")
+
+	t.Run("supported config", func(t *testing.T) {
+		err := checkCapabilities(&Config{HWUUID: "2CD9F4A6-1D0B-4B5C-9E1F-6A2B9F8C3D41", UpdateAddons: true}, anka2, nil, "")
+
+		assert.NilError(t, err)
+	})
+
+	t.Run("reports every unsupported feature", func(t *testing.T) {
+		config := &Config{
+			HWUUID:              "2CD9F4A6-1D0B-4B5C-9E1F-6A2B9F8C3D41",
+			UpdateAddons:        true,
+			HostDirectoryMounts: []HostDirectoryMount{{HostPath: "/tmp"}},
+		}
+
+		err := checkCapabilities(config, anka3, nil, "")
+
+		assert.ErrorContains(t, err, "hw_uuid: custom variables are not supported by anka 3.8.0")
+		assert.ErrorContains(t, err, "update_addons: not supported by anka 3.8.0")
+		assert.ErrorContains(t, err, "host_directory_mounts: requires anka 3.9.0 or later")
+	})
+
+	t.Run("expired license", func(t *testing.T) {
+		capabilities := anka2
+		capabilities.LicenseStatus = "expired"
+
+		err := checkCapabilities(&Config{}, capabilities, nil, "")
+
+		assert.ErrorContains(t, err, "the anka license is expired")
+	})
+
+	t.Run("plugin architecture", func(t *testing.T) {
+		capabilities := anka3
+		capabilities.HostArch = "amd64"
+
+		err := checkCapabilities(&Config{}, capabilities, nil, "")
+
+		assert.ErrorContains(t, err, "anka 3.8.0 requires the darwin_arm64 build of this plugin")
+	})
+
+	t.Run("installer architecture", func(t *testing.T) {
+		err := checkCapabilities(&Config{Installer: "/tmp/UniversalMac_14.0_Restore.ipsw"}, anka2, nil, "")
+
+		assert.ErrorContains(t, err, "is an .ipsw, which anka 2.5.7 can't install")
+
+		err = checkCapabilities(&Config{InstallerURL: "https://example.com/UniversalMac_14.0_Restore.ipsw?token=abc"}, anka2, nil, "")
+
+		assert.ErrorContains(t, err, "installer_url: https://example.com/UniversalMac_14.0_Restore.ipsw?token=abc is an .ipsw")
+
+		err = checkCapabilities(&Config{Installer: "/Applications/Install macOS Sonoma.app"}, anka3, nil, "")
+
+		assert.NilError(t, err)
+	})
+
+	t.Run("registry remote", func(t *testing.T) {
+		config := &Config{Remote: "missing"}
+		config.PackerBuilderType = "veertu-anka-vm-clone"
+		remotes := []client.RegistryRemote{{Name: "default", Url: "http://anka.registry:8089", Default: true}}
+
+		err := checkCapabilities(config, anka2, remotes, "")
+		assert.ErrorContains(t, err, `remote: "missing" is not a configured registry remote`)
+
+		config.Remote = "default"
+		assert.NilError(t, checkCapabilities(config, anka2, remotes, ""))
+	})
+
+	t.Run("fetch_policy without a default registry remote", func(t *testing.T) {
+		config := &Config{FetchPolicy: fetchPolicyIfNewer}
+		config.PackerBuilderType = "veertu-anka-vm-clone"
+
+		err := checkCapabilities(config, anka2, []client.RegistryRemote{{Name: "other", Url: "http://anka.registry:8089"}}, "")
+		assert.ErrorContains(t, err, "fetch_policy: no default registry remote is configured")
+
+		config.FetchPolicy = fetchPolicyIfMissing
+		assert.NilError(t, checkCapabilities(config, anka2, nil, ""))
+	})
+
+	t.Run("registry remotes", func(t *testing.T) {
+		config := &Config{AlwaysFetch: true, Remotes: []RegistryRemote{{Remote: "primary"}, {Remote: "https://mirror.example.com:8089"}, {Remote: "missing"}}}
+		config.PackerBuilderType = "veertu-anka-vm-clone"
+		remotes := []client.RegistryRemote{{Name: "primary", Url: "http://anka.registry:8089"}}
+
+		err := checkCapabilities(config, anka2, remotes, "")
+		assert.Error(t, err, "preflight checks failed:\n* remotes[2].remote: \"missing\" is not a configured registry remote (add it with anka registry add)")
+
+		config.Remotes = config.Remotes[:2]
+		assert.NilError(t, checkCapabilities(config, anka2, remotes, ""))
+	})
+
+	t.Run("source template architecture", func(t *testing.T) {
+		config := &Config{SourceVMName: "source_foo"}
+		config.PackerBuilderType = "veertu-anka-vm-clone"
+
+		err := checkCapabilities(config, anka3, nil, "x86_64")
+		assert.ErrorContains(t, err, "source_vm_name: source_foo is an amd64 template, which can't run on this arm64 host")
+
+		assert.NilError(t, checkCapabilities(config, anka3, nil, "arm64"))
+		assert.NilError(t, checkCapabilities(config, anka3, nil, ""))
+	})
+
+	t.Run("local tags need anka 3", func(t *testing.T) {
+		createLocalTag := true
+		config := &Config{SourceVMName: "source_foo", CreateLocalTag: &createLocalTag}
+		config.PackerBuilderType = "veertu-anka-vm-clone"
+
+		err := checkCapabilities(config, anka2, nil, "")
+		assert.ErrorContains(t, err, "create_local_tag: local tags are pushed with anka registry push --local, which anka 2.5.7 doesn't support")
+
+		config.CreateLocalTag = nil
+		assert.NilError(t, checkCapabilities(config, anka2, nil, ""))
+	})
+}
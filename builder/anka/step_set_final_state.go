@@ -0,0 +1,148 @@
+package anka
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+	"github.com/veertuinc/packer-plugin-veertu-anka/util"
+)
+
+const defaultFinalStatePollInterval = 2 * time.Second
+
+// guestShutdownShellCommand asks macOS to shut itself down cleanly
+const guestShutdownShellCommand = "sudo -n shutdown -h now"
+
+// StepSetFinalState leaves the VM in the configured final_state once the build has finished
+type StepSetFinalState struct {
+	pollInterval time.Duration
+}
+
+// resolvedFinalState is final_state as the preflight resolved it for the license, or as
+// configured when the preflight didn't run
+func resolvedFinalState(state multistep.StateBag) string {
+	if finalState, ok := state.GetOk("final_state"); ok {
+		return finalState.(string)
+	}
+	return state.Get("config").(*Config).FinalState
+}
+
+// Run stops, suspends, shuts down or starts the VM and waits until anka reports the expected status
+func (s *StepSetFinalState) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+	ankaUtil := state.Get("util").(util.Util)
+	onError := func(err error) multistep.StepAction {
+		return ankaUtil.StepError(ui, state, err)
+	}
+	ankaClient := state.Get("client").(client.Client)
+	vmName := state.Get("vm_name").(string)
+	finalState := resolvedFinalState(state)
+
+	// Provisioning is done, so a failure from here on keeps the VM rather than deleting it
+	state.Put("vm_built", true)
+	onError = func(err error) multistep.StepAction {
+		return ankaUtil.StepError(ui, state, fmt.Errorf("VM %s was built and has been kept, but it didn't reach final_state %s: %w", vmName, finalState, err))
+	}
+
+	timeout, err := time.ParseDuration(config.FinalStateTimeout)
+	if err != nil {
+		return onError(err)
+	}
+
+	expectedStatus := finalStateStatus(finalState)
+
+	switch finalState {
+	case finalStateStop:
+		ui.Say(fmt.Sprintf("Stopping VM %s", vmName))
+
+		err = ankaClient.Stop(client.StopParams{VMName: vmName})
+	case finalStateSuspend:
+		ui.Say(fmt.Sprintf("Suspending VM %s", vmName))
+
+		err = ankaClient.Suspend(client.SuspendParams{VMName: vmName})
+	case finalStateShutdown:
+		ui.Say(fmt.Sprintf("Shutting down VM %s from the guest", vmName))
+
+		// The guest usually goes away before anka run returns, so the status poll below decides
+		_, runErr := ankaClient.Run(client.RunParams{
+			VMName:  vmName,
+			Command: []string{guestShutdownShellCommand},
+		})
+		if runErr != nil {
+			log.Printf("guest shutdown of %s returned: %s", vmName, runErr)
+		}
+	case finalStateRunning:
+		ui.Say(fmt.Sprintf("Leaving VM %s running", vmName))
+
+		show, showErr := ankaClient.Show(vmName)
+		if showErr != nil {
+			return onError(showErr)
+		}
+		if !show.IsRunning() {
+			err = ankaClient.Start(client.StartParams{VMName: vmName})
+		}
+	default:
+		return onError(fmt.Errorf("final_state: unknown state %q", finalState))
+	}
+	if err != nil {
+		return onError(err)
+	}
+
+	err = s.waitForStatus(ctx, ankaClient, vmName, expectedStatus, timeout)
+	if err != nil {
+		return onError(err)
+	}
+
+	return multistep.ActionContinue
+}
+
+// Cleanup will run when errors occur
+// Nothing to do here since the VM is removed by the create/clone step on failure
+func (s *StepSetFinalState) Cleanup(state multistep.StateBag) {
+}
+
+// finalStateStatus is the anka status a VM is left in by final_state
+func finalStateStatus(finalState string) string {
+	switch finalState {
+	case finalStateSuspend:
+		return "suspended"
+	case finalStateRunning:
+		return "running"
+	default:
+		return "stopped"
+	}
+}
+
+func (s *StepSetFinalState) waitForStatus(ctx context.Context, ankaClient client.Client, vmName string, status string, timeout time.Duration) error {
+	interval := s.pollInterval
+	if interval == 0 {
+		interval = defaultFinalStatePollInterval
+	}
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+		show, err := ankaClient.Show(vmName)
+		if err != nil {
+			return err
+		}
+		if show.Status == status {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s waiting for VM %s to be %s (currently %s)", timeout, vmName, status, show.Status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
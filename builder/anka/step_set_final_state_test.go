@@ -0,0 +1,114 @@
+package anka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+	mocks "github.com/veertuinc/packer-plugin-veertu-anka/mocks"
+	"gotest.tools/v3/assert"
+)
+
+func TestSetFinalStateRun(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	ankaClient := mocks.NewMockClient(mockCtrl)
+	ankaUtil := mocks.NewMockUtil(mockCtrl)
+
+	step := StepSetFinalState{pollInterval: time.Millisecond}
+	ui := packer.TestUi(t)
+	ctx := context.Background()
+	state := new(multistep.BasicStateBag)
+
+	state.Put("ui", ui)
+	state.Put("client", ankaClient)
+	state.Put("util", ankaUtil)
+	state.Put("vm_name", "foo")
+
+	t.Run("stop", func(t *testing.T) {
+		state.Put("config", &Config{FinalState: finalStateStop, FinalStateTimeout: "1s"})
+
+		gomock.InOrder(
+			ankaClient.EXPECT().Stop(client.StopParams{VMName: "foo"}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("foo").Return(client.ShowResponse{Status: "stopped"}, nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+	})
+
+	t.Run("suspend", func(t *testing.T) {
+		state.Put("config", &Config{FinalState: finalStateSuspend, FinalStateTimeout: "1s"})
+
+		gomock.InOrder(
+			ankaClient.EXPECT().Suspend(client.SuspendParams{VMName: "foo"}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("foo").Return(client.ShowResponse{Status: "suspended"}, nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+	})
+
+	t.Run("running starts a stopped vm", func(t *testing.T) {
+		state.Put("config", &Config{FinalState: finalStateRunning, FinalStateTimeout: "1s"})
+
+		gomock.InOrder(
+			ankaClient.EXPECT().Show("foo").Return(client.ShowResponse{Status: "stopped"}, nil).Times(1),
+			ankaClient.EXPECT().Start(client.StartParams{VMName: "foo"}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("foo").Return(client.ShowResponse{Status: "running"}, nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+	})
+
+	t.Run("shutdown waits for the guest to stop", func(t *testing.T) {
+		state.Put("config", &Config{FinalState: finalStateShutdown, FinalStateTimeout: "1s"})
+
+		gomock.InOrder(
+			ankaClient.EXPECT().Run(client.RunParams{VMName: "foo", Command: []string{guestShutdownShellCommand}}).Return(255, nil).Times(1),
+			ankaClient.EXPECT().Show("foo").Return(client.ShowResponse{Status: "running"}, nil).Times(1),
+			ankaClient.EXPECT().Show("foo").Return(client.ShowResponse{Status: "stopped"}, nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+	})
+
+	t.Run("uses the final_state resolved by the preflight", func(t *testing.T) {
+		state.Put("config", &Config{FinalStateTimeout: "1s"})
+		state.Put("final_state", finalStateStop)
+		defer state.Remove("final_state")
+
+		gomock.InOrder(
+			ankaClient.EXPECT().Stop(client.StopParams{VMName: "foo"}).Return(nil).Times(1),
+			ankaClient.EXPECT().Show("foo").Return(client.ShowResponse{Status: "stopped"}, nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+	})
+
+	t.Run("times out when the state is not reached", func(t *testing.T) {
+		state.Put("config", &Config{FinalState: finalStateShutdown, FinalStateTimeout: "5ms"})
+
+		ankaClient.EXPECT().Run(client.RunParams{VMName: "foo", Command: []string{guestShutdownShellCommand}}).Return(0, nil).Times(1)
+		ankaClient.EXPECT().Show("foo").Return(client.ShowResponse{Status: "running"}, nil).MinTimes(1)
+		ankaUtil.EXPECT().StepError(ui, state, gomock.Any()).DoAndReturn(func(_ packer.Ui, _ multistep.StateBag, err error) multistep.StepAction {
+			assert.ErrorContains(t, err, "VM foo was built and has been kept, but it didn't reach final_state shutdown: timed out")
+			return multistep.ActionHalt
+		}).Times(1)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionHalt, stepAction)
+
+		state.Put(multistep.StateHalted, true)
+		defer state.Remove(multistep.StateHalted)
+		assert.Assert(t, !shouldDeleteAnkaTemplateAfterFailedBuild(state))
+	})
+
+}
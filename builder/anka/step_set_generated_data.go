@@ -3,53 +3,238 @@ package anka
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"log"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
 	"github.com/veertuinc/packer-plugin-veertu-anka/client"
+	"github.com/veertuinc/packer-plugin-veertu-anka/util"
 )
 
-var (
-	darwinBuffer, osBuffer bytes.Buffer
-)
+// generatedDataNames are published for every build. PortForward_<rule_name> is added per
+// port forwarding rule.
+var generatedDataNames = []string{
+	"VMName",
+	"VMUUID",
+	"SourceVMID",
+	"SourceVMTag",
+	"SourceRemote",
+	"InstallerVersion",
+	"InstallerBuild",
+	"AnkaVersion",
+	"HostArch",
+	"OSVersion",
+	"OSBuild",
+	"DarwinVersion",
+	"XcodeVersions",
+	"GuestIP",
+	"MACAddress",
+	"RAMSize",
+	"VCPUCount",
+	"DiskSize",
+}
+
+// guestXcodeVersionsShellCommand prints the version of every Xcode in /Applications, one per line
+const guestXcodeVersionsShellCommand = `for app in /Applications/Xcode*.app; do [ -d "$app" ] && defaults read "$app/Contents/Info" CFBundleShortVersionString; done; true`
+
+// guestIPShellCommand prints the guest's address on its primary interface
+const guestIPShellCommand = "ipconfig getifaddr en0 || true"
 
+// StepSetGeneratedData exposes details about the VM, its source and the host as generated data.
+// It runs once the VM is ready and again after provisioning, so post-processors see what the
+// provisioners changed.
 type StepSetGeneratedData struct {
 	client        client.Client
 	vmName        string
 	GeneratedData *packerbuilderdata.GeneratedData
 }
 
+// runInGuest runs a command in the VM and returns its trimmed output
+func (s *StepSetGeneratedData) runInGuest(command ...string) (string, error) {
+	var output bytes.Buffer
+
+	_, err := s.client.Run(client.RunParams{
+		Command: command,
+		VMName:  s.vmName,
+		Stdout:  &output,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(output.String()), nil
+}
+
+// runGeneratedDataCommands runs generated_data_commands in the guest in name order. Failures are
+// handled per generated_data_commands_on_error and leave any value from an earlier run alone.
+func (s *StepSetGeneratedData) runGeneratedDataCommands(config *Config, state multistep.StateBag, ui packer.Ui) error {
+	names := make([]string, 0, len(config.GeneratedDataCommands))
+	for name := range config.GeneratedDataCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, err := s.runInGuest(config.GeneratedDataCommands[name])
+		if err == nil {
+			s.GeneratedData.Put(name, value)
+			continue
+		}
+
+		err = fmt.Errorf("generated data command %s failed in %s: %w", name, s.vmName, err)
+		switch config.GeneratedDataCommandsOnError {
+		case generatedDataOnErrorWarn:
+			ui.Error(err.Error())
+		case generatedDataOnErrorIgnore:
+			log.Println(err)
+		default:
+			return err
+		}
+
+		if existing, ok := state.GetOk("generated_data"); ok {
+			if _, ok := existing.(map[string]interface{})[name]; ok {
+				continue
+			}
+		}
+		s.GeneratedData.Put(name, "")
+	}
+
+	return nil
+}
+
+// Run gathers the generated data from the guest, anka and earlier steps
 func (s *StepSetGeneratedData) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packer.Ui)
+	ankaUtil := state.Get("util").(util.Util)
+	onError := func(err error) multistep.StepAction {
+		return ankaUtil.StepError(ui, state, err)
+	}
+
+	config := state.Get("config").(*Config)
+
 	log.Printf("Exposing build contextual variables...")
 
 	s.client = state.Get("client").(client.Client)
 	s.vmName = state.Get("vm_name").(string)
-	darwinVersion := client.RunParams{
-		Command: []string{"/usr/bin/uname", "-r"},
-		VMName:  s.vmName,
-		Stdout:  &darwinBuffer,
+
+	darwinVersion, err := s.runInGuest("/usr/bin/uname", "-r")
+	if err != nil {
+		return onError(fmt.Errorf("failed to read the darwin version of %s: %w", s.vmName, err))
 	}
-	osVersion := client.RunParams{
-		Command: []string{"/usr/bin/sw_vers", "-productVersion"},
-		VMName:  s.vmName,
-		Stdout:  &osBuffer,
+
+	osVersion, err := s.runInGuest("/usr/bin/sw_vers", "-productVersion")
+	if err != nil {
+		return onError(fmt.Errorf("failed to read the macOS version of %s: %w", s.vmName, err))
 	}
 
-	_, err := s.client.Run(darwinVersion)
+	osBuild, err := s.runInGuest("/usr/bin/sw_vers", "-buildVersion")
 	if err != nil {
-		return multistep.ActionHalt
+		return onError(fmt.Errorf("failed to read the macOS build of %s: %w", s.vmName, err))
 	}
 
-	_, osErr := s.client.Run(osVersion)
-	if osErr != nil {
-		return multistep.ActionHalt
+	// Not every VM has Xcode or a network address, so these only log failures
+	xcodeVersions, err := s.runInGuest(guestXcodeVersionsShellCommand)
+	if err != nil {
+		log.Printf("Failed to read the Xcode versions of %s: %s", s.vmName, err)
+	}
+
+	guestIP, err := s.runInGuest(guestIPShellCommand)
+	if err != nil {
+		log.Printf("Failed to read the IP address of %s: %s", s.vmName, err)
+	}
+
+	show, err := s.client.Show(s.vmName)
+	if err != nil {
+		return onError(err)
+	}
+
+	describe, err := s.client.Describe(s.vmName)
+	if err != nil {
+		return onError(err)
+	}
+
+	macAddress := ""
+	if len(describe.NetworkCards) > 0 {
+		macAddress = describe.NetworkCards[0].MacAddress
+	}
+
+	ankaVersion, hostArch := "", ""
+	if capabilities, ok := state.GetOk("host_capabilities"); ok {
+		ankaVersion = capabilities.(hostCapabilities).Version
+		hostArch = capabilities.(hostCapabilities).HostArch
+	}
+
+	sourceVMID, sourceVMTag := "", ""
+	if id, ok := state.GetOk("source_vm_id"); ok {
+		sourceVMID = id.(string)
+	}
+	if tag, ok := state.GetOk("source_vm_tag"); ok {
+		sourceVMTag = tag.(string)
+	}
+
+	sourceRemote := ""
+	if remote, ok := state.GetOk("source_remote"); ok {
+		sourceRemote = remote.(string)
+	}
+
+	installerVersion, installerBuild := "", ""
+	if resolved, ok := state.GetOk("installer_version"); ok {
+		installerVersion = resolved.(string)
+		installerBuild = state.Get("installer_build").(string)
 	}
 
 	s.GeneratedData.Put("VMName", s.vmName)
-	s.GeneratedData.Put("OSVersion", strings.TrimSpace(osBuffer.String()))
-	s.GeneratedData.Put("DarwinVersion", strings.TrimSpace(darwinBuffer.String()))
+	s.GeneratedData.Put("VMUUID", show.UUID)
+	s.GeneratedData.Put("SourceVMID", sourceVMID)
+	s.GeneratedData.Put("SourceVMTag", sourceVMTag)
+	s.GeneratedData.Put("SourceRemote", sourceRemote)
+	s.GeneratedData.Put("InstallerVersion", installerVersion)
+	s.GeneratedData.Put("InstallerBuild", installerBuild)
+	s.GeneratedData.Put("AnkaVersion", ankaVersion)
+	s.GeneratedData.Put("HostArch", hostArch)
+	s.GeneratedData.Put("OSVersion", osVersion)
+	s.GeneratedData.Put("OSBuild", osBuild)
+	s.GeneratedData.Put("DarwinVersion", darwinVersion)
+	s.GeneratedData.Put("XcodeVersions", strings.Join(strings.Fields(xcodeVersions), ","))
+	s.GeneratedData.Put("GuestIP", guestIP)
+	s.GeneratedData.Put("MACAddress", macAddress)
+
+	// The sizes the builder applied, or what anka reports for the ones it left alone
+	applied := vmResources{
+		RAMSize:   show.RAM,
+		VCPUCount: strconv.Itoa(show.VCPUCores),
+		DiskSize:  formatGiB(show.HardDrive),
+	}
+	if resources, ok := state.GetOk("vm_resources"); ok {
+		if resources.(vmResources).RAMSize != "" {
+			applied.RAMSize = resources.(vmResources).RAMSize
+		}
+		if resources.(vmResources).VCPUCount != "" {
+			applied.VCPUCount = resources.(vmResources).VCPUCount
+		}
+		if resources.(vmResources).DiskSize != "" {
+			applied.DiskSize = resources.(vmResources).DiskSize
+		}
+	}
+	s.GeneratedData.Put("RAMSize", applied.RAMSize)
+	s.GeneratedData.Put("VCPUCount", applied.VCPUCount)
+	s.GeneratedData.Put("DiskSize", applied.DiskSize)
+
+	if hostPorts, ok := state.GetOk("host_ports"); ok {
+		for ruleName, hostPort := range hostPorts.(map[string]int) {
+			s.GeneratedData.Put(portForwardGeneratedDataName(ruleName), hostPort)
+		}
+	}
+
+	err = s.runGeneratedDataCommands(config, state, ui)
+	if err != nil {
+		return onError(err)
+	}
 
 	return multistep.ActionContinue
 }
@@ -1,8 +1,9 @@
 package anka
 
 import (
-	"bytes"
 	"context"
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/golang/mock/gomock"
@@ -14,43 +15,218 @@ import (
 	"gotest.tools/v3/assert"
 )
 
+// guestOutputs answers anka run with canned output per command, failing commands it doesn't know
+func guestOutputs(outputs map[string]string) func(client.RunParams) (int, error) {
+	return func(params client.RunParams) (int, error) {
+		output, ok := outputs[strings.Join(params.Command, " ")]
+		if !ok {
+			return 1, errors.New("command failed")
+		}
+		_, err := params.Stdout.Write([]byte(output + "\n"))
+		return 0, err
+	}
+}
+
 func TestSetGeneratedDataRun(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 	ankaClient := mocks.NewMockClient(mockCtrl)
 	ankaUtil := mocks.NewMockUtil(mockCtrl)
 
-	state := new(multistep.BasicStateBag)
-	step := StepSetGeneratedData{
-		vmName:        "foo-11.2-16.4.06",
-		GeneratedData: &packerbuilderdata.GeneratedData{State: state},
-	}
 	ui := packer.TestUi(t)
 	ctx := context.Background()
-	darwinVersion := client.RunParams{
-		Command: []string{"/usr/bin/uname", "-r"},
-		VMName:  step.vmName,
-		Stdout:  &bytes.Buffer{},
+	vmName := "foo-11.2-16.4.06"
+
+	show := client.ShowResponse{UUID: "abcd-1234", Name: vmName, VCPUCores: 4, RAM: "8G", HardDrive: 80 * bytesPerGiB}
+	describe := client.DescribeResponse{
+		NetworkCards: []client.DescribeNetworkCard{{MacAddress: "aa:bb:cc:dd:ee:ff"}},
 	}
-	osv := client.RunParams{
-		Command: []string{"/usr/bin/sw_vers", "-productVersion"},
-		VMName:  step.vmName,
-		Stdout:  &bytes.Buffer{},
+	outputs := map[string]string{
+		"/usr/bin/uname -r":                "22.6.0",
+		"/usr/bin/sw_vers -productVersion": "13.5",
+		"/usr/bin/sw_vers -buildVersion":   "22G74",
+		guestXcodeVersionsShellCommand:     "14.3.1\n15.0",
+		guestIPShellCommand:                "192.168.64.3",
 	}
 
-	state.Put("ui", ui)
-	state.Put("client", ankaClient)
-	state.Put("util", ankaUtil)
+	newState := func() *multistep.BasicStateBag {
+		state := new(multistep.BasicStateBag)
+		state.Put("ui", ui)
+		state.Put("client", ankaClient)
+		state.Put("util", ankaUtil)
+		state.Put("vm_name", vmName)
+		state.Put("config", &Config{GeneratedDataCommandsOnError: generatedDataOnErrorFail})
+		return state
+	}
 
 	t.Run("expose variables", func(t *testing.T) {
-		state.Put("vm_name", step.vmName)
+		state := newState()
+		step := StepSetGeneratedData{GeneratedData: &packerbuilderdata.GeneratedData{State: state}}
+		capabilities, _ := client.NewCapabilities("3.2.1")
+
+		state.Put("host_capabilities", hostCapabilities{Capabilities: capabilities, HostArch: "arm64"})
+		state.Put("source_vm_id", "source-uuid")
+		state.Put("source_vm_tag", "v1")
+		state.Put("source_remote", "mirror")
+		state.Put("installer_version", "13.5")
+		state.Put("installer_build", "22G74")
+		state.Put("vm_resources", vmResources{RAMSize: "16G", VCPUCount: "8"})
+		state.Put("host_ports", map[string]int{"ssh": 10022})
+
+		ankaClient.EXPECT().Run(gomock.Any()).DoAndReturn(guestOutputs(outputs)).Times(5)
+		ankaClient.EXPECT().Show(vmName).Return(show, nil).Times(1)
+		ankaClient.EXPECT().Describe(vmName).Return(describe, nil).Times(1)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+
+		generatedData := state.Get("generated_data").(map[string]interface{})
+		assert.DeepEqual(t, map[string]interface{}{
+			"VMName":           vmName,
+			"VMUUID":           "abcd-1234",
+			"SourceVMID":       "source-uuid",
+			"SourceVMTag":      "v1",
+			"SourceRemote":     "mirror",
+			"InstallerVersion": "13.5",
+			"InstallerBuild":   "22G74",
+			"AnkaVersion":      "3.2.1",
+			"HostArch":         "arm64",
+			"OSVersion":        "13.5",
+			"OSBuild":          "22G74",
+			"DarwinVersion":    "22.6.0",
+			"XcodeVersions":    "14.3.1,15.0",
+			"GuestIP":          "192.168.64.3",
+			"MACAddress":       "aa:bb:cc:dd:ee:ff",
+			"RAMSize":          "16G",
+			"VCPUCount":        "8",
+			"DiskSize":         "80.0G",
+			"PortForward_ssh":  10022,
+		}, generatedData)
+
+		for _, name := range generatedDataNames {
+			_, ok := generatedData[name]
+			assert.Assert(t, ok, name)
+		}
+	})
+
+	t.Run("optional guest values can be missing", func(t *testing.T) {
+		state := newState()
+		step := StepSetGeneratedData{GeneratedData: &packerbuilderdata.GeneratedData{State: state}}
+		required := map[string]string{
+			"/usr/bin/uname -r":                "22.6.0",
+			"/usr/bin/sw_vers -productVersion": "13.5",
+			"/usr/bin/sw_vers -buildVersion":   "22G74",
+		}
+
+		ankaClient.EXPECT().Run(gomock.Any()).DoAndReturn(guestOutputs(required)).Times(5)
+		ankaClient.EXPECT().Show(vmName).Return(show, nil).Times(1)
+		ankaClient.EXPECT().Describe(vmName).Return(client.DescribeResponse{}, nil).Times(1)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+
+		generatedData := state.Get("generated_data").(map[string]interface{})
+		assert.Equal(t, "", generatedData["XcodeVersions"])
+		assert.Equal(t, "", generatedData["GuestIP"])
+		assert.Equal(t, "", generatedData["SourceVMID"])
+		assert.Equal(t, "", generatedData["InstallerVersion"])
+		assert.Equal(t, "8G", generatedData["RAMSize"])
+		assert.Equal(t, "4", generatedData["VCPUCount"])
+	})
 
-		gomock.InOrder(
-			ankaClient.EXPECT().Run(darwinVersion).Times(1),
-			ankaClient.EXPECT().Run(osv).Times(1),
-		)
+	t.Run("runs generated data commands", func(t *testing.T) {
+		state := newState()
+		step := StepSetGeneratedData{GeneratedData: &packerbuilderdata.GeneratedData{State: state}}
+		state.Put("config", &Config{
+			GeneratedDataCommands: map[string]string{
+				"XcodeBuild": "xcodebuild -version | head -1",
+				"ToolSHA":    "git -C /opt/tool rev-parse HEAD",
+			},
+			GeneratedDataCommandsOnError: generatedDataOnErrorFail,
+		})
+		withCommands := map[string]string{
+			"xcodebuild -version | head -1":   "  Xcode 15.0  ",
+			"git -C /opt/tool rev-parse HEAD": "0123abc",
+		}
+		for command, output := range outputs {
+			withCommands[command] = output
+		}
+
+		ankaClient.EXPECT().Run(gomock.Any()).DoAndReturn(guestOutputs(withCommands)).Times(7)
+		ankaClient.EXPECT().Show(vmName).Return(show, nil).Times(1)
+		ankaClient.EXPECT().Describe(vmName).Return(describe, nil).Times(1)
 
 		stepAction := step.Run(ctx, state)
 		assert.Equal(t, multistep.ActionContinue, stepAction)
+
+		generatedData := state.Get("generated_data").(map[string]interface{})
+		assert.Equal(t, "Xcode 15.0", generatedData["XcodeBuild"])
+		assert.Equal(t, "0123abc", generatedData["ToolSHA"])
+	})
+
+	t.Run("failing generated data commands", func(t *testing.T) {
+		commands := map[string]string{"BrewList": "brew list --versions"}
+
+		t.Run("fail the build by default", func(t *testing.T) {
+			state := newState()
+			step := StepSetGeneratedData{GeneratedData: &packerbuilderdata.GeneratedData{State: state}}
+			state.Put("config", &Config{GeneratedDataCommands: commands, GeneratedDataCommandsOnError: generatedDataOnErrorFail})
+
+			ankaClient.EXPECT().Run(gomock.Any()).DoAndReturn(guestOutputs(outputs)).Times(6)
+			ankaClient.EXPECT().Show(vmName).Return(show, nil).Times(1)
+			ankaClient.EXPECT().Describe(vmName).Return(describe, nil).Times(1)
+			ankaUtil.EXPECT().StepError(ui, state, gomock.Any()).Return(multistep.ActionHalt).Times(1)
+
+			stepAction := step.Run(ctx, state)
+			assert.Equal(t, multistep.ActionHalt, stepAction)
+		})
+
+		t.Run("warn and keep an earlier value", func(t *testing.T) {
+			state := newState()
+			step := StepSetGeneratedData{GeneratedData: &packerbuilderdata.GeneratedData{State: state}}
+			state.Put("config", &Config{GeneratedDataCommands: commands, GeneratedDataCommandsOnError: generatedDataOnErrorWarn})
+			step.GeneratedData.Put("BrewList", "git 2.42.0")
+
+			mockui := &packer.MockUi{}
+			state.Put("ui", mockui)
+
+			ankaClient.EXPECT().Run(gomock.Any()).DoAndReturn(guestOutputs(outputs)).Times(6)
+			ankaClient.EXPECT().Show(vmName).Return(show, nil).Times(1)
+			ankaClient.EXPECT().Describe(vmName).Return(describe, nil).Times(1)
+
+			stepAction := step.Run(ctx, state)
+			assert.Equal(t, multistep.ActionContinue, stepAction)
+			assert.Equal(t, mockui.ErrorMessage, "generated data command BrewList failed in foo-11.2-16.4.06: command failed")
+
+			generatedData := state.Get("generated_data").(map[string]interface{})
+			assert.Equal(t, "git 2.42.0", generatedData["BrewList"])
+		})
+
+		t.Run("ignore and expose an empty value", func(t *testing.T) {
+			state := newState()
+			step := StepSetGeneratedData{GeneratedData: &packerbuilderdata.GeneratedData{State: state}}
+			state.Put("config", &Config{GeneratedDataCommands: commands, GeneratedDataCommandsOnError: generatedDataOnErrorIgnore})
+
+			ankaClient.EXPECT().Run(gomock.Any()).DoAndReturn(guestOutputs(outputs)).Times(6)
+			ankaClient.EXPECT().Show(vmName).Return(show, nil).Times(1)
+			ankaClient.EXPECT().Describe(vmName).Return(describe, nil).Times(1)
+
+			stepAction := step.Run(ctx, state)
+			assert.Equal(t, multistep.ActionContinue, stepAction)
+
+			generatedData := state.Get("generated_data").(map[string]interface{})
+			assert.Equal(t, "", generatedData["BrewList"])
+		})
+	})
+
+	t.Run("fails the build when the guest can't be queried", func(t *testing.T) {
+		state := newState()
+		step := StepSetGeneratedData{GeneratedData: &packerbuilderdata.GeneratedData{State: state}}
+
+		ankaClient.EXPECT().Run(gomock.Any()).Return(1, errors.New("anka run failed")).Times(1)
+		ankaUtil.EXPECT().StepError(ui, state, gomock.Any()).Return(multistep.ActionHalt).Times(1)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionHalt, stepAction)
 	})
 }
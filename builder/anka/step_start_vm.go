@@ -32,6 +32,14 @@ func (s *StepStartVM) Run(ctx context.Context, state multistep.StateBag) multist
 		return onError(err)
 	}
 
+	if hostPorts, ok := state.GetOk("host_ports"); ok && len(hostPorts.(map[string]int)) > 0 {
+		hostPorts, err := describedHostPorts(cmdClient, vmName, hostPorts.(map[string]int))
+		if err != nil {
+			return onError(err)
+		}
+		state.Put("host_ports", hostPorts)
+	}
+
 	if config.BootDelay != "" {
 		d, err := time.ParseDuration(config.BootDelay)
 		if err != nil {
@@ -100,4 +100,33 @@ func TestStartVMRun(t *testing.T) {
 		stepAction := step.Run(ctx, state)
 		assert.Equal(t, multistep.ActionContinue, stepAction)
 	})
+	t.Run("start vm reads back the host ports anka picked", func(t *testing.T) {
+		waitNetDisabled := false
+		config := &Config{
+			WaitForNetworking: &waitNetDisabled,
+		}
+
+		state.Put("config", config)
+		state.Put("host_ports", map[string]int{"ssh": 0, "http": 8080})
+		defer state.Remove("host_ports")
+
+		described := client.DescribeResponse{
+			NetworkCards: []client.DescribeNetworkCard{
+				{PortForwardingRules: []client.DescribePortForwardingRule{
+					{GuestPort: 22, HostPort: 10022, RuleName: "ssh"},
+					{GuestPort: 80, HostPort: 8080, RuleName: "http"},
+					{GuestPort: 5900, HostPort: 15900, RuleName: "vnc"},
+				}},
+			},
+		}
+
+		gomock.InOrder(
+			ankaClient.EXPECT().Start(client.StartParams{VMName: "foo"}).Return(nil).Times(1),
+			ankaClient.EXPECT().Describe("foo").Return(described, nil).Times(1),
+		)
+
+		stepAction := step.Run(ctx, state)
+		assert.Equal(t, multistep.ActionContinue, stepAction)
+		assert.DeepEqual(t, map[string]int{"ssh": 10022, "http": 8080}, state.Get("host_ports"))
+	})
 }
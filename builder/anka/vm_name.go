@@ -0,0 +1,107 @@
+package anka
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+)
+
+// vmNameTimestampLayout is used for {{ .Timestamp }} in vm_name
+const vmNameTimestampLayout = "20060102150405"
+
+// maxVMNameLength is the longest VM name the builder will pass to anka
+const maxVMNameLength = 255
+
+var vmNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// vmNameData is what vm_name templates can refer to. Values that don't apply to the
+// builder, such as SourceName when creating from an installer, are empty.
+type vmNameData struct {
+	OSVersion  string
+	Build      string
+	SourceName string
+	SourceTag  string
+	Arch       string
+	Timestamp  string
+	Random     string
+}
+
+func newVMNameData(arch string, random string, now time.Time) vmNameData {
+	return vmNameData{
+		Arch:      arch,
+		Timestamp: now.UTC().Format(vmNameTimestampLayout),
+		Random:    random,
+	}
+}
+
+// isVMNameTemplate reports whether vm_name needs rendering at runtime
+func isVMNameTemplate(name string) bool {
+	return strings.Contains(name, "{{")
+}
+
+// renderVMName resolves the template variables in vm_name and checks the result is a valid name
+func renderVMName(config *Config, data vmNameData) (string, error) {
+	return renderNameTemplate(config, "vm_name", config.VMName, data)
+}
+
+// renderNameTemplate resolves a name template, such as vm_name or local_tag, and checks the
+// result is a valid name
+func renderNameTemplate(config *Config, field string, template string, data vmNameData) (string, error) {
+	ctx := config.ctx
+	ctx.Data = data
+
+	name, err := interpolate.Render(template, &ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to render %s %q: %w", field, template, err)
+	}
+
+	err = validateVMName(name)
+	if err != nil {
+		return "", fmt.Errorf("%s %q rendered to an invalid name: %w", field, template, err)
+	}
+
+	return name, nil
+}
+
+// validateVMName checks a name against what anka accepts for VM names
+func validateVMName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("name is empty")
+	case len(name) > maxVMNameLength:
+		return fmt.Errorf("%q is longer than %d characters", name, maxVMNameLength)
+	case !vmNamePattern.MatchString(name):
+		return fmt.Errorf("%q must start with a letter or digit and contain only letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// validateVMNameTemplate checks vm_name at Prepare time: templates must parse and only use
+// vmNameData fields, plain names must be valid as they are.
+func validateVMNameTemplate(config *Config) error {
+	return validateNameTemplate(config, config.VMName)
+}
+
+func validateNameTemplate(config *Config, template string) error {
+	if !isVMNameTemplate(template) {
+		return validateVMName(template)
+	}
+
+	sample := vmNameData{
+		OSVersion:  "14.0",
+		Build:      "23A344",
+		SourceName: "source",
+		SourceTag:  "latest",
+		Arch:       "arm64",
+		Timestamp:  "20060102150405",
+		Random:     "abcdefghij",
+	}
+
+	ctx := config.ctx
+	ctx.Data = sample
+	_, err := interpolate.Render(template, &ctx)
+	return err
+}
@@ -0,0 +1,50 @@
+package anka
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRenderVMName(t *testing.T) {
+	now := time.Date(2026, 10, 19, 10, 30, 0, 0, time.FixedZone("PDT", -7*60*60))
+
+	t.Run("renders every variable", func(t *testing.T) {
+		data := newVMNameData("arm64", "abcdefghij", now)
+		data.OSVersion = "14.0"
+		data.Build = "23A344"
+		data.SourceName = "base"
+		data.SourceTag = "v1"
+
+		name, err := renderVMName(&Config{
+			VMName: "ci-{{ .OSVersion }}-{{ .Build }}-{{ .SourceName }}-{{ .SourceTag }}-{{ .Arch }}-{{ .Timestamp }}-{{ .Random }}",
+		}, data)
+
+		assert.NilError(t, err)
+		assert.Equal(t, "ci-14.0-23A344-base-v1-arm64-20261019173000-abcdefghij", name)
+	})
+
+	t.Run("rejects rendered names anka can't use", func(t *testing.T) {
+		_, err := renderVMName(&Config{VMName: "{{ .SourceName }}"}, newVMNameData("arm64", "abcdefghij", now))
+
+		assert.ErrorContains(t, err, `vm_name "{{ .SourceName }}" rendered to an invalid name: name is empty`)
+	})
+}
+
+func TestValidateVMName(t *testing.T) {
+	for _, name := range []string{"anka-packer-base-14.0-23A344", "source_foo-ABCDEabcde", "13.5"} {
+		assert.NilError(t, validateVMName(name), name)
+	}
+
+	for name, expected := range map[string]string{
+		"":                       "name is empty",
+		"my vm":                  "must start with a letter or digit",
+		"-flag":                  "must start with a letter or digit",
+		"team/vm":                "must start with a letter or digit",
+		strings.Repeat("a", 256): "is longer than 255 characters",
+	} {
+		assert.ErrorContains(t, validateVMName(name), expected, name)
+	}
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Capabilities is what the installed anka version supports. Steps and the client branch
+// on these rather than on the host CPU architecture.
+type Capabilities struct {
+	Version string
+	Major   int
+	Minor   int
+
+	// LocalTags means clones share the image of a tagged source template (Anka 3)
+	LocalTags bool
+	// Fuse means `anka run -v` can mount host folders into the guest with FUSE (Anka 2)
+	Fuse bool
+	// WaitTime means `anka run` supports --wait-time
+	WaitTime bool
+	// IPSWInstallers means `anka create` installs from .ipsw restore images rather than installer apps
+	IPSWInstallers bool
+	// CopyFlags are passed to `anka cp`: preserve attributes, recurse, follow symlinks and
+	// overwrite, which Anka 2 and Anka 3 both accept
+	CopyFlags []string
+	// HostDirectoryMounts means `anka modify mount` is available (Anka 3.9+)
+	HostDirectoryMounts bool
+}
+
+// NewCapabilities derives the capability set from an `anka version` string such as "3.9.1"
+func NewCapabilities(version string) (Capabilities, error) {
+	major, minor, err := ParseVersion(version)
+	if err != nil {
+		return Capabilities{}, err
+	}
+
+	capabilities := Capabilities{
+		Version:   version,
+		Major:     major,
+		Minor:     minor,
+		CopyFlags: []string{"-pRLf"},
+	}
+
+	if major >= 3 {
+		capabilities.LocalTags = true
+		capabilities.IPSWInstallers = true
+		capabilities.HostDirectoryMounts = major > 3 || minor >= 9
+	} else {
+		capabilities.Fuse = true
+		capabilities.WaitTime = true
+	}
+
+	return capabilities, nil
+}
+
+// ParseVersion returns the major and minor parts of an anka version string
+func ParseVersion(version string) (int, int, error) {
+	parts := strings.SplitN(strings.TrimSpace(version), ".", 3)
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not parse anka version %q", version)
+	}
+
+	minor := 0
+	if len(parts) > 1 {
+		minor, err = strconv.Atoi(parts[1])
+		if err != nil {
+			return 0, 0, fmt.Errorf("could not parse anka version %q", version)
+		}
+	}
+
+	return major, minor, nil
+}
+
+// Capabilities runs `anka version` the first time it's called and caches the result
+func (c *AnkaClient) Capabilities() (Capabilities, error) {
+	if c.capabilities != nil {
+		return *c.capabilities, nil
+	}
+
+	version, err := c.Version()
+	if err != nil {
+		return Capabilities{}, err
+	}
+
+	capabilities, err := NewCapabilities(version.Body.Version)
+	if err != nil {
+		return capabilities, err
+	}
+
+	c.capabilities = &capabilities
+
+	return capabilities, nil
+}
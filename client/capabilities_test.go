@@ -0,0 +1,73 @@
+package client
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestNewCapabilities(t *testing.T) {
+	t.Run("anka 2", func(t *testing.T) {
+		capabilities, err := NewCapabilities("2.5.7")
+
+		assert.NilError(t, err)
+		assert.Equal(t, true, capabilities.Fuse)
+		assert.Equal(t, true, capabilities.WaitTime)
+		assert.Equal(t, false, capabilities.LocalTags)
+		assert.DeepEqual(t, []string{"-pRLf"}, capabilities.CopyFlags)
+	})
+
+	t.Run("anka 3", func(t *testing.T) {
+		capabilities, err := NewCapabilities("3.9.1")
+
+		assert.NilError(t, err)
+		assert.Equal(t, false, capabilities.Fuse)
+		assert.Equal(t, true, capabilities.LocalTags)
+		assert.Equal(t, true, capabilities.IPSWInstallers)
+		assert.Equal(t, true, capabilities.HostDirectoryMounts)
+		assert.DeepEqual(t, []string{"-pRLf"}, capabilities.CopyFlags)
+	})
+
+	t.Run("unparseable version", func(t *testing.T) {
+		_, err := NewCapabilities("unknown")
+
+		assert.Error(t, err, `could not parse anka version "unknown"`)
+	})
+}
+
+func TestParseDescribeResponse(t *testing.T) {
+	t.Run("anka 2", func(t *testing.T) {
+		body := []byte(`{
+			"name": "foo", "uuid": "1234", "ram": "4G", "cpu": {"cores": 2, "threads": 0},
+			"usb": {"tablet": 1}, "smbios": {"type": "host"},
+			"hard_drives": [{"controller": "ablk", "pci_slot": 4, "file": "foo.ank"}],
+			"network_cards": [{"mode": "shared", "port_forwarding_rules": [{"guest_port": 22, "host_port": 2222, "rule_name": "ssh"}]}],
+			"display": {"headless": 0, "frame_buffer": {"vnc_port": 5900, "width": "1024", "height": 768}}
+		}`)
+
+		response, err := parseDescribeResponse(body)
+
+		assert.NilError(t, err)
+		assert.Equal(t, "foo", response.Name)
+		assert.Equal(t, 2, response.VCPU.Cores)
+		assert.Equal(t, "foo.ank", response.HardDrives[0].File)
+		assert.Equal(t, 2222, response.NetworkCards[0].PortForwardingRules[0].HostPort)
+		assert.Equal(t, 5900, response.Display.FrameBuffer.VncPort)
+		assert.Equal(t, "host", response.Smbios.Type)
+	})
+
+	t.Run("anka 3", func(t *testing.T) {
+		body := []byte(`{
+			"name": "foo", "uuid": "1234", "ram": "8G", "cpu": {"cores": 4},
+			"hard_drives": [{"file": "foo.ank"}],
+			"network_cards": [{"mode": "shared", "mac_address": "aa:bb:cc:dd:ee:ff"}]
+		}`)
+
+		response, err := parseDescribeResponse(body)
+
+		assert.NilError(t, err)
+		assert.Equal(t, "8G", response.RAM)
+		assert.Equal(t, 4, response.VCPU.Cores)
+		assert.Equal(t, "aa:bb:cc:dd:ee:ff", response.NetworkCards[0].MacAddress)
+	})
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"bytes"
 	"encoding/json"
+	"time"
 )
 
 const (
@@ -10,6 +11,8 @@ const (
 )
 
 type Client interface {
+	Capabilities() (Capabilities, error)
+	Config() (ConfigResponse, error)
 	Create(params CreateParams, outputStreamer chan string) (string, error)
 	CreateInstallerList() ([]CreateInstallerListResponse, error)
 	Clone(params CloneParams) error
@@ -18,12 +21,15 @@ type Client interface {
 	Describe(vmName string) (DescribeResponse, error)
 	Exists(vmName string) (bool, error)
 	License() (LicenseResponse, error)
+	List() ([]ListResponse, error)
 	Modify(vmName string, command string, property string, flags ...string) error
+	RegistryDescribe(registryParams RegistryParams, vmID string) (RegistryDescribeResponse, error)
 	RegistryList(registryParams RegistryParams) ([]RegistryListResponse, error)
 	RegistryListRepos() ([]RegistryRemote, error)
 	RegistryPull(registryParams RegistryParams, pullParams RegistryPullParams) error
 	RegistryPush(registryParams RegistryParams, pushParams RegistryPushParams) error
 	RegistryRevert(url string, id string) error
+	RegistryStatus(registryParams RegistryParams, timeout time.Duration) error
 	Run(params RunParams) (int, error)
 	Show(vmName string) (ShowResponse, error)
 	Start(params StartParams) error
@@ -35,6 +41,7 @@ type Client interface {
 }
 
 type AnkaClient struct {
+	capabilities *Capabilities
 }
 
 type MachineReadableError struct {
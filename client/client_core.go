@@ -8,6 +8,7 @@ import (
 	"io"
 	"log"
 	"os/exec"
+	"strings"
 
 	"github.com/veertuinc/packer-plugin-veertu-anka/common"
 )
@@ -18,13 +19,22 @@ const (
 )
 
 // https://docs.veertu.com/anka/intel/command-line-reference/#clone
+// CloneParams clones SourceUUID into VMName. Copy makes a full copy instead of a linked clone
+// that shares the source's image.
 type CloneParams struct {
 	VMName     string
 	SourceUUID string
+	Copy       bool
 }
 
 func (c *AnkaClient) Clone(params CloneParams) error {
-	_, err := runAnkaCommand("clone", params.SourceUUID, params.VMName)
+	args := []string{"clone"}
+	if params.Copy {
+		args = append(args, "--copy")
+	}
+	args = append(args, params.SourceUUID, params.VMName)
+
+	_, err := runAnkaCommand(args...)
 	if err != nil {
 		merr, ok := err.(MachineReadableError)
 		if ok {
@@ -45,17 +55,24 @@ type CopyParams struct {
 }
 
 func (c *AnkaClient) Copy(params CopyParams) error {
-	_, err := runAnkaCommand("cp", "-pRLf", params.Src, params.Dst)
+	capabilities, err := c.Capabilities()
+	if err != nil {
+		return err
+	}
+
+	args := append([]string{"cp"}, capabilities.CopyFlags...)
+	args = append(args, params.Src, params.Dst)
+
+	_, err = runAnkaCommand(args...)
 	return err
 }
 
 type CreateParams struct {
-	Name         string
-	Installer    string
-	OpticalDrive string
-	RAMSize      string
-	DiskSize     string
-	VCPUCount    string
+	Name      string
+	Installer string
+	RAMSize   string
+	DiskSize  string
+	VCPUCount string
 }
 
 type CreateInstallerListResponse struct {
@@ -113,8 +130,10 @@ func (c *AnkaClient) CreateInstallerList() ([]CreateInstallerListResponse, error
 }
 
 // https://docs.veertu.com/anka/intel/command-line-reference/#delete
+// DeleteParams deletes VMName, or only its local Tag when one is set (Anka 3)
 type DeleteParams struct {
 	VMName string
+	Tag    string
 }
 
 func (c *AnkaClient) Delete(params DeleteParams) error {
@@ -123,22 +142,32 @@ func (c *AnkaClient) Delete(params DeleteParams) error {
 		"--yes",
 	}
 
+	if params.Tag != "" {
+		args = append(args, "--tag", params.Tag)
+	}
+
 	args = append(args, params.VMName)
 
 	_, err := runAnkaCommand(args...)
 	return err
 }
 
-// https://docs.veertu.com/anka/intel/command-line-reference/#describe
+// DescribeResponse is the VM configuration reported by anka describe, with the Anka 2 and
+// Anka 3 schemas read into the same fields
 type DescribeResponse struct {
-	Name    string `json:"name"`
-	Version int    `json:"version"`
-	UUID    string `json:"uuid"`
-	VCPU    struct {
-		Cores   int `json:"cores"`
-		Threads int `json:"threads"`
-	} `json:"cpu"`
-	RAM string `json:"ram"`
+	Name          string                 `json:"name"`
+	Version       int                    `json:"version"`
+	UUID          string                 `json:"uuid"`
+	VCPU          DescribeVCPU           `json:"cpu"`
+	RAM           string                 `json:"ram"`
+	OpticalDrives []DescribeOpticalDrive `json:"optical_drives"`
+	HardDrives    []DescribeHardDrive    `json:"hard_drives"`
+	NetworkCards  []DescribeNetworkCard  `json:"network_cards"`
+	// Display is only reported by Anka 2
+	Display DescribeDisplay `json:"display"`
+
+	// Deprecated: the builder doesn't use Usb, Smbios, Smc, Nvram or Firmware. They're kept for
+	// existing callers and are empty when anka doesn't report them.
 	Usb struct {
 		Tablet   int         `json:"tablet"`
 		Kbd      int         `json:"kbd"`
@@ -147,63 +176,89 @@ type DescribeResponse struct {
 		PciSlot  int         `json:"pci_slot"`
 		Mouse    int         `json:"mouse"`
 	} `json:"usb"`
-	OpticalDrives []interface{} `json:"optical_drives"`
-	HardDrives    []struct {
-		Controller string `json:"controller"`
-		PciSlot    int    `json:"pci_slot"`
-		File       string `json:"file"`
-	} `json:"hard_drives"`
-	NetworkCards []struct {
-		Index               int    `json:"index"`
-		Mode                string `json:"mode"`
-		MacAddress          string `json:"mac_address"`
-		PortForwardingRules []struct {
-			GuestPort int    `json:"guest_port"`
-			RuleName  string `json:"rule_name"`
-			Protocol  string `json:"protocol"`
-			HostIP    string `json:"host_ip"`
-			HostPort  int    `json:"host_port"`
-		} `json:"port_forwarding_rules"`
-		PciSlot int    `json:"pci_slot"`
-		Type    string `json:"type"`
-	} `json:"network_cards"`
+	// Deprecated: see Usb
 	Smbios struct {
 		Type string `json:"type"`
 	} `json:"smbios"`
+	// Deprecated: see Usb
 	Smc struct {
 		Type string `json:"type"`
 	} `json:"smc"`
-	Nvram    bool `json:"nvram"`
+	// Deprecated: see Usb
+	Nvram bool `json:"nvram"`
+	// Deprecated: see Usb
 	Firmware struct {
 		Type string `json:"type"`
 	} `json:"firmware"`
-	Display struct {
-		Headless    int `json:"headless"`
-		FrameBuffer struct {
-			PciSlot  int         `json:"pci_slot"`
-			VncPort  int         `json:"vnc_port"`
-			Height   int         `json:"height"`
-			Width    json.Number `json:"width"` // json.Number to work around bug in 2.5.7 where width existed twice and was both an int and string
-			VncIP    string      `json:"vnc_ip"`
-			Password string      `json:"password"`
-		} `json:"frame_buffer"`
-	} `json:"display"`
 }
 
-func (c *AnkaClient) Describe(vmName string) (DescribeResponse, error) {
+type DescribeVCPU struct {
+	Cores   int `json:"cores"`
+	Threads int `json:"threads"`
+}
+
+type DescribeHardDrive struct {
+	Controller string `json:"controller"`
+	PciSlot    int    `json:"pci_slot"`
+	File       string `json:"file"`
+}
+
+type DescribeOpticalDrive struct {
+	Controller string `json:"controller"`
+	PciSlot    int    `json:"pci_slot"`
+	File       string `json:"file"`
+}
+
+type DescribeNetworkCard struct {
+	Index               int                          `json:"index"`
+	Mode                string                       `json:"mode"`
+	MacAddress          string                       `json:"mac_address"`
+	PortForwardingRules []DescribePortForwardingRule `json:"port_forwarding_rules"`
+	PciSlot             int                          `json:"pci_slot"`
+	Type                string                       `json:"type"`
+}
+
+type DescribePortForwardingRule struct {
+	GuestPort int    `json:"guest_port"`
+	RuleName  string `json:"rule_name"`
+	Protocol  string `json:"protocol"`
+	HostIP    string `json:"host_ip"`
+	HostPort  int    `json:"host_port"`
+}
+
+// https://docs.veertu.com/anka/intel/command-line-reference/#describe
+type DescribeDisplay struct {
+	Headless    int `json:"headless"`
+	FrameBuffer struct {
+		PciSlot  int         `json:"pci_slot"`
+		VncPort  int         `json:"vnc_port"`
+		Height   int         `json:"height"`
+		Width    json.Number `json:"width"` // json.Number to work around bug in 2.5.7 where width existed twice and was both an int and string
+		VncIP    string      `json:"vnc_ip"`
+		Password string      `json:"password"`
+	} `json:"frame_buffer"`
+}
+
+// parseDescribeResponse reads anka describe output. Both schemas share their field names, Anka 3
+// (https://docs.veertu.com/anka/apple/command-line-reference/#describe) just reports fewer of them.
+func parseDescribeResponse(body []byte) (DescribeResponse, error) {
 	var response DescribeResponse
 
-	output, err := runAnkaCommand("describe", vmName)
+	err := json.Unmarshal(body, &response)
 	if err != nil {
 		return response, err
 	}
 
-	err = json.Unmarshal(output.Body, &response)
+	return response, nil
+}
+
+func (c *AnkaClient) Describe(vmName string) (DescribeResponse, error) {
+	output, err := runAnkaCommand("describe", vmName)
 	if err != nil {
-		return response, err
+		return DescribeResponse{}, err
 	}
 
-	return response, nil
+	return parseDescribeResponse(output.Body)
 }
 
 // https://docs.veertu.com/anka/intel/command-line-reference/#show
@@ -222,6 +277,68 @@ func (c *AnkaClient) Exists(vmName string) (bool, error) {
 	return false, err
 }
 
+// https://docs.veertu.com/anka/intel/command-line-reference/#list
+type ListResponse struct {
+	UUID         string   `json:"uuid"`
+	Name         string   `json:"name"`
+	Status       string   `json:"status"`
+	Size         ListSize `json:"size"`
+	CreationDate string   `json:"creation_date"`
+}
+
+// ListSize holds the VM size from anka list, which is a byte count or a human readable
+// string depending on the anka version
+type ListSize string
+
+func (s *ListSize) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*s = ""
+		return nil
+	}
+	*s = ListSize(strings.Trim(string(data), `"`))
+	return nil
+}
+
+func (c *AnkaClient) List() ([]ListResponse, error) {
+	var response []ListResponse
+
+	output, err := runAnkaCommand("list")
+	if err != nil {
+		return response, err
+	}
+
+	err = json.Unmarshal(output.Body, &response)
+	if err != nil {
+		return response, err
+	}
+
+	return response, nil
+}
+
+// ConfigResponse holds the anka config settings the builder reads. The library directories are
+// empty when anka uses its default location.
+// https://docs.veertu.com/anka/apple/command-line-reference/#config
+type ConfigResponse struct {
+	VMLibDir  string `json:"vm_lib_dir"`
+	ImgLibDir string `json:"img_lib_dir"`
+}
+
+func (c *AnkaClient) Config() (ConfigResponse, error) {
+	var response ConfigResponse
+
+	output, err := runAnkaCommand("config")
+	if err != nil {
+		return response, err
+	}
+
+	err = json.Unmarshal(output.Body, &response)
+	if err != nil {
+		return response, err
+	}
+
+	return response, nil
+}
+
 // https://docs.veertu.com/anka/intel/command-line-reference/#license
 type LicenseResponse struct {
 	LicenseType string `json:"license_type"`
@@ -275,6 +392,14 @@ type RunParams struct {
 }
 
 func (c *AnkaClient) Run(params RunParams) (int, error) {
+	if params.WaitForTimeSync {
+		capabilities, err := c.Capabilities()
+		if err != nil {
+			return 0, err
+		}
+		params.WaitForTimeSync = capabilities.WaitTime
+	}
+
 	runner := NewRunner(params)
 
 	err := runner.Start()
@@ -296,6 +421,8 @@ type ShowResponse struct {
 	Status    string `json:"status"`
 	HardDrive uint64 `json:"hard_drive"`
 	Version   string `json:"version"`
+	// Arch is the architecture the VM runs on, empty when anka doesn't report it
+	Arch string `json:"arch"`
 }
 
 func (sr ShowResponse) IsRunning() bool {
@@ -422,6 +549,11 @@ func (c *AnkaClient) Version() (VersionResponse, error) {
 }
 
 func (c *AnkaClient) FuseAvailable(vmName string) bool {
+	capabilities, err := c.Capabilities()
+	if err != nil || !capabilities.Fuse {
+		return false
+	}
+
 	exitCode, _ := c.Run(RunParams{
 		VMName:  vmName,
 		Command: []string{"kextstat | grep \"com.veertu.filesystems.vtufs\" &>/dev/null"},
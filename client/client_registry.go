@@ -1,6 +1,8 @@
 package client
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,6 +10,8 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/packer-plugin-sdk/net"
 )
@@ -49,6 +53,45 @@ func (c *AnkaClient) RegistryList(registryParams RegistryParams) ([]RegistryList
 	return response, nil
 }
 
+// https://docs.veertu.com/anka/apple/command-line-reference/#registry-describe
+type RegistryDescribeResponse struct {
+	ID       string                    `json:"id"`
+	Name     string                    `json:"name"`
+	Versions []RegistryDescribeVersion `json:"versions"`
+	// Arch is the architecture the template runs on, empty when the registry doesn't report it
+	Arch string `json:"arch"`
+}
+
+// RegistryDescribeVersion is one tag of a VM template in the registry. Number grows with every push,
+// and Size is the disk size of the template at this tag in bytes.
+type RegistryDescribeVersion struct {
+	Tag         string `json:"tag"`
+	Number      int    `json:"number"`
+	ImageID     string `json:"image_id"`
+	Size        uint64 `json:"size"`
+	Description string `json:"description"`
+}
+
+func (c *AnkaClient) RegistryDescribe(registryParams RegistryParams, vmID string) (RegistryDescribeResponse, error) {
+	var response RegistryDescribeResponse
+
+	output, err := runRegistryCommand(registryParams, "describe", vmID)
+	if err != nil {
+		return response, err
+	}
+	if output.Status != "OK" {
+		log.Print("Error executing 'registry describe' command: ", output.ExceptionType, " ", output.Message)
+		return response, errors.New(output.Message)
+	}
+
+	err = json.Unmarshal(output.Body, &response)
+	if err != nil {
+		return response, err
+	}
+
+	return response, nil
+}
+
 type RegistryRemote struct {
 	Default bool   `json:"default"`
 	Url     string `json:"url"`
@@ -168,14 +211,72 @@ func (c *AnkaClient) RegistryRevert(url string, id string) error {
 	return nil
 }
 
+// https://docs.veertu.com/anka/anka-build-cloud/working-with-registry-and-api/#registry-status
+// RegistryStatus checks that the registry at registryParams.Remote, a URL, answers within
+// timeout, using the certificates in registryParams
+func (c *AnkaClient) RegistryStatus(registryParams RegistryParams, timeout time.Duration) error {
+	httpClient, err := registryHTTPClient(registryParams)
+	if err != nil {
+		return err
+	}
+	httpClient.Timeout = timeout
+
+	response, err := doRegistryRESTRequest(httpClient, "GET", fmt.Sprintf("%s/registry/status", strings.TrimSuffix(registryParams.Remote, "/")), nil)
+	if err != nil {
+		return err
+	}
+	if response.Status != statusOK {
+		return fmt.Errorf("registry is not healthy: %s", response.Message)
+	}
+
+	return nil
+}
+
+// registryHTTPClient talks to the registry with the same certificates anka registry would use
+func registryHTTPClient(registryParams RegistryParams) (*http.Client, error) {
+	httpClient := net.HttpClientWithEnvironmentProxy()
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: registryParams.IsInsecure}
+
+	if registryParams.NodeCertPath != "" {
+		keyPath := registryParams.NodeKeyPath
+		if keyPath == "" {
+			keyPath = registryParams.NodeCertPath
+		}
+		certificate, err := tls.LoadX509KeyPair(registryParams.NodeCertPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load registry certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	if registryParams.CaRootPath != "" {
+		caRoot, err := ioutil.ReadFile(registryParams.CaRootPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read registry CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caRoot) {
+			return nil, fmt.Errorf("no certificates found in %s", registryParams.CaRootPath)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	httpClient.Transport.(*http.Transport).TLSClientConfig = tlsConfig
+
+	return httpClient, nil
+}
+
 func registryRESTRequest(method string, url string, body io.Reader) (MachineReadableOutput, error) {
+	return doRegistryRESTRequest(net.HttpClientWithEnvironmentProxy(), method, url, body)
+}
+
+func doRegistryRESTRequest(httpClient *http.Client, method string, url string, body io.Reader) (MachineReadableOutput, error) {
 	request, err := http.NewRequest(method, url, body)
 	if err != nil {
 		return MachineReadableOutput{}, err
 	}
 
-	httpClient := net.HttpClientWithEnvironmentProxy()
-
 	resp, err := httpClient.Do(request)
 	if err != nil {
 		return MachineReadableOutput{}, err
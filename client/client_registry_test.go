@@ -0,0 +1,39 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRegistryStatus(t *testing.T) {
+	ankaClient := &AnkaClient{}
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/registry/status", r.URL.Path)
+		_, _ = w.Write([]byte(`{"status":"OK","message":"","body":{"status":"Running","version":"1.44.0"}}`))
+	}))
+	defer healthy.Close()
+
+	assert.NilError(t, ankaClient.RegistryStatus(RegistryParams{Remote: healthy.URL + "/"}, time.Second))
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status":"FAIL","message":"storage unavailable"}`))
+	}))
+	defer failing.Close()
+
+	assert.Error(t, ankaClient.RegistryStatus(RegistryParams{Remote: failing.URL}, time.Second), "registry is not healthy: storage unavailable")
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+
+	assert.ErrorContains(t, ankaClient.RegistryStatus(RegistryParams{Remote: slow.URL}, 50*time.Millisecond), "Client.Timeout exceeded")
+
+	err := ankaClient.RegistryStatus(RegistryParams{Remote: healthy.URL, CaRootPath: "/nonexistent/ca.pem"}, time.Second)
+	assert.ErrorContains(t, err, "failed to read registry CA certificate")
+}
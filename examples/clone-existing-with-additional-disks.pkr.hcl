@@ -0,0 +1,37 @@
+variable "source_vm_name" {
+  type = string
+  default = "anka-packer-base-macos"
+}
+
+variable "vm_name" {
+  type = string
+  default = "anka-packer-from-source-with-additional-disks"
+}
+
+variable "optical_drive_path" {
+  type = string
+}
+
+source "veertu-anka-vm-clone" "anka-packer-from-source-with-additional-disks" {
+  vm_name = "${var.vm_name}"
+  source_vm_name = "${var.source_vm_name}"
+  additional_disks {
+    size = "20G"
+  }
+  optical_drives {
+    path = "${var.optical_drive_path}"
+    detach_after_build = true
+  }
+}
+
+build {
+  sources = [
+    "source.veertu-anka-vm-clone.anka-packer-from-source-with-additional-disks",
+  ]
+
+  provisioner "shell" {
+    inline = [
+      "diskutil list"
+    ]
+  }
+}
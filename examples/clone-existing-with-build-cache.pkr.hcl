@@ -0,0 +1,21 @@
+variable "source_vm_name" {
+  type = string
+  default = "anka-packer-base-macos"
+}
+
+source "veertu-anka-vm-clone" "anka-packer-from-source" {
+  vm_name = "anka-packer-from-source-{{ .Timestamp }}"
+  source_vm_name = "${var.source_vm_name}"
+  build_cache = true
+  build_cache_inputs = ["./examples/ansible"]
+}
+
+build {
+  sources = [
+    "source.veertu-anka-vm-clone.anka-packer-from-source",
+  ]
+  provisioner "file" {
+    destination = "/private/tmp/"
+    source      = "./examples/ansible"
+  }
+}
@@ -0,0 +1,22 @@
+variable "source_vm_name" {
+  type = string
+  default = "anka-packer-base-macos"
+}
+
+variable "vm_name" {
+  type = string
+  default = "anka-packer-from-source-with-disk-shrink"
+}
+
+source "veertu-anka-vm-clone" "anka-packer-from-source-with-disk-shrink" {
+  vm_name = "${var.vm_name}"
+  source_vm_name = "${var.source_vm_name}"
+  disk_size = "60G"
+  allow_disk_shrink = true
+}
+
+build {
+  sources = [
+    "source.veertu-anka-vm-clone.anka-packer-from-source-with-disk-shrink",
+  ]
+}
\ No newline at end of file
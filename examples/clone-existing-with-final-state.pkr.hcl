@@ -0,0 +1,29 @@
+variable "source_vm_name" {
+  type = string
+  default = "anka-packer-base-macos"
+}
+
+variable "vm_name" {
+  type = string
+  default = "anka-packer-from-source-with-final-state"
+}
+
+source "veertu-anka-vm-clone" "anka-packer-from-source-with-final-state" {
+  vm_name = "${var.vm_name}"
+  source_vm_name = "${var.source_vm_name}"
+  final_state = "shutdown"
+  final_state_timeout = "3m"
+}
+
+build {
+  sources = [
+    "source.veertu-anka-vm-clone.anka-packer-from-source-with-final-state",
+  ]
+
+  provisioner "shell" {
+    inline = [
+      "echo hello world",
+      "echo llamas rock"
+    ]
+  }
+}
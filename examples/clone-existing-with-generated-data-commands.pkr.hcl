@@ -0,0 +1,37 @@
+variable "source_vm_name" {
+  type = string
+  default = "anka-packer-base-macos"
+}
+
+variable "vm_name" {
+  type = string
+  default = "anka-packer-from-source-with-generated-data-commands"
+}
+
+source "veertu-anka-vm-clone" "anka-packer-from-source-with-generated-data-commands" {
+  vm_name = "${var.vm_name}"
+  source_vm_name = "${var.source_vm_name}"
+  generated_data_commands = {
+    XcodeBuild = "xcodebuild -version | head -1"
+    BrewVersion = "/opt/homebrew/bin/brew --version | head -1"
+  }
+  generated_data_commands_on_error = "warn"
+}
+
+build {
+  sources = [
+    "source.veertu-anka-vm-clone.anka-packer-from-source-with-generated-data-commands",
+  ]
+
+  provisioner "shell" {
+    inline = [
+      "echo hello world",
+      "echo llamas rock"
+    ]
+  }
+
+  post-processor "veertu-anka-registry-push" {
+    tag = "${build.OSVersion}-${build.OSBuild}"
+    description = "${build.XcodeBuild}, ${build.BrewVersion}"
+  }
+}
@@ -0,0 +1,18 @@
+variable "source_vm_name" {
+  type = string
+  default = "anka-packer-base-macos"
+}
+
+source "veertu-anka-vm-clone" "anka-packer-from-source" {
+  vm_name = "anka-packer-from-source"
+  source_vm_name = "${var.source_vm_name}"
+  clone_mode = "linked"
+  local_tag = "packer-{{ .SourceName }}-{{ .Timestamp }}"
+  local_tag_keep = 3
+}
+
+build {
+  sources = [
+    "source.veertu-anka-vm-clone.anka-packer-from-source",
+  ]
+}
@@ -0,0 +1,32 @@
+variable "source_vm_name" {
+  type = string
+  default = "anka-packer-base-macos"
+}
+
+variable "vm_name" {
+  type = string
+  default = "anka-packer-from-source-with-orphaned-vm-cleanup"
+}
+
+source "veertu-anka-vm-clone" "anka-packer-from-source-with-orphaned-vm-cleanup" {
+  vm_name = "${var.vm_name}"
+  source_vm_name = "${var.source_vm_name}"
+  orphaned_vm_cleanup {
+    patterns = ["${var.source_vm_name}-*"]
+    older_than = "12h"
+    dry_run = true
+  }
+}
+
+build {
+  sources = [
+    "source.veertu-anka-vm-clone.anka-packer-from-source-with-orphaned-vm-cleanup",
+  ]
+
+  provisioner "shell" {
+    inline = [
+      "echo hello world",
+      "echo llamas rock"
+    ]
+  }
+}
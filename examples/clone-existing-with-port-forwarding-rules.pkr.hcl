@@ -24,6 +24,7 @@ source "veertu-anka-vm-clone" "anka-packer-from-source-with-port-rules" {
   }
   port_forwarding_rules {
     port_forwarding_guest_port = 8080
+    port_forwarding_rule_name = "api"
   }
   vcpu_count = 8
   ram_size = "10G"
@@ -40,4 +41,10 @@ build {
       "echo llamas rock"
     ]
   }
+
+  provisioner "shell-local" {
+    inline = [
+      "echo api is forwarded to host port ${build.PortForward_api}"
+    ]
+  }
 }
\ No newline at end of file
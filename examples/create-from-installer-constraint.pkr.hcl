@@ -0,0 +1,22 @@
+variable "installer" {
+  type = string
+  default = "~> 14.5"
+}
+
+source "veertu-anka-vm-create" "base" {
+  installer = "${var.installer}"
+  installer_strict = true
+  vm_name = "anka-packer-base-{{ .OSVersion }}-{{ .Build }}"
+}
+
+build {
+  sources = [
+    "source.veertu-anka-vm-create.base"
+  ]
+
+  provisioner "shell-local" {
+    inline = [
+      "echo created from macOS ${build.InstallerVersion} (${build.InstallerBuild})"
+    ]
+  }
+}
@@ -0,0 +1,27 @@
+variable "installer_url" {
+  type = string
+  default = "https://downloads.example.com/UniversalMac_14.0_23A344_Restore.ipsw"
+}
+
+variable "installer_checksum" {
+  type = string
+  default = "none"
+}
+
+source "veertu-anka-vm-create" "base" {
+  installer_url = "${var.installer_url}"
+  installer_checksum = "${var.installer_checksum}"
+  vm_name = "anka-packer-base-{{ .OSVersion }}-{{ .Build }}"
+}
+
+build {
+  sources = [
+    "source.veertu-anka-vm-create.base"
+  ]
+
+  provisioner "shell" {
+    inline = [
+      "sw_vers"
+    ]
+  }
+}
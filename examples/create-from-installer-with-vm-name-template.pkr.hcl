@@ -0,0 +1,22 @@
+variable "installer" {
+  type = string
+  default = "latest"
+}
+
+source "veertu-anka-vm-create" "base-with-vm-name-template" {
+  installer = "${var.installer}"
+  vm_name = "ios-team-{{ .OSVersion }}-{{ .Build }}-{{ .Arch }}-{{ .Timestamp }}"
+}
+
+build {
+  sources = [
+    "source.veertu-anka-vm-create.base-with-vm-name-template"
+  ]
+
+  provisioner "shell" {
+    inline = [
+      "echo hello world",
+      "echo llamas rock"
+    ]
+  }
+}
@@ -0,0 +1,28 @@
+variable "source_vm_name" {
+  type = string
+  default = "anka-packer-base-macos"
+}
+
+variable "source_vm_tag_filter" {
+  type = string
+  default = "14.*-15.*"
+}
+
+source "veertu-anka-vm-clone" "anka-packer-from-source" {
+  vm_name = "anka-packer-from-{{ .SourceTag }}"
+  source_vm_name = "${var.source_vm_name}"
+  source_vm_tag_filter = "${var.source_vm_tag_filter}"
+  source_vm_tag_sort = "date"
+}
+
+build {
+  sources = [
+    "source.veertu-anka-vm-clone.anka-packer-from-source",
+  ]
+
+  provisioner "shell-local" {
+    inline = [
+      "echo cloned ${build.SourceVMTag} (${build.SourceVMID})"
+    ]
+  }
+}
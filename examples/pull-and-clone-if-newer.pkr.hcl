@@ -0,0 +1,22 @@
+variable "source_vm_name" {
+  type = string
+  default = "anka-packer-base-macos"
+}
+
+source "veertu-anka-vm-clone" "anka-packer-from-source" {
+  vm_name = "anka-packer-from-source"
+  source_vm_name = "${var.source_vm_name}"
+  fetch_policy = "if_newer"
+}
+
+build {
+  sources = [
+    "source.veertu-anka-vm-clone.anka-packer-from-source",
+  ]
+
+  provisioner "shell-local" {
+    inline = [
+      "echo cloned ${build.SourceVMTag}"
+    ]
+  }
+}
@@ -0,0 +1,33 @@
+variable "source_vm_name" {
+  type = string
+  default = "anka-packer-base-macos"
+}
+
+variable "source_vm_id" {
+  type = string
+  default = "c0847bc9-5d2d-4dbc-ba6a-240f7ff08032"
+}
+
+variable "source_vm_tag_id" {
+  type = string
+  default = "bc7b1fe0-3dba-4c8e-a4e5-0a2d8f0e8e31"
+}
+
+source "veertu-anka-vm-clone" "anka-packer-from-source" {
+  vm_name = "anka-packer-from-{{ .SourceTag }}"
+  source_vm_name = "${var.source_vm_name}"
+  source_vm_id = "${var.source_vm_id}"
+  source_vm_tag_id = "${var.source_vm_tag_id}"
+}
+
+build {
+  sources = [
+    "source.veertu-anka-vm-clone.anka-packer-from-source",
+  ]
+
+  provisioner "shell-local" {
+    inline = [
+      "echo cloned ${build.SourceVMTag} (${build.SourceVMID})"
+    ]
+  }
+}
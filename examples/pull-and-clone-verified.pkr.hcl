@@ -0,0 +1,26 @@
+variable "source_vm_name" {
+  type = string
+  default = "anka-packer-base-macos"
+}
+
+variable "source_vm_tag" {
+  type = string
+  default = "v1"
+}
+
+source "veertu-anka-vm-clone" "anka-packer-from-source" {
+  vm_name = "anka-packer-from-source"
+  source_vm_name = "${var.source_vm_name}"
+  source_vm_tag = "${var.source_vm_tag}"
+  always_fetch = true
+  pull_local = true
+  pull_shrink = true
+  pull_verify = true
+  pull_attempts = 3
+}
+
+build {
+  sources = [
+    "source.veertu-anka-vm-clone.anka-packer-from-source",
+  ]
+}
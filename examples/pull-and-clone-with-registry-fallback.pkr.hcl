@@ -0,0 +1,35 @@
+variable "source_vm_name" {
+  type = string
+  default = "anka-packer-base-macos"
+}
+
+source "veertu-anka-vm-clone" "anka-packer-from-source" {
+  vm_name = "anka-packer-from-source"
+  source_vm_name = "${var.source_vm_name}"
+  always_fetch = true
+
+  remotes {
+    remote = "primary"
+  }
+
+  remotes {
+    remote = "https://anka-mirror.example.com:8089"
+    cert = "/Users/anka/certs/node-cert.pem"
+    key = "/Users/anka/certs/node-key.pem"
+    cacert = "/Users/anka/certs/anka-ca-crt.pem"
+  }
+
+  remote_timeout = "5s"
+}
+
+build {
+  sources = [
+    "source.veertu-anka-vm-clone.anka-packer-from-source",
+  ]
+
+  provisioner "shell-local" {
+    inline = [
+      "echo pulled ${build.SourceVMTag} from ${build.SourceRemote}"
+    ]
+  }
+}
@@ -6,6 +6,7 @@ package mocks
 
 import (
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	client "github.com/veertuinc/packer-plugin-veertu-anka/client"
@@ -34,6 +35,21 @@ func (m *MockClient) EXPECT() *MockClientMockRecorder {
 	return m.recorder
 }
 
+// Capabilities mocks base method.
+func (m *MockClient) Capabilities() (client.Capabilities, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Capabilities")
+	ret0, _ := ret[0].(client.Capabilities)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Capabilities indicates an expected call of Capabilities.
+func (mr *MockClientMockRecorder) Capabilities() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Capabilities", reflect.TypeOf((*MockClient)(nil).Capabilities))
+}
+
 // Clone mocks base method.
 func (m *MockClient) Clone(params client.CloneParams) error {
 	m.ctrl.T.Helper()
@@ -48,6 +64,21 @@ func (mr *MockClientMockRecorder) Clone(params interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Clone", reflect.TypeOf((*MockClient)(nil).Clone), params)
 }
 
+// Config mocks base method.
+func (m *MockClient) Config() (client.ConfigResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Config")
+	ret0, _ := ret[0].(client.ConfigResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Config indicates an expected call of Config.
+func (mr *MockClientMockRecorder) Config() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Config", reflect.TypeOf((*MockClient)(nil).Config))
+}
+
 // Copy mocks base method.
 func (m *MockClient) Copy(params client.CopyParams) error {
 	m.ctrl.T.Helper()
@@ -165,6 +196,21 @@ func (mr *MockClientMockRecorder) License() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "License", reflect.TypeOf((*MockClient)(nil).License))
 }
 
+// List mocks base method.
+func (m *MockClient) List() ([]client.ListResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List")
+	ret0, _ := ret[0].([]client.ListResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockClientMockRecorder) List() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockClient)(nil).List))
+}
+
 // Modify mocks base method.
 func (m *MockClient) Modify(vmName, command, property string, flags ...string) error {
 	m.ctrl.T.Helper()
@@ -184,6 +230,21 @@ func (mr *MockClientMockRecorder) Modify(vmName, command, property interface{},
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Modify", reflect.TypeOf((*MockClient)(nil).Modify), varargs...)
 }
 
+// RegistryDescribe mocks base method.
+func (m *MockClient) RegistryDescribe(registryParams client.RegistryParams, vmID string) (client.RegistryDescribeResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RegistryDescribe", registryParams, vmID)
+	ret0, _ := ret[0].(client.RegistryDescribeResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RegistryDescribe indicates an expected call of RegistryDescribe.
+func (mr *MockClientMockRecorder) RegistryDescribe(registryParams, vmID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegistryDescribe", reflect.TypeOf((*MockClient)(nil).RegistryDescribe), registryParams, vmID)
+}
+
 // RegistryList mocks base method.
 func (m *MockClient) RegistryList(registryParams client.RegistryParams) ([]client.RegistryListResponse, error) {
 	m.ctrl.T.Helper()
@@ -256,6 +317,20 @@ func (mr *MockClientMockRecorder) RegistryRevert(url, id interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegistryRevert", reflect.TypeOf((*MockClient)(nil).RegistryRevert), url, id)
 }
 
+// RegistryStatus mocks base method.
+func (m *MockClient) RegistryStatus(registryParams client.RegistryParams, timeout time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RegistryStatus", registryParams, timeout)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RegistryStatus indicates an expected call of RegistryStatus.
+func (mr *MockClientMockRecorder) RegistryStatus(registryParams, timeout interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegistryStatus", reflect.TypeOf((*MockClient)(nil).RegistryStatus), registryParams, timeout)
+}
+
 // Run mocks base method.
 func (m *MockClient) Run(params client.RunParams) (int, error) {
 	m.ctrl.T.Helper()
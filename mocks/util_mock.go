@@ -66,34 +66,34 @@ func (mr *MockUtilMockRecorder) ConvertDiskSizeToBytes(diskSize interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConvertDiskSizeToBytes", reflect.TypeOf((*MockUtil)(nil).ConvertDiskSizeToBytes), diskSize)
 }
 
-// ObtainMacOSVersionFromInstallerApp mocks base method.
-func (m *MockUtil) ObtainMacOSVersionFromInstallerApp(path string) (util.InstallerAppPlist, error) {
+// FreeDiskSpace mocks base method.
+func (m *MockUtil) FreeDiskSpace(path string) (uint64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ObtainMacOSVersionFromInstallerApp", path)
-	ret0, _ := ret[0].(util.InstallerAppPlist)
+	ret := m.ctrl.Call(m, "FreeDiskSpace", path)
+	ret0, _ := ret[0].(uint64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// ObtainMacOSVersionFromInstallerApp indicates an expected call of ObtainMacOSVersionFromInstallerApp.
-func (mr *MockUtilMockRecorder) ObtainMacOSVersionFromInstallerApp(path interface{}) *gomock.Call {
+// FreeDiskSpace indicates an expected call of FreeDiskSpace.
+func (mr *MockUtilMockRecorder) FreeDiskSpace(path interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ObtainMacOSVersionFromInstallerApp", reflect.TypeOf((*MockUtil)(nil).ObtainMacOSVersionFromInstallerApp), path)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FreeDiskSpace", reflect.TypeOf((*MockUtil)(nil).FreeDiskSpace), path)
 }
 
-// ObtainMacOSVersionFromInstallerIPSW mocks base method.
-func (m *MockUtil) ObtainMacOSVersionFromInstallerIPSW(path string) (util.InstallerIPSWPlist, error) {
+// HostResources mocks base method.
+func (m *MockUtil) HostResources() (util.HostResources, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ObtainMacOSVersionFromInstallerIPSW", path)
-	ret0, _ := ret[0].(util.InstallerIPSWPlist)
+	ret := m.ctrl.Call(m, "HostResources")
+	ret0, _ := ret[0].(util.HostResources)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// ObtainMacOSVersionFromInstallerIPSW indicates an expected call of ObtainMacOSVersionFromInstallerIPSW.
-func (mr *MockUtilMockRecorder) ObtainMacOSVersionFromInstallerIPSW(path interface{}) *gomock.Call {
+// HostResources indicates an expected call of HostResources.
+func (mr *MockUtilMockRecorder) HostResources() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ObtainMacOSVersionFromInstallerIPSW", reflect.TypeOf((*MockUtil)(nil).ObtainMacOSVersionFromInstallerIPSW), path)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HostResources", reflect.TypeOf((*MockUtil)(nil).HostResources))
 }
 
 // RandSeq mocks base method.
@@ -110,6 +110,21 @@ func (mr *MockUtilMockRecorder) RandSeq(n interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RandSeq", reflect.TypeOf((*MockUtil)(nil).RandSeq), n)
 }
 
+// ReadInstallerInfo mocks base method.
+func (m *MockUtil) ReadInstallerInfo(path string) (util.InstallerInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadInstallerInfo", path)
+	ret0, _ := ret[0].(util.InstallerInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadInstallerInfo indicates an expected call of ReadInstallerInfo.
+func (mr *MockUtilMockRecorder) ReadInstallerInfo(path interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadInstallerInfo", reflect.TypeOf((*MockUtil)(nil).ReadInstallerInfo), path)
+}
+
 // StepError mocks base method.
 func (m *MockUtil) StepError(ui packer.Ui, state multistep.StateBag, err error) multistep.StepAction {
 	m.ctrl.T.Helper()
@@ -0,0 +1,254 @@
+package util
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/groob/plist"
+)
+
+// Kinds of installer anka can create VMs from
+const (
+	InstallerKindIPSW = "ipsw"
+	InstallerKindApp  = "app"
+)
+
+// virtualMacProductType is the device model Apple's virtualization framework restores to
+const virtualMacProductType = "VirtualMac2,1"
+
+// InstallerInfo describes a macOS installer app or IPSW
+type InstallerInfo struct {
+	Path        string
+	Kind        string
+	ProductName string
+	OSVersion   string
+	Build       string
+	// AppVersion is the installer app's own version (CFBundleShortVersionString)
+	AppVersion string
+
+	// SupportedDeviceModels are the product types an IPSW restores to, such as VirtualMac2,1
+	SupportedDeviceModels []string
+	SupportsVirtualMac    bool
+	// MinimumSystemPartitionMB is the smallest system partition the IPSW restores to
+	MinimumSystemPartitionMB int
+
+	// SharedSupportOSVersion is the macOS version in the installer app's SharedSupport, which
+	// can be more precise than the OSVersion its Info.plist reports
+	SharedSupportOSVersion string
+	// SharedSupportImage is the installer app's SharedSupport.dmg or InstallESD.dmg, if any
+	SharedSupportImage string
+}
+
+type systemVersionPlist struct {
+	ProductName         string `plist:"ProductName"`
+	ProductVersion      string `plist:"ProductVersion"`
+	ProductBuildVersion string `plist:"ProductBuildVersion"`
+}
+
+type buildManifestPlist struct {
+	ProductVersion        string   `plist:"ProductVersion"`
+	ProductBuildVersion   string   `plist:"ProductBuildVersion"`
+	SupportedProductTypes []string `plist:"SupportedProductTypes"`
+}
+
+type restorePlist struct {
+	ProductVersion         string   `plist:"ProductVersion"`
+	ProductBuildVersion    string   `plist:"ProductBuildVersion"`
+	SupportedProductTypes  []string `plist:"SupportedProductTypes"`
+	MinimumSystemPartition int      `plist:"MinimumSystemPartition"`
+}
+
+type installerAppInfoPlist struct {
+	DisplayName     string `plist:"CFBundleDisplayName"`
+	PlatformVersion string `plist:"DTPlatformVersion"`
+	ShortVersion    string `plist:"CFBundleShortVersionString"`
+}
+
+type installInfoPlist struct {
+	SystemImageInfo struct {
+		Version string `plist:"version"`
+	} `plist:"System Image Info"`
+}
+
+// ReadInstallerInfo reads the metadata of a macOS installer app or IPSW
+func ReadInstallerInfo(path string) (InstallerInfo, error) {
+	switch strings.ToLower(filepath.Ext(strings.TrimSuffix(path, "/"))) {
+	case ".ipsw":
+		return ReadIPSWInfo(path)
+	case ".app":
+		return ReadInstallerAppInfo(path)
+	default:
+		return InstallerInfo{}, fmt.Errorf("installer %q is neither an .app nor an .ipsw", path)
+	}
+}
+
+// ReadIPSWInfo reads the version, build and supported devices from the plists at the root of an IPSW
+func ReadIPSWInfo(path string) (InstallerInfo, error) {
+	info := InstallerInfo{Path: path, Kind: InstallerKindIPSW}
+
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return info, fmt.Errorf("failed to open ipsw %q: %w", path, err)
+	}
+	defer archive.Close()
+
+	var systemVersion systemVersionPlist
+	foundSystemVersion, err := decodeZipPlist(&archive.Reader, "SystemVersion.plist", &systemVersion)
+	if err != nil {
+		return info, fmt.Errorf("ipsw %q: %w", path, err)
+	}
+
+	var buildManifest buildManifestPlist
+	foundBuildManifest, err := decodeZipPlist(&archive.Reader, "BuildManifest.plist", &buildManifest)
+	if err != nil {
+		return info, fmt.Errorf("ipsw %q: %w", path, err)
+	}
+
+	var restore restorePlist
+	foundRestore, err := decodeZipPlist(&archive.Reader, "Restore.plist", &restore)
+	if err != nil {
+		return info, fmt.Errorf("ipsw %q: %w", path, err)
+	}
+
+	if !foundSystemVersion && !foundBuildManifest && !foundRestore {
+		return info, fmt.Errorf("ipsw %q contains none of SystemVersion.plist, BuildManifest.plist or Restore.plist", path)
+	}
+
+	info.ProductName = systemVersion.ProductName
+	info.OSVersion = firstNonEmpty(systemVersion.ProductVersion, buildManifest.ProductVersion, restore.ProductVersion)
+	info.Build = firstNonEmpty(systemVersion.ProductBuildVersion, buildManifest.ProductBuildVersion, restore.ProductBuildVersion)
+	if info.OSVersion == "" || info.Build == "" {
+		return info, fmt.Errorf("ipsw %q has no product version or build", path)
+	}
+
+	info.SupportedDeviceModels = mergeStrings(buildManifest.SupportedProductTypes, restore.SupportedProductTypes)
+	for _, model := range info.SupportedDeviceModels {
+		if model == virtualMacProductType {
+			info.SupportsVirtualMac = true
+		}
+	}
+
+	info.MinimumSystemPartitionMB = restore.MinimumSystemPartition
+
+	return info, nil
+}
+
+// ReadInstallerAppInfo reads the version of an installer app from its Info.plist, and the OS
+// version recorded in SharedSupport when the app has one.
+func ReadInstallerAppInfo(path string) (InstallerInfo, error) {
+	info := InstallerInfo{Path: path, Kind: InstallerKindApp}
+
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return info, fmt.Errorf("installer app does not exist at %q: %w", path, err)
+	}
+	if err != nil {
+		return info, fmt.Errorf("failed to stat installer at %q: %w", path, err)
+	}
+
+	var appInfo installerAppInfoPlist
+	plistPath := filepath.Join(path, "Contents", "Info.plist")
+	err = decodePlistFile(plistPath, &appInfo)
+	if os.IsNotExist(err) {
+		return info, fmt.Errorf("installer app info plist did not exist at %q: %w", plistPath, err)
+	}
+	if err != nil {
+		return info, fmt.Errorf("failed to read installer app info plist at %q: %w", plistPath, err)
+	}
+
+	info.ProductName = appInfo.DisplayName
+	info.OSVersion = appInfo.PlatformVersion
+	info.AppVersion = appInfo.ShortVersion
+
+	sharedSupport := filepath.Join(path, "Contents", "SharedSupport")
+
+	var installInfo installInfoPlist
+	installInfoPath := filepath.Join(sharedSupport, "InstallInfo.plist")
+	err = decodePlistFile(installInfoPath, &installInfo)
+	if err != nil && !os.IsNotExist(err) {
+		return info, fmt.Errorf("failed to read installer app shared support plist at %q: %w", installInfoPath, err)
+	}
+	info.SharedSupportOSVersion = installInfo.SystemImageInfo.Version
+
+	for _, image := range []string{"SharedSupport.dmg", "InstallESD.dmg"} {
+		imagePath := filepath.Join(sharedSupport, image)
+		if _, err := os.Stat(imagePath); err == nil {
+			info.SharedSupportImage = imagePath
+			break
+		}
+	}
+
+	if info.OSVersion == "" {
+		return info, fmt.Errorf("installer app %q has no macOS version in %s", path, plistPath)
+	}
+
+	return info, nil
+}
+
+// decodeZipPlist decodes the named plist from the root of the archive, reporting whether it exists
+func decodeZipPlist(archive *zip.Reader, name string, v interface{}) (bool, error) {
+	file, err := archive.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return true, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	err = plist.Unmarshal(content, v)
+	if err != nil {
+		return true, fmt.Errorf("failed to decode %s: %w", name, err)
+	}
+
+	return true, nil
+}
+
+// decodePlistFile decodes an XML or binary plist file. A missing file returns an os.IsNotExist error.
+func decodePlistFile(path string, v interface{}) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return plist.Unmarshal(content, v)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// mergeStrings appends the values missing from existing, skipping empty ones
+func mergeStrings(existing []string, values []string) []string {
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		found := false
+		for _, e := range existing {
+			if e == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			existing = append(existing, value)
+		}
+	}
+	return existing
+}
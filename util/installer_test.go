@@ -0,0 +1,133 @@
+package util
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// writeIPSW zips the named fixtures from test-fixtures/ipsw into an IPSW in a temp dir
+func writeIPSW(t *testing.T, fixtures ...string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "UniversalMac_14.0_23A344_Restore.ipsw")
+	file, err := os.Create(path)
+	assert.NilError(t, err)
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	for _, fixture := range fixtures {
+		content, err := os.ReadFile(filepath.Join("test-fixtures", "ipsw", fixture))
+		assert.NilError(t, err)
+
+		entry, err := archive.Create(fixture)
+		assert.NilError(t, err)
+		_, err = entry.Write(content)
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, archive.Close())
+
+	return path
+}
+
+func TestReadIPSWInfo(t *testing.T) {
+	t.Run("reads every plist", func(t *testing.T) {
+		path := writeIPSW(t, "SystemVersion.plist", "BuildManifest.plist", "Restore.plist")
+
+		info, err := ReadInstallerInfo(path)
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, InstallerInfo{
+			Path:                     path,
+			Kind:                     InstallerKindIPSW,
+			ProductName:              "macOS",
+			OSVersion:                "14.0",
+			Build:                    "23A344",
+			SupportedDeviceModels:    []string{"Mac14,3", "VirtualMac2,1", "Mac14,7"},
+			SupportsVirtualMac:       true,
+			MinimumSystemPartitionMB: 12288,
+		}, info)
+	})
+
+	t.Run("falls back to the build manifest", func(t *testing.T) {
+		info, err := ReadIPSWInfo(writeIPSW(t, "BuildManifest.plist"))
+
+		assert.NilError(t, err)
+		assert.Equal(t, "14.0", info.OSVersion)
+		assert.Equal(t, "23A344", info.Build)
+		assert.Equal(t, true, info.SupportsVirtualMac)
+	})
+
+	t.Run("requires version plists", func(t *testing.T) {
+		_, err := ReadIPSWInfo(writeIPSW(t))
+
+		assert.ErrorContains(t, err, "contains none of SystemVersion.plist, BuildManifest.plist or Restore.plist")
+	})
+
+	t.Run("rejects files that aren't zips", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "broken.ipsw")
+		assert.NilError(t, os.WriteFile(path, []byte("not a zip"), 0o644))
+
+		_, err := ReadIPSWInfo(path)
+
+		assert.ErrorContains(t, err, "failed to open ipsw")
+	})
+
+	t.Run("reports missing files", func(t *testing.T) {
+		_, err := ReadIPSWInfo(filepath.Join(t.TempDir(), "missing.ipsw"))
+
+		assert.ErrorContains(t, err, "failed to open ipsw")
+	})
+}
+
+func TestReadInstallerAppInfo(t *testing.T) {
+	t.Run("reads the shared support version", func(t *testing.T) {
+		path := filepath.Join("test-fixtures", "Install macOS Sonoma.app")
+
+		info, err := ReadInstallerInfo(path + "/")
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, InstallerInfo{
+			Path:                   path + "/",
+			Kind:                   InstallerKindApp,
+			ProductName:            "Install macOS Sonoma",
+			OSVersion:              "14.0",
+			AppVersion:             "19.0.02",
+			SharedSupportOSVersion: "14.0.1",
+			SharedSupportImage:     filepath.Join(path, "Contents", "SharedSupport", "SharedSupport.dmg"),
+		}, info)
+	})
+
+	t.Run("works without shared support", func(t *testing.T) {
+		info, err := ReadInstallerAppInfo(filepath.Join("test-fixtures", "Install macOS Big Sur.app"))
+
+		assert.NilError(t, err)
+		assert.Equal(t, "11.2", info.OSVersion)
+		assert.Equal(t, "16.4.06", info.AppVersion)
+		assert.Equal(t, "", info.SharedSupportImage)
+	})
+
+	t.Run("reports missing apps", func(t *testing.T) {
+		_, err := ReadInstallerAppInfo(filepath.Join(t.TempDir(), "Install macOS Ventura.app"))
+
+		assert.ErrorContains(t, err, "installer app does not exist")
+	})
+
+	t.Run("requires an info plist", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "Install macOS Ventura.app")
+		assert.NilError(t, os.MkdirAll(path, 0o755))
+
+		_, err := ReadInstallerAppInfo(path)
+
+		assert.ErrorContains(t, err, "installer app info plist did not exist")
+	})
+}
+
+func TestReadInstallerInfoExtension(t *testing.T) {
+	_, err := ReadInstallerInfo("/tmp/macOS.dmg")
+
+	assert.ErrorContains(t, err, `installer "/tmp/macOS.dmg" is neither an .app nor an .ipsw`)
+}
@@ -9,12 +9,12 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
-	"bytes"
 
-	"github.com/groob/plist"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/pathing"
@@ -25,24 +25,19 @@ var (
 	letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
 )
 
-// InstallerAppPlist is a list of variables that comes from the installer app
-type InstallerAppPlist struct {
-	OSVersion      string `plist:"DTPlatformVersion"`
-	BundlerVersion string `plist:"CFBundleShortVersionString"`
-}
-
-// InstallerIPSWPlist is a list of variables that comes from the ipsw
-type InstallerIPSWPlist struct {
-	ProductVersion      string `plist:"ProductVersion"`
-	ProductBuildVersion string `plist:"ProductBuildVersion"`
+// HostResources describes the capacity of the host running the builds
+type HostResources struct {
+	MemoryBytes uint64
+	CPUCount    int
 }
 
 // Util defines everything this utility can do
 type Util interface {
 	ConfigTmpDir() (string, error)
 	ConvertDiskSizeToBytes(diskSize string) (uint64, error)
-	ObtainMacOSVersionFromInstallerApp(path string) (InstallerAppPlist, error)
-	ObtainMacOSVersionFromInstallerIPSW(path string) (InstallerIPSWPlist, error)
+	FreeDiskSpace(path string) (uint64, error)
+	HostResources() (HostResources, error)
+	ReadInstallerInfo(path string) (InstallerInfo, error)
 	RandSeq(n int) string
 	StepError(ui packer.Ui, state multistep.StateBag, err error) multistep.StepAction
 	// ExecuteHostCommand(name string, arg ...string) string
@@ -87,41 +82,9 @@ func (u *AnkaUtil) ConvertDiskSizeToBytes(diskSize string) (uint64, error) {
 	}
 }
 
-// ObtainMacOSVersionFromInstaller abstracts the os version from the installer ipsw provided
-func (u *AnkaUtil) ObtainMacOSVersionFromInstallerIPSW(path string) (InstallerIPSWPlist, error) {
-	installerPlist := InstallerIPSWPlist{}
-	plistContent := bytes.NewReader([]byte(executeHostCommand("unzip", "-p", path, "SystemVersion.plist")))
-	err := plist.NewXMLDecoder(plistContent).Decode(&installerPlist)
-	if err != nil {
-		return installerPlist, err
-	}
-	return installerPlist, nil
-}
-
-// ObtainMacOSVersionFromInstaller abstracts the os version from the installer app provided
-func (u *AnkaUtil) ObtainMacOSVersionFromInstallerApp(path string) (InstallerAppPlist, error) {
-	installerPlist := InstallerAppPlist{}
-	_, err := os.Stat(path)
-	if os.IsNotExist(err) {
-		return installerPlist, fmt.Errorf("installer app does not exist at %q: %w", path, err)
-	}
-	if err != nil {
-		return installerPlist, fmt.Errorf("failed to stat installer at %q: %w", path, err)
-	}
-	plistPath := filepath.Join(path, "Contents", "Info.plist")	
-	_, err = os.Stat(plistPath)
-	if os.IsNotExist(err) {
-		return installerPlist, fmt.Errorf("installer app info plist did not exist at %q: %w", plistPath, err)
-	}
-	if err != nil {
-		return installerPlist, fmt.Errorf("failed to stat installer app info plist at %q: %w", plistPath, err)
-	}
-	plistContent, _ := os.Open(plistPath)
-	err = plist.NewXMLDecoder(plistContent).Decode(&installerPlist)
-	if err != nil {
-		return installerPlist, err
-	}
-	return installerPlist, nil
+// ReadInstallerInfo reads the macOS version and other metadata from an installer app or IPSW
+func (u *AnkaUtil) ReadInstallerInfo(path string) (InstallerInfo, error) {
+	return ReadInstallerInfo(path)
 }
 
 // ConfigTmpDir creates the temp dir used by packer during runtime
@@ -165,6 +128,65 @@ func (u *AnkaUtil) ConfigTmpDir() (string, error) {
 	return td, nil
 }
 
+// HostResources reports the total memory and logical CPU count of the host
+func (u *AnkaUtil) HostResources() (HostResources, error) {
+	resources := HostResources{
+		CPUCount: runtime.NumCPU(),
+	}
+
+	output, err := exec.Command("sysctl", "-n", "hw.memsize").Output()
+	if err == nil {
+		resources.MemoryBytes, err = strconv.ParseUint(strings.TrimSpace(string(output)), 10, 64)
+		if err != nil {
+			return resources, fmt.Errorf("failed to parse host memory size %q: %w", strings.TrimSpace(string(output)), err)
+		}
+		return resources, nil
+	}
+
+	// Not macOS; fall back to /proc/meminfo
+	meminfo, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return resources, fmt.Errorf("failed to determine host memory size: %w", err)
+	}
+	for _, line := range strings.Split(string(meminfo), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kilobytes, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return resources, fmt.Errorf("failed to parse host memory size %q: %w", fields[1], err)
+			}
+			resources.MemoryBytes = kilobytes * 1024
+			return resources, nil
+		}
+	}
+
+	return resources, fmt.Errorf("failed to determine host memory size")
+}
+
+// FreeDiskSpace reports the bytes available to unprivileged users on the volume holding path.
+// Missing directories are resolved to their closest existing parent.
+func (u *AnkaUtil) FreeDiskSpace(path string) (uint64, error) {
+	for {
+		_, err := os.Stat(path)
+		if err == nil {
+			break
+		}
+		parent := filepath.Dir(path)
+		if !os.IsNotExist(err) || parent == path {
+			return 0, fmt.Errorf("failed to stat %q: %w", path, err)
+		}
+		path = parent
+	}
+
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, fmt.Errorf("failed to determine free disk space of %q: %w", path, err)
+	}
+
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
+
 func (u *AnkaUtil) RandSeq(n int) string {
 	random = rand.New(rand.NewSource(time.Now().UnixNano()))
 
@@ -175,9 +197,3 @@ func (u *AnkaUtil) RandSeq(n int) string {
 
 	return string(b)
 }
-
-func executeHostCommand(name string, arg ...string) string {
-	output, _ := exec.Command(name, arg...).CombinedOutput()
-
-	return string(output)
-}